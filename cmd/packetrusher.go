@@ -2,23 +2,27 @@ package main
 
 import (
 	"my5G-RANTester/config"
+	"my5G-RANTester/internal/events"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/monitoring"
+	"my5G-RANTester/internal/report"
 	"my5G-RANTester/internal/templates"
 	pcap "my5G-RANTester/internal/utils"
-	// "fmt"
+	"fmt"
 	"github.com/davecgh/go-spew/spew"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 const version = "1.0.1"
 
-func init() {
-
-	cfg, err := config.GetConfig()
+func setupLogsAndConfig(configPath string) error {
+	cfg, err := config.Load(configPath)
 	if err != nil {
-		//return nil
-		log.Fatal("Error in get configuration")
+		return err
 	}
 
 	// Output to stdout instead of the default stderr
@@ -35,20 +39,105 @@ func init() {
 	spew.Config.Indent = "\t"
 
 	log.Info("PacketRusher version " + version)
+	return nil
+}
+
+// overrideSubscribers applies the --subscribers flag of a command to the configuration, and validates the subscribers.
+func overrideSubscribers(c *cli.Context) error {
+	if !c.IsSet("subscribers") {
+		return nil
+	}
+	return config.Override(func(cfg *config.Config) {
+		cfg.Subscribers = c.Path("subscribers")
+	})
+}
+
+func writeReports(runReport *report.Report, jsonPath string, junitPath string) error {
+	if jsonPath != "" {
+		if err := runReport.WriteJSON(jsonPath); err != nil {
+			return err
+		}
+		log.Info("[TESTER] Report written to ", jsonPath)
+	}
+	if junitPath != "" {
+		if err := runReport.WriteJUnit(junitPath); err != nil {
+			return err
+		}
+		log.Info("[TESTER] JUnit report written to ", junitPath)
+	}
+	return nil
+}
+
+// assertionFlags are the pass/fail criteria of the ue, multi-ue and custom-scenario commands, checked at the end of the run.
+var assertionFlags = []cli.Flag{
+	&cli.Float64Flag{Name: "assert-min-registration-success-ratio", Usage: "Fail the run if the ratio of successful registrations is below this ratio, eg: 0.99"},
+	&cli.DurationFlag{Name: "assert-max-pdu-session-p95-latency", Usage: "Fail the run if the p95 latency of the successful PDU Session establishments is above this latency, eg: 500ms"},
+	&cli.BoolFlag{Name: "assert-no-error-indication", Usage: "Fail the run if an Error Indication is received from the AMF"},
+	&cli.BoolFlag{Name: "assert-all-deregistered", Usage: "Fail the run if a registered UE did not deregister cleanly before the end of the run"},
+}
+
+func setAssertions(c *cli.Context) {
+	report.SetAssertions(report.Assertions{
+		MinRegistrationSuccessRatio: c.Float64("assert-min-registration-success-ratio"),
+		MaxPduSessionP95Latency:     c.Duration("assert-max-pdu-session-p95-latency"),
+		NoErrorIndication:           c.Bool("assert-no-error-indication"),
+		AllDeregistered:             c.Bool("assert-all-deregistered"),
+	})
 }
 
 func main() {
 
 	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.PathFlag{Name: "config", Usage: "Path of the configuration file. Defaults to config/config.yml in PacketRusher source folder", EnvVars: []string{"PACKETRUSHER_CONFIG"}},
+			&cli.PathFlag{Name: "report", Usage: "Write at the end of the run a JSON report of the procedures attempted by each UE to the given path"},
+			&cli.PathFlag{Name: "junit", Usage: "Write at the end of the run a JUnit XML report of the procedures attempted by each UE to the given path"},
+			&cli.StringFlag{Name: "metrics-addr", Usage: "Expose Prometheus metrics of the UEs, gNodeBs and procedures on http://ADDR/metrics, eg: 0.0.0.0:9090"},
+			&cli.PathFlag{Name: "events", Usage: "Write to the given path a JSON line for every UE state transition, NAS and NGAP message, and error"},
+			&cli.DurationFlag{Name: "drain-timeout", Value: 10 * time.Second, Usage: "Once stopped, eg: on interrupt, time given to the UEs to release their PDU Sessions and deregister, and to the gNodeBs to release the UE contexts left"},
+		},
+		Before: func(c *cli.Context) error {
+			if err := setupLogsAndConfig(c.Path("config")); err != nil {
+				return err
+			}
+			lifecycle.SetDrainTimeout(c.Duration("drain-timeout"))
+			lifecycle.HandleSignals()
+			if c.IsSet("events") {
+				if err := events.Open(c.Path("events")); err != nil {
+					return err
+				}
+			}
+			if c.IsSet("metrics-addr") {
+				return monitoring.StartMetricsServer(c.String("metrics-addr"))
+			}
+			return nil
+		},
+		After: func(c *cli.Context) error {
+			if err := events.Close(); err != nil {
+				log.Error("[TESTER] ", err)
+			}
+			runReport := report.Build()
+			runReport.LogLatencies()
+			if err := writeReports(&runReport, c.Path("report"), c.Path("junit")); err != nil {
+				return err
+			}
+			if len(runReport.Violations) > 0 {
+				for _, violation := range runReport.Violations {
+					log.Error("[TESTER][ASSERT] ", violation)
+				}
+				return fmt.Errorf("%d assertion(s) failed", len(runReport.Violations))
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:    "ue",
 				Aliases: []string{"ue"},
 				Usage:   "Launch a gNB and a UE with a PDU Session\nFor more complex scenario and features, use instead packetrusher multi-ue\n",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.BoolFlag{Name: "disableTunnel", Aliases: []string{"t"}, Usage: "Disable the creation of the GTP-U tunnel interface."},
 					&cli.PathFlag{Name: "pcap", Usage: "Capture traffic to given PCAP file when a path is given", Value: "./dump.pcap"},
-				},
+				}, assertionFlags...),
 				Action: func(c *cli.Context) error {
 					name := "Testing an ue attached with configuration"
 					cfg := config.Data
@@ -67,6 +156,7 @@ func main() {
 						pcap.CaptureTraffic(c.Path("pcap"))
 					}
 
+					setAssertions(c)
 					templates.TestAttachUeWithConfiguration(tunnelEnabled)
 					return nil
 				},
@@ -96,7 +186,7 @@ func main() {
 				Usage: "\nLoad endurance stress tests.\n" +
 					"Example for testing multiple UEs: multi-ue -n 5 \n" +
 					"This test case will launch N UEs. See packetrusher multi-ue --help\n",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.IntFlag{Name: "number-of-ues", Value: 1, Aliases: []string{"n"}},
 					&cli.IntFlag{Name: "timeBetweenRegistration", Value: 500, Aliases: []string{"tr"}, Usage: "The time in ms, between UE registration."},
 					&cli.IntFlag{Name: "timeBeforeDeregistration", Value: 0, Aliases: []string{"td"}, Usage: "The time in ms, before a UE deregisters once it has been registered. 0 to disable auto-deregistration."},
@@ -106,11 +196,25 @@ func main() {
 					&cli.BoolFlag{Name: "tunnel", Aliases: []string{"t"}, Usage: "Enable the creation of the GTP-U tunnel interface."},
 					&cli.BoolFlag{Name: "dedicatedGnb", Aliases: []string{"d"}, Usage: "Enable the creation of a dedicated gNB per UE. Require one IP on N2/N3 per gNB."},
 					&cli.PathFlag{Name: "pcap", Usage: "Capture traffic to given PCAP file when a path is given", Value: "./dump.pcap"},
-				},
+					&cli.PathFlag{Name: "subscribers", Usage: "Path of a YAML or CSV file holding the profile of each UE. Overrides subscribers from the configuration"},
+					&cli.PathFlag{Name: "load-profile", Usage: "Path of a YAML load profile, whose phases ramp the number of attached UEs up and down. Replaces --number-of-ues, see config/load-profile.yml"},
+					&cli.StringFlag{Name: "arrival-model", Value: "fixed", Usage: "Distribution of the time between UE registrations (mean: timeBetweenRegistration) and of the time before deregistration (mean: timeBeforeDeregistration): fixed, poisson (or exponential), or gaussian (standard deviation of a quarter of the mean)"},
+					&cli.Int64Flag{Name: "seed", Value: 0, Usage: "Seed of the arrival model, to reproduce a run. A random seed is used and logged by default"},
+					&cli.StringFlag{Name: "control-addr", Usage: "Listen address of the HTTP control API, eg: 127.0.0.1:8080. The API lists gNodeBs and UEs, and triggers procedures on UEs at runtime. Disabled by default"},
+				}, assertionFlags...),
 				Action: func(c *cli.Context) error {
 					var numUes int
 					name := "Testing registration of multiple UEs"
+					if err := overrideSubscribers(c); err != nil {
+						return err
+					}
 					cfg := config.Data
+					setAssertions(c)
+
+					if c.IsSet("load-profile") {
+						templates.TestWithLoadProfile(c.Path("load-profile"))
+						return nil
+					}
 
 					if c.IsSet("number-of-ues") {
 						numUes = c.Int("number-of-ues")
@@ -122,6 +226,9 @@ func main() {
 					log.Info("---------------------------------------")
 					log.Info("[TESTER] Starting test function: ", name)
 					log.Info("[TESTER][UE] Number of UEs: ", numUes)
+					if cfg.Subscribers != "" {
+						log.Info("[TESTER][UE] Subscribers: ", cfg.Subscribers)
+					}
 					log.Info("[TESTER][GNB] gNodeB control interface IP/Port: ", cfg.GNodeB.ControlIF.Ip, "/", cfg.GNodeB.ControlIF.Port)
 					log.Info("[TESTER][GNB] gNodeB data interface IP/Port: ", cfg.GNodeB.DataIF.Ip, "/", cfg.GNodeB.DataIF.Port)
 					log.Info("[TESTER][AMF] AMF IP/Port: ", cfg.AMF.Ip, "/", cfg.AMF.Port)
@@ -131,7 +238,7 @@ func main() {
 						pcap.CaptureTraffic(c.Path("pcap"))
 					}
 
-					templates.TestMultiUesInQueue(numUes, c.Bool("tunnel"), c.Bool("dedicatedGnb"), c.Bool("loop"), c.Int("timeBetweenRegistration"), c.Int("timeBeforeDeregistration"), c.Int("timeBeforeHandover"), c.Int("numPduSessions"))
+					templates.TestMultiUesInQueue(numUes, c.Bool("tunnel"), c.Bool("dedicatedGnb"), c.Bool("loop"), c.Int("timeBetweenRegistration"), c.Int("timeBeforeDeregistration"), c.Int("timeBeforeHandover"), c.Int("numPduSessions"), c.String("control-addr"), c.String("arrival-model"), c.Int64("seed"))
 
 					return nil
 				},
@@ -139,12 +246,18 @@ func main() {
 			{
 				Name: "custom-scenario",
 				Aliases: []string{"c"},
-				Flags: []cli.Flag{
-					&cli.PathFlag{Name: "scenario", Usage: "Specify the scenario path in .wasm"},
-				},
+				Flags: append([]cli.Flag{
+					&cli.PathFlag{Name: "scenario", Usage: "Specify the scenario path, either a .wasm module or a declarative .yml/.yaml/.json scenario"},
+					&cli.IntFlag{Name: "number-of-ues", Value: 1, Aliases: []string{"n"}, Usage: "The number of UEs running the .wasm scenario, each UE calls ueHandler(ueId) with ueId from 1 to n"},
+					&cli.PathFlag{Name: "subscribers", Usage: "Path of a YAML or CSV file holding the profile of each UE. Overrides subscribers from the configuration"},
+				}, assertionFlags...),
 				Action: func(c *cli.Context) error {
 					var scenarioPath string
 
+					if err := overrideSubscribers(c); err != nil {
+						return err
+					}
+
 					if c.IsSet("scenario") {
 						scenarioPath = c.Path("scenario")
 					} else {
@@ -152,65 +265,130 @@ func main() {
 						return nil
 					}
 
-					templates.TestWithCustomScenario(scenarioPath)
+					setAssertions(c)
+					switch filepath.Ext(scenarioPath) {
+					case ".yml", ".yaml", ".json":
+						templates.TestWithDeclarativeScenario(scenarioPath)
+					default:
+						templates.TestWithCustomScenario(scenarioPath, c.Int("number-of-ues"))
+					}
 
 					return nil
 				},
 			},
 			{
-				Name:    "amf-load-loop",
+				Name:    "registration-rate",
 				Aliases: []string{"amf-load-loop"},
-				Usage: "\nTest AMF responses in interval\n" +
-					"Example for generating 20 requests to AMF per second in interval of 20 seconds: amf-load-loop -n 20 -t 20\n",
+				Usage: "\nStress the AMF with a target rate of UE registrations per second\n" +
+					"Example for registering 20 UEs per second during 60 seconds over 2 gNodeBs: registration-rate -n 20 -t 60 --gnbs 2\n",
 				Flags: []cli.Flag{
-					&cli.IntFlag{Name: "number-of-requests", Value: 1, Aliases: []string{"n"}},
-					&cli.IntFlag{Name: "time", Value: 1, Aliases: []string{"t"}},
+					&cli.IntFlag{Name: "rate", Value: 1, Aliases: []string{"n"}, Usage: "The target number of UE registrations started per second"},
+					&cli.IntFlag{Name: "time", Value: 1, Aliases: []string{"t"}, Usage: "The duration of the test in seconds"},
+					&cli.IntFlag{Name: "gnbs", Value: 1, Usage: "The number of gNodeBs the UEs are spread over. Require one IP on N2/N3 per gNB, unless gnodebs are configured"},
+					&cli.IntFlag{Name: "numPduSessions", Value: 0, Aliases: []string{"nPdu"}, Usage: "The number of PDU Sessions established by each UE once registered, as part of its registration"},
+					&cli.DurationFlag{Name: "timeout", Value: 10 * time.Second, Usage: "A registration not completed within this timeout fails"},
+					&cli.Float64Flag{Name: "min-success-ratio", Value: 0.95, Usage: "The AMF is saturated once the success ratio of the registrations started during a second is below this ratio"},
+					&cli.DurationFlag{Name: "max-latency", Value: 0, Usage: "The AMF is saturated once the p95 latency of the registrations started during a second is above this latency, eg: 500ms. 0 to disable"},
+					&cli.PathFlag{Name: "subscribers", Usage: "Path of a YAML or CSV file holding the profile of each UE. Overrides subscribers from the configuration"},
 				},
 				Action: func(c *cli.Context) error {
-					var time int
-					var numRqs int
+					name := "Test AMF registration rate"
+					if err := overrideSubscribers(c); err != nil {
+						return err
+					}
+					if c.Int("rate") < 1 || c.Int("time") < 1 || c.Int("gnbs") < 1 {
+						return fmt.Errorf("invalid load: --rate, --time and --gnbs must be at least 1")
+					}
+					cfg := config.Data
+
+					log.Info("---------------------------------------")
+					log.Info("[TESTER] Starting test function: ", name)
+					log.Info("[TESTER][UE] Registrations per second: ", c.Int("rate"), " during ", c.Int("time"), " seconds")
+					log.Info("[TESTER][GNB] Number of GNBs: ", c.Int("gnbs"))
+					log.Info("[TESTER][GNB] gNodeB control interface IP/Port: ", cfg.GNodeB.ControlIF.Ip, "/", cfg.GNodeB.ControlIF.Port)
+					log.Info("[TESTER][AMF] AMF IP/Port: ", cfg.AMF.Ip, "/", cfg.AMF.Port)
+					log.Info("---------------------------------------")
 
-					name := "Test AMF responses in interval"
+					result := templates.TestRegistrationRate(c.Int("rate"), c.Int("time"), c.Int("gnbs"), c.Int("numPduSessions"),
+						c.Duration("timeout"), c.Float64("min-success-ratio"), c.Duration("max-latency"))
+					log.Info(fmt.Sprintf("[TESTER][RATE] Achieved %.1f registrations per second out of %d, success ratio %.2f", result.AchievedRate, result.TargetRate, result.SuccessRatio))
+					if result.Saturated {
+						log.Warn("[TESTER][RATE] AMF saturated from second ", result.SaturationSecond, ": ", result.SaturationCause)
+					} else {
+						log.Info("[TESTER][RATE] AMF not saturated")
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "capacity-search",
+				Usage: "\nSearch the highest UE registration rate the AMF sustains while meeting the SLOs\n" +
+					"Example for searching between 10 and 500 registrations per second, with steps of 30 seconds and a p99 latency of 1s: capacity-search --min-rate 10 --max-rate 500 --step-time 30 --max-p99-latency 1s\n",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "min-rate", Value: 1, Usage: "The lowest registration rate per second searched"},
+					&cli.IntFlag{Name: "max-rate", Value: 1000, Usage: "The highest registration rate per second searched"},
+					&cli.IntFlag{Name: "precision", Value: 1, Usage: "The search stops once the capacity is known within this number of registrations per second"},
+					&cli.IntFlag{Name: "step-time", Value: 30, Usage: "The duration of each load step in seconds"},
+					&cli.DurationFlag{Name: "cooldown", Value: 10 * time.Second, Usage: "The pause between load steps, for the AMF to recover"},
+					&cli.IntFlag{Name: "gnbs", Value: 1, Usage: "The number of gNodeBs the UEs are spread over. Require one IP on N2/N3 per gNB, unless gnodebs are configured"},
+					&cli.IntFlag{Name: "numPduSessions", Value: 0, Aliases: []string{"nPdu"}, Usage: "The number of PDU Sessions established by each UE once registered, as part of its registration"},
+					&cli.DurationFlag{Name: "timeout", Value: 10 * time.Second, Usage: "A registration not completed within this timeout fails"},
+					&cli.Float64Flag{Name: "min-success-ratio", Value: 0.99, Usage: "SLO: the lowest success ratio of the registrations of a load step"},
+					&cli.DurationFlag{Name: "max-p99-latency", Value: 0, Usage: "SLO: the highest p99 latency of the registrations of a load step, eg: 1s. 0 to disable"},
+					&cli.PathFlag{Name: "subscribers", Usage: "Path of a YAML or CSV file holding the profile of each UE. Overrides subscribers from the configuration"},
+				},
+				Action: func(c *cli.Context) error {
+					name := "Search AMF registration capacity"
+					if err := overrideSubscribers(c); err != nil {
+						return err
+					}
 					cfg := config.Data
 
-					numRqs = c.Int("number-of-requests")
-					time = c.Int("time")
+					minRate, maxRate := c.Int("min-rate"), c.Int("max-rate")
+					if minRate < 1 || maxRate < minRate || c.Int("precision") < 1 {
+						return fmt.Errorf("invalid search range: --min-rate must be at least 1, --max-rate at least --min-rate, and --precision at least 1")
+					}
 
 					log.Info("---------------------------------------")
-					log.Warn("[TESTER] Starting test function: ", name)
-					log.Warn("[TESTER][UE] Number of Requests per second: ", numRqs)
+					log.Info("[TESTER] Starting test function: ", name)
+					log.Info("[TESTER][UE] Registrations per second: from ", minRate, " to ", maxRate, ", steps of ", c.Int("step-time"), " seconds")
+					log.Info("[TESTER][GNB] Number of GNBs: ", c.Int("gnbs"))
 					log.Info("[TESTER][GNB] gNodeB control interface IP/Port: ", cfg.GNodeB.ControlIF.Ip, "/", cfg.GNodeB.ControlIF.Port)
-					log.Info("[TESTER][GNB] gNodeB data interface IP/Port: ", cfg.GNodeB.DataIF.Ip, "/", cfg.GNodeB.DataIF.Port)
 					log.Info("[TESTER][AMF] AMF IP/Port: ", cfg.AMF.Ip, "/", cfg.AMF.Port)
 					log.Info("---------------------------------------")
-					log.Warn("[TESTER][GNB] Total of AMF Responses in the interval:", templates.TestRqsLoop(numRqs, time))
+
+					templates.TestCapacitySearch(minRate, maxRate, c.Int("step-time"), c.Int("gnbs"), c.Int("numPduSessions"), c.Duration("timeout"),
+						c.Float64("min-success-ratio"), c.Duration("max-p99-latency"), c.Int("precision"), c.Duration("cooldown"))
 					return nil
 				},
 			},
 			{
-				Name:    "Test availability of AMF",
+				Name:    "amf-health",
 				Aliases: []string{"amf-availability"},
-				Usage: "\nTest availability of AMF in interval\n" +
-					"Test availability of AMF in 20 seconds: amf-availability -t 20\n",
+				Usage: "\nMonitor the availability of the AMF, eg: during a core upgrade\n" +
+					"Example for probing the AMF every second, and registering the UE of the configuration every 10 seconds, until interrupted: amf-health --canary-interval 10s --timeline timeline.json\n",
 				Flags: []cli.Flag{
-					&cli.IntFlag{Name: "time", Value: 1, Aliases: []string{"t"}},
+					&cli.IntFlag{Name: "time", Value: 0, Aliases: []string{"t"}, Usage: "The duration of the monitoring in seconds. 0 to monitor until interrupted"},
+					&cli.DurationFlag{Name: "interval", Value: 1 * time.Second, Usage: "The interval between NG Setup probes, the SCTP association is re-established on the next probe once lost"},
+					&cli.DurationFlag{Name: "canary-interval", Value: 0, Usage: "The interval between registrations of the canary UE, the UE of the configuration. 0 to disable"},
+					&cli.DurationFlag{Name: "timeout", Value: 2 * time.Second, Usage: "A probe not answered within this timeout fails"},
+					&cli.PathFlag{Name: "timeline", Usage: "Path of the JSON availability timeline written at the end of the monitoring, with every check, outage and the MTTR"},
 				},
 				Action: func(c *cli.Context) error {
-					var time int
-
-					name := "Test availability of AMF"
+					name := "Monitor AMF health"
 					cfg := config.Data
-
-					time = c.Int("time")
+					amf := cfg.GetAMFs()[0]
 
 					log.Info("---------------------------------------")
-					log.Warn("[TESTER] Starting test function: ", name)
-					log.Warn("[TESTER][UE] Interval of test: ", time, " seconds")
+					log.Info("[TESTER] Starting test function: ", name)
 					log.Info("[TESTER][GNB] Control interface IP/Port: ", cfg.GNodeB.ControlIF.Ip, "/", cfg.GNodeB.ControlIF.Port)
-					log.Info("[TESTER][GNB] Data interface IP/Port: ", cfg.GNodeB.DataIF.Ip, "/", cfg.GNodeB.DataIF.Port)
-					log.Info("[TESTER][AMF] AMF IP/Port: ", cfg.AMF.Ip, "/", cfg.AMF.Port)
+					log.Info("[TESTER][AMF] AMF IP/Port: ", amf.Ip, "/", amf.Port)
 					log.Info("---------------------------------------")
-					templates.TestAvailability(time)
+
+					timeline := templates.TestAmfHealth(time.Duration(c.Int("time"))*time.Second, c.Duration("interval"), c.Duration("canary-interval"), c.Duration("timeout"))
+					if c.IsSet("timeline") {
+						return timeline.WriteJSON(c.Path("timeline"))
+					}
 					return nil
 				},
 			},
@@ -5,9 +5,14 @@
 package config
 
 import (
-	"io/ioutil"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"my5G-RANTester/lib/milenage"
+	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
 
 	"github.com/free5gc/nas/nasMessage"
@@ -17,13 +22,19 @@ import (
 )
 
 // Conf: Used for access to configuration
-var Data = getConfig()
+// Data is populated by Load, or lazily by GetConfig with the default configuration file.
+var Data Config
+
+var loaded = false
 
 type Config struct {
-	GNodeB GNodeB `yaml:"gnodeb"`
-	Ue     Ue     `yaml:"ue"`
-	AMF    AMF    `yaml:"amfif"`
-	Logs   Logs   `yaml:"logs"`
+	GNodeB      GNodeB   `yaml:"gnodeb"`
+	GNodeBs     []GNodeB `yaml:"gnodebs"`
+	Ue          Ue       `yaml:"ue"`
+	AMF         AMF      `yaml:"amfif"`
+	AMFs        []AMF    `yaml:"amfifs"`
+	Logs        Logs     `yaml:"logs"`
+	Subscribers string   `yaml:"subscribers"`
 }
 
 type GNodeB struct {
@@ -31,6 +42,14 @@ type GNodeB struct {
 	DataIF           DataIF           `yaml:"dataif"`
 	PlmnList         PlmnList         `yaml:"plmnlist"`
 	SliceSupportList SliceSupportList `yaml:"slicesupportlist"`
+	// Optional, length in bits of gnbid, defaults to 4 bits per hexadecimal character
+	GnbIdLength int `yaml:"gnbidlength"`
+	// Optional, tracking areas, PLMNs and slices supported in addition to the ones of plmnlist and slicesupportlist
+	TacList           []string           `yaml:"taclist"`
+	BroadcastPlmnList []Plmn             `yaml:"broadcastplmnlist"`
+	SliceList         []SliceSupportList `yaml:"slicelist"`
+	// Optional, AMFs of this gNodeB, replacing amfif and amfifs
+	AMFs []AMF `yaml:"amfifs"`
 }
 
 type ControlIF struct {
@@ -47,6 +66,10 @@ type PlmnList struct {
 	Tac   string `yaml:"tac"`
 	GnbId string `yaml:"gnbid"`
 }
+type Plmn struct {
+	Mcc string `yaml:"mcc"`
+	Mnc string `yaml:"mnc"`
+}
 type SliceSupportList struct {
 	Sst string `yaml:"sst"`
 	Sd  string `yaml:"sd"`
@@ -56,6 +79,7 @@ type Ue struct {
 	Msin             string    `yaml:"msin"`
 	Key              string    `yaml:"key"`
 	Opc              string    `yaml:"opc"`
+	Op               string    `yaml:"op"`
 	Amf              string    `yaml:"amf"`
 	Sqn              string    `yaml:"sqn"`
 	Dnn              string    `yaml:"dnn"`
@@ -65,6 +89,9 @@ type Ue struct {
 	Integrity        Integrity `yaml:"integrity"`
 	Ciphering        Ciphering `yaml:"ciphering"`
 	TunnelEnabled    bool      `yaml:"tunnelenabled"`
+	Suci             Suci      `yaml:"suci"`
+	Imei             string    `yaml:"imei"`   // optional, answered to Identity Requests for the IMEI
+	Imeisv           string    `yaml:"imeisv"` // optional, answered to Identity Requests for the IMEISV
 }
 
 type Hplmn struct {
@@ -75,6 +102,17 @@ type Snssai struct {
 	Sst int    `yaml:"sst"`
 	Sd  string `yaml:"sd"`
 }
+
+// Suci is the protection scheme of the SUCI of the UE, and the home network public key of each ECIES profile, TS 33.501 6.12.2
+type Suci struct {
+	ProtectionScheme int                  `yaml:"protectionscheme"` // 0: null scheme, 1: ECIES Profile A, 2: ECIES Profile B
+	ProfileA         HomeNetworkPublicKey `yaml:"profilea"`
+	ProfileB         HomeNetworkPublicKey `yaml:"profileb"`
+}
+type HomeNetworkPublicKey struct {
+	Id  int    `yaml:"id"`
+	Key string `yaml:"key"`
+}
 type Integrity struct {
 	Nia0 bool `yaml:"nia0"`
 	Nia1 bool `yaml:"nia1"`
@@ -103,38 +141,91 @@ func RootDir() string {
 	return filepath.Dir(d)
 }
 
-func getConfig() Config {
+// DefaultPath returns the path of the configuration file shipped with the source tree.
+func DefaultPath() string {
+	return filepath.Join(RootDir(), "config", "config.yml")
+}
+
+// Load reads the configuration file at configPath, applies the PACKETRUSHER_*
+// environment variable overrides and validates the result.
+// If configPath is empty, DefaultPath() is used.
+// On success, the configuration is also stored in Data.
+func Load(configPath string) (Config, error) {
 	var cfg = Config{}
-	Ddir := RootDir()
-	configPath, err := filepath.Abs(Ddir + "/config/config.yml")
+
+	if configPath == "" {
+		configPath = DefaultPath()
+	}
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return Config{}, fmt.Errorf("could not resolve configuration path %s: %w", configPath, err)
+	}
 	log.Debug(configPath)
+
+	file, err := os.ReadFile(configPath)
 	if err != nil {
-		log.Fatal("Could not find config in: ", configPath)
+		return Config{}, fmt.Errorf("could not read configuration file %s: %w", configPath, err)
 	}
-	file, err := ioutil.ReadFile(configPath)
-	err = yaml.Unmarshal([]byte(file), &cfg)
+	err = yaml.Unmarshal(file, &cfg)
 	if err != nil {
-		log.Fatal("Could not read file in: ", configPath)
+		return Config{}, fmt.Errorf("could not parse configuration file %s: %w", configPath, err)
 	}
 
-	return cfg
+	err = applyEnvOverrides(&cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid environment override for configuration %s:\n%w", configPath, err)
+	}
+
+	// single gNodeB scenarios use the first gNodeB of the topology when gnodeb is not given
+	if len(cfg.GNodeBs) > 0 && reflect.DeepEqual(cfg.GNodeB, GNodeB{}) {
+		cfg.GNodeB = cfg.GNodeBs[0]
+	}
+
+	if len(cfg.AMFs) > 0 && cfg.AMF == (AMF{}) {
+		cfg.AMF = cfg.AMFs[0]
+	}
+
+	// subscribers file is relative to the configuration file
+	if cfg.Subscribers != "" && !filepath.IsAbs(cfg.Subscribers) {
+		cfg.Subscribers = filepath.Join(filepath.Dir(configPath), cfg.Subscribers)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid configuration %s:\n%w", configPath, err)
+	}
+
+	Data = cfg
+	loaded = true
+
+	return cfg, nil
 }
 
-func GetConfig() (Config, error) {
-	var cfg = Config{}
-	Ddir := RootDir()
-	configPath, err := filepath.Abs(Ddir + "/config/config.yml")
-	log.Debug(configPath)
+// Override applies override to the loaded configuration, eg: a command line flag, then validates the result as Load
+// does. The configuration is left unchanged if the result is invalid.
+func Override(override func(cfg *Config)) error {
+	cfg, err := GetConfig()
 	if err != nil {
-		return Config{}, nil
+		return err
 	}
-	file, err := ioutil.ReadFile(configPath)
-	err = yaml.Unmarshal([]byte(file), &cfg)
+	override(&cfg)
+
+	err = cfg.Validate()
 	if err != nil {
-		return Config{}, nil
+		return fmt.Errorf("invalid configuration:\n%w", err)
 	}
 
-	return cfg, nil
+	Data = cfg
+	return nil
+}
+
+// GetConfig returns the configuration loaded by Load.
+// If no configuration was loaded yet, the default configuration file is loaded.
+func GetConfig() (Config, error) {
+	if loaded {
+		return Data, nil
+	}
+	return Load("")
 }
 
 func (config *Config) GetUESecurityCapability() *nasType.UESecurityCapability {
@@ -159,6 +250,68 @@ func (config *Config) GetUESecurityCapability() *nasType.UESecurityCapability {
 	return UESecurityCapability
 }
 
+// GetAMFs returns the AMFs the gNodeB connects to:
+// amfifs of the gnodeb when given, otherwise amfifs, otherwise amfif.
+func (config *Config) GetAMFs() []AMF {
+	if len(config.GNodeB.AMFs) > 0 {
+		return config.GNodeB.AMFs
+	}
+	if len(config.AMFs) > 0 {
+		return config.AMFs
+	}
+	return []AMF{config.AMF}
+}
+
+// GetGnbIdLength returns the length in bits of the gNB ID, TS 38.413 9.3.1.6
+func (gnb *GNodeB) GetGnbIdLength() int {
+	if gnb.GnbIdLength != 0 {
+		return gnb.GnbIdLength
+	}
+	return 4 * len(gnb.PlmnList.GnbId)
+}
+
+// GetOpc returns the OPc of the UE, derived from OP when OPc is not configured.
+func (ue *Ue) GetOpc() (string, error) {
+	if ue.Opc != "" {
+		return ue.Opc, nil
+	}
+	k, err := hex.DecodeString(ue.Key)
+	if err != nil {
+		return "", fmt.Errorf("invalid key %s: %w", ue.Key, err)
+	}
+	op, err := hex.DecodeString(ue.Op)
+	if err != nil {
+		return "", fmt.Errorf("invalid op %s: %w", ue.Op, err)
+	}
+	if len(k) != 16 || len(op) != 16 {
+		return "", errors.New("key and op must be 128 bits long to derive opc")
+	}
+	opc := make([]uint8, 16)
+	milenage.GenerateOPC(k, op, opc)
+	return hex.EncodeToString(opc), nil
+}
+
+// GetHomeNetworkPublicKey returns the identifier and the key of the home network public key of the protection scheme
+// of the SUCI, or none with the null scheme.
+func (suci *Suci) GetHomeNetworkPublicKey() (uint8, []byte, error) {
+	var publicKey HomeNetworkPublicKey
+	switch suci.ProtectionScheme {
+	case 0:
+		return 0, nil, nil
+	case 1:
+		publicKey = suci.ProfileA
+	case 2:
+		publicKey = suci.ProfileB
+	default:
+		return 0, nil, fmt.Errorf("unsupported protection scheme %d", suci.ProtectionScheme)
+	}
+	key, err := hex.DecodeString(publicKey.Key)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid home network public key %s: %w", publicKey.Key, err)
+	}
+	return uint8(publicKey.Id), key, nil
+}
+
 func boolToUint8(boolean bool) uint8 {
 	if boolean {
 		return 1
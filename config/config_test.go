@@ -0,0 +1,151 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDefaultConfig(t *testing.T) {
+	cfg, err := Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, "999", cfg.GNodeB.PlmnList.Mcc)
+}
+
+func TestLoadMissingConfig(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yml"))
+	assert.Error(t, err)
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("PACKETRUSHER_AMFIF_IP", "10.0.0.1")
+	t.Setenv("PACKETRUSHER_AMFIF_PORT", "38413")
+	t.Setenv("PACKETRUSHER_UE_INTEGRITY_NIA3", "true")
+
+	cfg, err := Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", cfg.AMF.Ip)
+	assert.Equal(t, 38413, cfg.AMF.Port)
+	assert.True(t, cfg.Ue.Integrity.Nia3)
+
+	t.Setenv("PACKETRUSHER_AMFIF_PORT", "not-a-port")
+	_, err = Load("")
+	assert.Contains(t, err.Error(), "PACKETRUSHER_AMFIF_PORT")
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	content, err := os.ReadFile(DefaultPath())
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	broken := strings.NewReplacer(
+		`mcc: "999"`, `mcc: "99"`,
+		`key: "00112233445566778899AABBCCDDEEFF"`, `key: "0011"`,
+		`ip: "192.168.11.30"`, `ip: "192.168.11"`,
+		`sst: 01`, `sst: 256`,
+		`protectionscheme: 0`, `protectionscheme: 3`,
+		`imei: "356938035643800"`, `imei: "3569380356438"`,
+	).Replace(string(content))
+	assert.NoError(t, os.WriteFile(path, []byte(broken), 0644))
+
+	_, err = Load(path)
+	assert.Error(t, err)
+	for _, field := range []string{"gnodeb.plmnlist.mcc", "ue.hplmn.mcc", "ue.key", "amfif.ip", "ue.snssai.sst", "ue.suci.protectionscheme", "ue.imei"} {
+		assert.Contains(t, err.Error(), field)
+	}
+}
+
+func TestLoadSubscribers(t *testing.T) {
+	cfg, err := Load("")
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "subscribers.csv")
+	assert.NoError(t, os.WriteFile(csvPath, []byte(
+		"msin,supi,op,integrity\n"+
+			"0000000001,,,nia1|nia2\n"+
+			",imsi-999700000000002,11111111111111111111111111111111,\n"), 0644))
+
+	ues, err := LoadSubscribers(csvPath, cfg.Ue)
+	assert.NoError(t, err)
+	assert.Len(t, ues, 2)
+	assert.Equal(t, "0000000001", ues[0].Msin)
+	assert.True(t, ues[0].Integrity.Nia1)
+	assert.Equal(t, cfg.Ue.Key, ues[0].Key)
+	assert.Equal(t, "0000000002", ues[1].Msin)
+	assert.Equal(t, "", ues[1].Opc)
+
+	yamlPath := filepath.Join(dir, "subscribers.yml")
+	assert.NoError(t, os.WriteFile(yamlPath, []byte(
+		"subscribers:\n"+
+			"  - msin: \"0000000001\"\n"+
+			"    snssai:\n"+
+			"      sst: 2\n"+
+			"  - msin: \"0000000001\"\n"+
+			"    key: \"0011\"\n"), 0644))
+
+	_, err = LoadSubscribers(yamlPath, cfg.Ue)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "subscribers[1].msin")
+	assert.Contains(t, err.Error(), "subscribers[1].key")
+}
+
+func TestLoadGnodebs(t *testing.T) {
+	content, err := os.ReadFile(DefaultPath())
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	topology := string(content) + `
+gnodebs:
+  - controlif: {ip: "10.0.2.1", port: 9487}
+    dataif: {ip: "10.0.3.1", port: 2152}
+    plmnlist: {mcc: "999", mnc: "70", tac: "000001", gnbid: "000001"}
+    slicesupportlist: {sst: "01"}
+    taclist: ["000002"]
+  - controlif: {ip: "10.1.2.1", port: 9487}
+    dataif: {ip: "10.1.3.1", port: 2152}
+    plmnlist: {mcc: "999", mnc: "70", tac: "000003", gnbid: "3fffff"}
+    gnbidlength: 22
+    slicesupportlist: {sst: "01"}
+`
+	assert.NoError(t, os.WriteFile(path, []byte(topology), 0644))
+
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.GNodeBs, 2)
+	assert.Equal(t, []string{"000002"}, cfg.GNodeBs[0].TacList)
+	assert.Equal(t, 24, cfg.GNodeBs[0].GetGnbIdLength())
+	assert.Equal(t, 22, cfg.GNodeBs[1].GetGnbIdLength())
+
+	broken := strings.Replace(topology, `gnbid: "3fffff"`, `gnbid: "000001"`, 1)
+	broken = strings.Replace(broken, `gnbidlength: 22`, `gnbidlength: 20`, 1)
+	assert.NoError(t, os.WriteFile(path, []byte(broken), 0644))
+
+	_, err = Load(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gnodebs[1].plmnlist.gnbid: 000001 is already used by gnodebs[0]")
+	assert.Contains(t, err.Error(), "gnodebs[1].plmnlist.gnbid: length of 20 bits")
+}
+
+func TestOverrideSubscribers(t *testing.T) {
+	_, err := Load("")
+	assert.NoError(t, err)
+
+	missing := filepath.Join(t.TempDir(), "missing.csv")
+	err = Override(func(cfg *Config) { cfg.Subscribers = missing })
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "subscribers")
+	assert.Equal(t, "", Data.Subscribers)
+
+	path := filepath.Join(t.TempDir(), "subscribers.csv")
+	assert.NoError(t, os.WriteFile(path, []byte("msin\n0000000001\n"), 0644))
+	assert.NoError(t, Override(func(cfg *Config) { cfg.Subscribers = path }))
+	assert.Equal(t, path, Data.Subscribers)
+}
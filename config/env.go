@@ -0,0 +1,110 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the configuration file.
+// The name of a variable is built from the yaml keys of the field, eg:
+// gnodeb.controlif.ip is overridden by PACKETRUSHER_GNODEB_CONTROLIF_IP
+// Items of a list are addressed by their index, eg: PACKETRUSHER_GNODEBS_0_CONTROLIF_IP
+const EnvPrefix = "PACKETRUSHER"
+
+func applyEnvOverrides(cfg *Config) error {
+	return overrideFromEnv(reflect.ValueOf(cfg).Elem(), EnvPrefix)
+}
+
+func overrideFromEnv(value reflect.Value, prefix string) error {
+	var errs []error
+
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		key := strings.Split(valueType.Field(i).Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		field := value.Field(i)
+
+		switch {
+		case field.Kind() == reflect.Struct:
+			errs = append(errs, overrideFromEnv(field, name))
+
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < field.Len(); j++ {
+				errs = append(errs, overrideFromEnv(field.Index(j), name+"_"+strconv.Itoa(j)))
+			}
+
+		default:
+			env, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			if err := setFromString(field, env); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func setFromString(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+
+	case reflect.Slice:
+		// lists of scalars are given as comma separated values
+		items := strings.Split(value, ",")
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package config
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// subscriber is an entry of the subscribers file.
+// A subscriber is identified either by its MSIN or by its SUPI (imsi-<mcc><mnc><msin>),
+// every field that is not given is inherited from the ue section of the configuration.
+type subscriber struct {
+	Supi string `yaml:"supi"`
+	Ue   `yaml:",inline"`
+}
+
+type subscribersFile struct {
+	Subscribers []yaml.MapSlice `yaml:"subscribers"`
+}
+
+// LoadSubscribers reads the subscriber profiles from a YAML (.yml, .yaml) or CSV (.csv) file.
+// Fields missing for a subscriber are taken from defaults.
+//
+// YAML files contain a subscribers list, whose items use the same keys as the ue section of the configuration,
+// plus an optional supi key.
+//
+// CSV files start with a header line naming the columns among:
+// msin, supi, key, opc, op, amf, sqn, dnn, routingindicator, mcc, mnc, sst, sd, integrity, ciphering
+// integrity and ciphering list the supported algorithms separated by '|', eg: nia1|nia2
+func LoadSubscribers(path string, defaults Ue) ([]Ue, error) {
+	var subscribers []subscriber
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		subscribers, err = readYamlSubscribers(path, defaults)
+	case ".csv":
+		subscribers, err = readCsvSubscribers(path, defaults)
+	default:
+		err = fmt.Errorf("unknown format for subscribers file %s, expected .yml, .yaml or .csv", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(subscribers) == 0 {
+		return nil, fmt.Errorf("subscribers file %s does not contain any subscriber", path)
+	}
+
+	v := validator{}
+	ues := make([]Ue, len(subscribers))
+	msins := make(map[string]int)
+	for i, sub := range subscribers {
+		prefix := "subscribers[" + strconv.Itoa(i) + "]."
+		if sub.Supi != "" {
+			msin, err := msinFromSupi(sub.Supi, sub.Hplmn)
+			if err != nil {
+				v.check(prefix+"supi", err)
+				continue
+			}
+			sub.Msin = msin
+		}
+		if sub.Op != defaults.Op && sub.Opc == defaults.Opc {
+			// OP given for this subscriber, the inherited OPc does not apply
+			sub.Opc = ""
+		}
+		if previous, ok := msins[sub.Msin]; ok {
+			v.check(prefix+"msin", fmt.Errorf("%s is already used by subscribers[%d]", sub.Msin, previous))
+		}
+		msins[sub.Msin] = i
+
+		validateUe(&v, prefix, sub.Ue)
+		ues[i] = sub.Ue
+	}
+	if err := v.err(); err != nil {
+		return nil, fmt.Errorf("invalid subscribers file %s:\n%w", path, err)
+	}
+
+	return ues, nil
+}
+
+func readYamlSubscribers(path string, defaults Ue) ([]subscriber, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read subscribers file %s: %w", path, err)
+	}
+
+	content := subscribersFile{}
+	if err := yaml.Unmarshal(file, &content); err != nil {
+		return nil, fmt.Errorf("could not parse subscribers file %s: %w", path, err)
+	}
+
+	subscribers := make([]subscriber, len(content.Subscribers))
+	for i, item := range content.Subscribers {
+		// decode each item over the defaults, so that missing fields are inherited
+		raw, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		subscribers[i] = subscriber{Ue: defaults}
+		if err := yaml.Unmarshal(raw, &subscribers[i]); err != nil {
+			return nil, fmt.Errorf("could not parse subscribers[%d] in %s: %w", i, path, err)
+		}
+	}
+
+	return subscribers, nil
+}
+
+func readCsvSubscribers(path string, defaults Ue) ([]subscriber, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read subscribers file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header of subscribers file %s: %w", path, err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var subscribers []subscriber
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse subscribers file %s: %w", path, err)
+		}
+
+		sub := subscriber{Ue: defaults}
+		var errs []error
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			if value == "" {
+				continue
+			}
+			errs = append(errs, sub.setCsvColumn(column, value))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("line %d of subscribers file %s: %w", line, path, err)
+		}
+		subscribers = append(subscribers, sub)
+	}
+
+	return subscribers, nil
+}
+
+func (sub *subscriber) setCsvColumn(column string, value string) error {
+	switch column {
+	case "msin":
+		sub.Msin = value
+	case "supi":
+		sub.Supi = value
+	case "key":
+		sub.Key = value
+	case "opc":
+		sub.Opc = value
+	case "op":
+		sub.Op = value
+	case "amf":
+		sub.Amf = value
+	case "sqn":
+		sub.Sqn = value
+	case "dnn":
+		sub.Dnn = value
+	case "routingindicator":
+		sub.RoutingIndicator = value
+	case "mcc":
+		sub.Hplmn.Mcc = value
+	case "mnc":
+		sub.Hplmn.Mnc = value
+	case "sst":
+		sst, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("sst: %w", err)
+		}
+		sub.Snssai.Sst = sst
+	case "sd":
+		sub.Snssai.Sd = value
+	case "imei":
+		sub.Imei = value
+	case "imeisv":
+		sub.Imeisv = value
+	case "integrity":
+		sub.Integrity = Integrity{}
+		for _, alg := range strings.Split(value, "|") {
+			switch strings.ToLower(strings.TrimSpace(alg)) {
+			case "nia0":
+				sub.Integrity.Nia0 = true
+			case "nia1":
+				sub.Integrity.Nia1 = true
+			case "nia2":
+				sub.Integrity.Nia2 = true
+			case "nia3":
+				sub.Integrity.Nia3 = true
+			default:
+				return fmt.Errorf("integrity: unknown algorithm %s", alg)
+			}
+		}
+	case "ciphering":
+		sub.Ciphering = Ciphering{}
+		for _, alg := range strings.Split(value, "|") {
+			switch strings.ToLower(strings.TrimSpace(alg)) {
+			case "nea0":
+				sub.Ciphering.Nea0 = true
+			case "nea1":
+				sub.Ciphering.Nea1 = true
+			case "nea2":
+				sub.Ciphering.Nea2 = true
+			case "nea3":
+				sub.Ciphering.Nea3 = true
+			default:
+				return fmt.Errorf("ciphering: unknown algorithm %s", alg)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown column %s", column)
+	}
+	return nil
+}
+
+// msinFromSupi extracts the MSIN from a SUPI in the imsi-<mcc><mnc><msin> format.
+func msinFromSupi(supi string, hplmn Hplmn) (string, error) {
+	imsi := strings.TrimPrefix(strings.TrimPrefix(supi, "imsi-"), "supi-")
+	prefix := hplmn.Mcc + hplmn.Mnc
+	if !strings.HasPrefix(imsi, prefix) {
+		return "", fmt.Errorf("%s does not belong to the home network %s", supi, prefix)
+	}
+	return strings.TrimPrefix(imsi, prefix), nil
+}
@@ -0,0 +1,245 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Validate checks every field of the configuration and reports all the invalid ones at once.
+func (config *Config) Validate() error {
+	v := validator{}
+
+	// gNodeB
+	validateGnodeb(&v, "gnodeb.", config.GNodeB)
+	gnbIds := make(map[string]int)
+	for i, gnb := range config.GNodeBs {
+		prefix := "gnodebs[" + strconv.Itoa(i) + "]."
+		validateGnodeb(&v, prefix, gnb)
+		if previous, ok := gnbIds[gnb.PlmnList.GnbId]; ok {
+			v.check(prefix+"plmnlist.gnbid", fmt.Errorf("%s is already used by gnodebs[%d]", gnb.PlmnList.GnbId, previous))
+		}
+		gnbIds[gnb.PlmnList.GnbId] = i
+	}
+
+	// UE
+	validateUe(&v, "ue.", config.Ue)
+
+	// AMF
+	validateAmf(&v, "amfif.", config.AMF)
+	for i, amf := range config.AMFs {
+		validateAmf(&v, "amfifs["+strconv.Itoa(i)+"].", amf)
+	}
+
+	// Subscribers
+	if config.Subscribers != "" {
+		_, err := LoadSubscribers(config.Subscribers, config.Ue)
+		v.check("subscribers", err)
+	}
+
+	// Logs
+	if config.Logs.Level < 0 || config.Logs.Level > 6 {
+		v.check("logs.level", fmt.Errorf("%d must lie between 0 and 6", config.Logs.Level))
+	}
+
+	return v.err()
+}
+
+func validateGnodeb(v *validator, prefix string, gnb GNodeB) {
+	v.check(prefix+"controlif.ip", validateIp(gnb.ControlIF.Ip))
+	v.check(prefix+"controlif.port", validatePort(gnb.ControlIF.Port))
+	v.check(prefix+"dataif.ip", validateIp(gnb.DataIF.Ip))
+	v.check(prefix+"dataif.port", validatePort(gnb.DataIF.Port))
+	v.check(prefix+"plmnlist.mcc", validateMcc(gnb.PlmnList.Mcc))
+	v.check(prefix+"plmnlist.mnc", validateMnc(gnb.PlmnList.Mnc))
+	v.check(prefix+"plmnlist.tac", validateHex(gnb.PlmnList.Tac, 6))
+	v.check(prefix+"plmnlist.gnbid", validateGnbId(gnb.PlmnList.GnbId, gnb.GetGnbIdLength()))
+	v.check(prefix+"slicesupportlist.sst", validateHex(gnb.SliceSupportList.Sst, 2))
+	v.check(prefix+"slicesupportlist.sd", validateSd(gnb.SliceSupportList.Sd))
+	for i, tac := range gnb.TacList {
+		v.check(prefix+"taclist["+strconv.Itoa(i)+"]", validateHex(tac, 6))
+	}
+	for i, plmn := range gnb.BroadcastPlmnList {
+		v.check(prefix+"broadcastplmnlist["+strconv.Itoa(i)+"].mcc", validateMcc(plmn.Mcc))
+		v.check(prefix+"broadcastplmnlist["+strconv.Itoa(i)+"].mnc", validateMnc(plmn.Mnc))
+	}
+	for i, slice := range gnb.SliceList {
+		v.check(prefix+"slicelist["+strconv.Itoa(i)+"].sst", validateHex(slice.Sst, 2))
+		v.check(prefix+"slicelist["+strconv.Itoa(i)+"].sd", validateSd(slice.Sd))
+	}
+	for i, amf := range gnb.AMFs {
+		validateAmf(v, prefix+"amfifs["+strconv.Itoa(i)+"].", amf)
+	}
+}
+
+func validateAmf(v *validator, prefix string, amf AMF) {
+	v.check(prefix+"ip", validateIp(amf.Ip))
+	v.check(prefix+"port", validatePort(amf.Port))
+}
+
+func validateUe(v *validator, prefix string, ue Ue) {
+	v.check(prefix+"msin", validateDigits(ue.Msin, 8, 10))
+	v.check(prefix+"key", validateHex(ue.Key, 32))
+	if ue.Opc != "" || ue.Op == "" {
+		v.check(prefix+"opc", validateHex(ue.Opc, 32))
+	}
+	if ue.Op != "" {
+		v.check(prefix+"op", validateHex(ue.Op, 32))
+	}
+	v.check(prefix+"amf", validateHex(ue.Amf, 4))
+	v.check(prefix+"sqn", validateSqn(ue.Sqn))
+	v.check(prefix+"dnn", validateNotEmpty(ue.Dnn))
+	v.check(prefix+"routingindicator", validateDigits(ue.RoutingIndicator, 0, 4))
+	v.check(prefix+"hplmn.mcc", validateMcc(ue.Hplmn.Mcc))
+	v.check(prefix+"hplmn.mnc", validateMnc(ue.Hplmn.Mnc))
+	v.check(prefix+"snssai.sst", validateSst(ue.Snssai.Sst))
+	v.check(prefix+"snssai.sd", validateSd(ue.Snssai.Sd))
+	if ue.Imei != "" {
+		v.check(prefix+"imei", validateDigits(ue.Imei, 15, 15))
+	}
+	if ue.Imeisv != "" {
+		v.check(prefix+"imeisv", validateDigits(ue.Imeisv, 16, 16))
+	}
+	switch ue.Suci.ProtectionScheme {
+	case 0:
+	case 1:
+		v.check(prefix+"suci.profilea.id", validateHomeNetworkPublicKeyId(ue.Suci.ProfileA.Id))
+		v.check(prefix+"suci.profilea.key", validateHex(ue.Suci.ProfileA.Key, 64))
+	case 2:
+		v.check(prefix+"suci.profileb.id", validateHomeNetworkPublicKeyId(ue.Suci.ProfileB.Id))
+		v.check(prefix+"suci.profileb.key", validateP256PublicKey(ue.Suci.ProfileB.Key))
+	default:
+		v.check(prefix+"suci.protectionscheme", fmt.Errorf("%d must be 0 (null scheme), 1 (ECIES Profile A) or 2 (ECIES Profile B)", ue.Suci.ProtectionScheme))
+	}
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(field string, err error) {
+	if err != nil {
+		v.errs = append(v.errs, fmt.Errorf("%s: %w", field, err))
+	}
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func validateNotEmpty(value string) error {
+	if value == "" {
+		return errors.New("is missing")
+	}
+	return nil
+}
+
+func validateIp(ip string) error {
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("%q is not a valid IP address", ip)
+	}
+	return nil
+}
+
+func validatePort(port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("%d is not a valid port", port)
+	}
+	return nil
+}
+
+func validateDigits(value string, minLen int, maxLen int) error {
+	if len(value) < minLen || len(value) > maxLen {
+		if minLen == maxLen {
+			return fmt.Errorf("%q must be %d digits long", value, minLen)
+		}
+		return fmt.Errorf("%q must be between %d and %d digits long", value, minLen, maxLen)
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("%q must only contain digits", value)
+		}
+	}
+	return nil
+}
+
+func validateMcc(mcc string) error {
+	return validateDigits(mcc, 3, 3)
+}
+
+func validateMnc(mnc string) error {
+	return validateDigits(mnc, 2, 3)
+}
+
+func validateHex(value string, length int) error {
+	if len(value) != length {
+		return fmt.Errorf("%q must be %d hexadecimal characters long", value, length)
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return fmt.Errorf("%q is not a valid hexadecimal string", value)
+	}
+	return nil
+}
+
+// gNB ID is between 22 and 32 bits long, TS 38.413 9.3.1.6
+func validateGnbId(gnbId string, bitLength int) error {
+	if len(gnbId) != 6 && len(gnbId) != 8 {
+		return fmt.Errorf("%q must be 6 or 8 hexadecimal characters long", gnbId)
+	}
+	if bitLength < 22 || bitLength > 32 {
+		return fmt.Errorf("length of %d bits must lie between 22 and 32", bitLength)
+	}
+	id, err := strconv.ParseUint(gnbId, 16, 32)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid hexadecimal string", gnbId)
+	}
+	if id>>bitLength != 0 {
+		return fmt.Errorf("%q does not fit in %d bits", gnbId, bitLength)
+	}
+	return nil
+}
+
+// SQN is 48 bits long, TS 33.102 6.3.2
+func validateSqn(sqn string) error {
+	if len(sqn) == 0 || len(sqn) > 12 || len(sqn)%2 != 0 {
+		return fmt.Errorf("%q must be an even number of hexadecimal characters, up to 12", sqn)
+	}
+	return validateHex(sqn, len(sqn))
+}
+
+// Home network public key identifier is one octet, TS 24.501 9.11.3.4
+func validateHomeNetworkPublicKeyId(id int) error {
+	if id < 0 || id > 255 {
+		return fmt.Errorf("%d must lie between 0 and 255", id)
+	}
+	return nil
+}
+
+// Profile B public key is either compressed or uncompressed, TS 33.501 C.3.4.2
+func validateP256PublicKey(key string) error {
+	if len(key) != 66 && len(key) != 130 {
+		return fmt.Errorf("%q must be 66 (compressed) or 130 (uncompressed) hexadecimal characters long", key)
+	}
+	return validateHex(key, len(key))
+}
+
+// SD is optional, but 24 bits long if present, TS 23.003 28.4.2
+func validateSd(sd string) error {
+	if sd == "" {
+		return nil
+	}
+	return validateHex(sd, 6)
+}
+
+func validateSst(sst int) error {
+	if sst < 0 || sst > 255 {
+		return errors.New(strconv.Itoa(sst) + " must lie between 0 and 255")
+	}
+	return nil
+}
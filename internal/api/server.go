@@ -0,0 +1,427 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/scenario"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions that can be triggered on UEs.
+const (
+	ActionRegister       = "register"
+	ActionDeregister     = "deregister"
+	ActionPduSession     = "pdu-session"
+	ActionRelease        = "release"
+	ActionHandover       = "handover"
+	ActionIdle           = "idle"
+	ActionServiceRequest = "service-request"
+	ActionTerminate      = "terminate"
+)
+
+// maximum time to hand over a procedure to a UE
+const sendTimeout = 5 * time.Second
+
+var mmStates = map[int]string{
+	ueCtx.MM5G_NULL:                 "MM5G_NULL",
+	ueCtx.MM5G_DEREGISTERED:         "MM5G_DEREGISTERED",
+	ueCtx.MM5G_REGISTERED_INITIATED: "MM5G_REGISTERED_INITIATED",
+	ueCtx.MM5G_REGISTERED:           "MM5G_REGISTERED",
+	ueCtx.MM5G_SERVICE_REQ_INIT:     "MM5G_SERVICE_REQ_INIT",
+	ueCtx.MM5G_DEREGISTERED_INIT:    "MM5G_DEREGISTERED_INIT",
+}
+
+var smStates = map[int]string{
+	ueCtx.SM5G_PDU_SESSION_INACTIVE:       "SM5G_PDU_SESSION_INACTIVE",
+	ueCtx.SM5G_PDU_SESSION_ACTIVE_PENDING: "SM5G_PDU_SESSION_ACTIVE_PENDING",
+	ueCtx.SM5G_PDU_SESSION_ACTIVE:         "SM5G_PDU_SESSION_ACTIVE",
+}
+
+var amfStates = map[int]string{
+	gnbCxt.Inactive: "inactive",
+	gnbCxt.Active:   "active",
+	gnbCxt.Overload: "overload",
+}
+
+// Server is the runtime control API of the tester, it lists gNodeBs and UEs, and triggers procedures on UEs.
+//
+//	GET  /gnbs                  gNodeBs and their AMFs
+//	GET  /ues                   UEs with their 5GMM state and PDU Sessions
+//	GET  /ues/{id}
+//	POST /ues/{id}/{action}     trigger an action on a UE
+//	POST /ues/{action}?ues=1-10,12
+//	                            trigger an action on a group of UEs, or on every UE when ues is not given
+//
+// Actions are register, deregister, pdu-session, release?pduSessionId=1, handover?gnb=1 and terminate.
+type Server struct {
+	gnbs   []*gnbCxt.GNBContext
+	numUes int // UE ids lie between 1 and numUes
+
+	mu  sync.RWMutex
+	ues map[int]*ueEntry
+}
+
+// Ue is the state of a UE, as returned by the API.
+type Ue struct {
+	Id          int          `json:"id"`
+	Msin        string       `json:"msin"`
+	Gnb         int          `json:"gnb"` // index of the gNodeB in /gnbs
+	StateMM     string       `json:"stateMM"`
+	PduSessions []PduSession `json:"pduSessions"`
+	Terminated  bool         `json:"terminated"`
+}
+
+// ueEntry is a UE known by the Server.
+type ueEntry struct {
+	mu          sync.Mutex // guards the state of the UE
+	ue          Ue
+	pduSessions map[uint8]PduSession
+
+	sendMu  sync.Mutex // guards channel, so that it is not closed during a send
+	channel chan procedures.UeTesterMessage
+}
+
+type PduSession struct {
+	Id      uint8  `json:"id"`
+	StateSM string `json:"stateSM"`
+	Ip      string `json:"ip,omitempty"`
+}
+
+type Gnb struct {
+	Index int    `json:"index"`
+	GnbId string `json:"gnbId"`
+	N2    string `json:"n2"`
+	N3    string `json:"n3"`
+	Amfs  []Amf  `json:"amfs"`
+}
+
+type Amf struct {
+	Name     string `json:"name"`
+	Ip       string `json:"ip"`
+	Port     int    `json:"port"`
+	State    string `json:"state"`
+	Capacity int64  `json:"capacity"`
+	Ues      int64  `json:"ues"`
+}
+
+// ActionResult lists the UEs an action was sent to, and the errors of the other UEs.
+type ActionResult struct {
+	Accepted []int          `json:"accepted"`
+	Errors   map[int]string `json:"errors,omitempty"`
+}
+
+func NewServer(gnbs []*gnbCxt.GNBContext, numUes int) *Server {
+	return &Server{gnbs: gnbs, numUes: numUes, ues: map[int]*ueEntry{}}
+}
+
+// Start serves the API on addr, eg: 127.0.0.1:8080.
+func (server *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to start control API on %s: %w", addr, err)
+	}
+	log.Info("[TESTER][API] Control API listening on http://", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, server); err != nil {
+			log.Error("[TESTER][API] Control API stopped: ", err)
+		}
+	}()
+	return nil
+}
+
+// AddUe makes a UE available in the API, procedures are sent to channel.
+func (server *Server) AddUe(ueId int, msin string, gnbIndex int, channel chan procedures.UeTesterMessage) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.ues[ueId] = &ueEntry{
+		ue:          Ue{Id: ueId, Msin: msin, Gnb: gnbIndex, StateMM: mmStates[ueCtx.MM5G_NULL]},
+		pduSessions: map[uint8]PduSession{},
+		channel:     channel,
+	}
+}
+
+// RemoveUe removes a UE from the API, once RemoveUe returns, its channel is no longer used.
+func (server *Server) RemoveUe(ueId int) {
+	server.mu.Lock()
+	ue, ok := server.ues[ueId]
+	delete(server.ues, ueId)
+	server.mu.Unlock()
+
+	if ok {
+		ue.sendMu.Lock()
+		ue.channel = nil
+		ue.sendMu.Unlock()
+	}
+}
+
+// UpdateUe records a state change sent by a UE.
+func (server *Server) UpdateUe(ueId int, msg scenario.ScenarioMessage) {
+	ue := server.getUe(ueId)
+	if ue == nil {
+		return
+	}
+
+	ue.mu.Lock()
+	defer ue.mu.Unlock()
+	ue.ue.StateMM = mmStates[msg.StateChange]
+	if msg.PduSessionId != 0 {
+		if msg.StateSM == ueCtx.SM5G_PDU_SESSION_INACTIVE {
+			delete(ue.pduSessions, msg.PduSessionId)
+		} else {
+			ue.pduSessions[msg.PduSessionId] = PduSession{Id: msg.PduSessionId, StateSM: smStates[msg.StateSM], Ip: msg.Ip}
+		}
+	} else if msg.StateChange == ueCtx.MM5G_NULL {
+		// the UE closed its channel
+		ue.ue.Terminated = true
+		ue.pduSessions = map[uint8]PduSession{}
+	}
+}
+
+func (server *Server) getUe(ueId int) *ueEntry {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return server.ues[ueId]
+}
+
+func (server *Server) getUes() []*ueEntry {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	ues := make([]*ueEntry, 0, len(server.ues))
+	for _, ue := range server.ues {
+		ues = append(ues, ue)
+	}
+	sort.Slice(ues, func(i, j int) bool { return ues[i].ue.Id < ues[j].ue.Id })
+	return ues
+}
+
+// snapshot returns a copy of the state of the UE, to be marshalled.
+func (ue *ueEntry) snapshot() Ue {
+	ue.mu.Lock()
+	defer ue.mu.Unlock()
+	pduSessions := make([]PduSession, 0, len(ue.pduSessions))
+	for _, pduSession := range ue.pduSessions {
+		pduSessions = append(pduSessions, pduSession)
+	}
+	sort.Slice(pduSessions, func(i, j int) bool { return pduSessions[i].Id < pduSessions[j].Id })
+	snapshot := ue.ue
+	snapshot.PduSessions = pduSessions
+	return snapshot
+}
+
+func (ue *ueEntry) send(msg procedures.UeTesterMessage) error {
+	ue.sendMu.Lock()
+	defer ue.sendMu.Unlock()
+	if ue.channel == nil || ue.snapshot().Terminated {
+		return fmt.Errorf("UE %d is terminated", ue.ue.Id)
+	}
+	select {
+	case ue.channel <- msg:
+		return nil
+	case <-time.After(sendTimeout):
+		return fmt.Errorf("UE %d did not accept the procedure within %s", ue.ue.Id, sendTimeout)
+	}
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(path) == 1 && path[0] == "gnbs":
+		writeJSON(w, http.StatusOK, server.listGnbs())
+
+	case r.Method == http.MethodGet && len(path) == 1 && path[0] == "ues":
+		ues := []Ue{}
+		for _, ue := range server.getUes() {
+			ues = append(ues, ue.snapshot())
+		}
+		writeJSON(w, http.StatusOK, ues)
+
+	case r.Method == http.MethodGet && len(path) == 2 && path[0] == "ues":
+		ueId, err := strconv.Atoi(path[1])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid UE id %q", path[1]))
+			return
+		}
+		ue := server.getUe(ueId)
+		if ue == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown UE %d", ueId))
+			return
+		}
+		writeJSON(w, http.StatusOK, ue.snapshot())
+
+	case r.Method == http.MethodPost && len(path) == 3 && path[0] == "ues":
+		ueId, err := strconv.Atoi(path[1])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid UE id %q", path[1]))
+			return
+		}
+		server.handleAction(w, r, path[2], []int{ueId})
+
+	case r.Method == http.MethodPost && len(path) == 2 && path[0] == "ues":
+		var ueIds []int
+		if group := r.URL.Query().Get("ues"); group != "" {
+			var err error
+			if ueIds, err = parseUeIds(group, server.numUes); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		} else {
+			for _, ue := range server.getUes() {
+				ueIds = append(ueIds, ue.ue.Id)
+			}
+		}
+		server.handleAction(w, r, path[1], ueIds)
+
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (server *Server) handleAction(w http.ResponseWriter, r *http.Request, action string, ueIds []int) {
+	msg, targetGnb, err := server.newMessage(action, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result := ActionResult{Accepted: []int{}, Errors: map[int]string{}}
+	for _, ueId := range ueIds {
+		ue := server.getUe(ueId)
+		if ue == nil {
+			result.Errors[ueId] = fmt.Sprintf("unknown UE %d", ueId)
+			continue
+		}
+		if err := ue.send(msg); err != nil {
+			result.Errors[ueId] = err.Error()
+			continue
+		}
+		if action == ActionHandover {
+			ue.mu.Lock()
+			ue.ue.Gnb = targetGnb
+			ue.mu.Unlock()
+		}
+		log.Info("[TESTER][API] Sent ", action, " to UE ", ueId)
+		result.Accepted = append(result.Accepted, ueId)
+	}
+
+	status := http.StatusAccepted
+	if len(result.Accepted) == 0 {
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, result)
+}
+
+func (server *Server) newMessage(action string, r *http.Request) (procedures.UeTesterMessage, int, error) {
+	query := r.URL.Query()
+	switch action {
+	case ActionRegister:
+		return procedures.UeTesterMessage{Type: procedures.Registration}, 0, nil
+	case ActionDeregister:
+		return procedures.UeTesterMessage{Type: procedures.Deregistration}, 0, nil
+	case ActionPduSession:
+		return procedures.UeTesterMessage{Type: procedures.NewPDUSession}, 0, nil
+	case ActionIdle:
+		return procedures.UeTesterMessage{Type: procedures.ConnectionRelease}, 0, nil
+	case ActionServiceRequest:
+		return procedures.UeTesterMessage{Type: procedures.ServiceRequest}, 0, nil
+	case ActionTerminate:
+		return procedures.UeTesterMessage{Type: procedures.Terminate}, 0, nil
+	case ActionRelease:
+		pduSessionId, err := strconv.Atoi(query.Get("pduSessionId"))
+		if err != nil || pduSessionId < 1 || pduSessionId > 16 {
+			return procedures.UeTesterMessage{}, 0, errors.New("release requires a pduSessionId between 1 and 16")
+		}
+		return procedures.UeTesterMessage{Type: procedures.DestroyPDUSession, Param: uint8(pduSessionId)}, 0, nil
+	case ActionHandover:
+		gnbIndex, err := strconv.Atoi(query.Get("gnb"))
+		if err != nil || gnbIndex < 0 || gnbIndex >= len(server.gnbs) {
+			return procedures.UeTesterMessage{}, 0, fmt.Errorf("handover requires the index of the target gnb, between 0 and %d", len(server.gnbs)-1)
+		}
+		return procedures.UeTesterMessage{Type: procedures.Handover, GnbChan: server.gnbs[gnbIndex].GetInboundChannel()}, gnbIndex, nil
+	default:
+		return procedures.UeTesterMessage{}, 0, fmt.Errorf("unknown action %q", action)
+	}
+}
+
+func (server *Server) listGnbs() []Gnb {
+	gnbs := make([]Gnb, 0, len(server.gnbs))
+	for i, gnb := range server.gnbs {
+		amfs := []Amf{}
+		for _, amf := range gnb.GetAmfs() {
+			amfs = append(amfs, Amf{
+				Name:     amf.GetAmfName(),
+				Ip:       amf.GetAmfIp(),
+				Port:     amf.GetAmfPort(),
+				State:    amfStates[amf.GetState()],
+				Capacity: amf.GetAmfCapacity(),
+				Ues:      amf.GetNumUes(),
+			})
+		}
+		gnbs = append(gnbs, Gnb{
+			Index: i,
+			GnbId: gnb.GetGnbId(),
+			N2:    net.JoinHostPort(gnb.GetGnbIp(), strconv.Itoa(gnb.GetGnbPort())),
+			N3:    net.JoinHostPort(gnb.GetGnbIpByData(), strconv.Itoa(gnb.GetGnbPortByData())),
+			Amfs:  amfs,
+		})
+	}
+	return gnbs
+}
+
+// parseUeIds parses a list of UE ids between 1 and numUes, eg: 1-10,12. A UE listed twice is kept once.
+func parseUeIds(group string, numUes int) ([]int, error) {
+	var ueIds []int
+	listed := make(map[int]bool)
+	for _, item := range strings.Split(group, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UE id %q", item)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("invalid range of UEs %q", item)
+			}
+		}
+		// checked before the ids are listed, so that a large range is not expanded
+		if from < 1 || to > numUes {
+			return nil, fmt.Errorf("UEs %q out of range, UE ids lie between 1 and %d", item, numUes)
+		}
+		for ueId := from; ueId <= to; ueId++ {
+			if !listed[ueId] {
+				listed[ueId] = true
+				ueIds = append(ueIds, ueId)
+			}
+		}
+	}
+	return ueIds, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error("[TESTER][API] Unable to write response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,61 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package api
+
+import (
+	"encoding/json"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/scenario"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlApi(t *testing.T) {
+	server := NewServer(nil, 2)
+	channel := make(chan procedures.UeTesterMessage, 1)
+	server.AddUe(1, "0000000001", 0, channel)
+
+	request := func(method string, url string, body interface{}) int {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(method, url, nil))
+		if body != nil {
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), body))
+		}
+		return recorder.Code
+	}
+
+	result := ActionResult{}
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/ues/register?ues=1-2", &result))
+	assert.Equal(t, []int{1}, result.Accepted)
+	assert.Contains(t, result.Errors[2], "unknown UE 2")
+	assert.Equal(t, procedures.Registration, (<-channel).Type)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/ues/register?ues=1-1000000000", nil))
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/ues/register?ues=0-1", nil))
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/ues/register?ues=1,1-1", &result))
+	assert.Equal(t, []int{1}, result.Accepted)
+	assert.Equal(t, procedures.Registration, (<-channel).Type)
+
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/ues/1/release", nil))
+	assert.Equal(t, http.StatusAccepted, request(http.MethodPost, "/ues/1/release?pduSessionId=2", nil))
+	msg := <-channel
+	assert.Equal(t, procedures.DestroyPDUSession, msg.Type)
+	assert.Equal(t, uint8(2), msg.Param)
+
+	server.UpdateUe(1, scenario.ScenarioMessage{StateChange: ueCtx.MM5G_REGISTERED})
+	server.UpdateUe(1, scenario.ScenarioMessage{StateChange: ueCtx.MM5G_REGISTERED, PduSessionId: 1, StateSM: ueCtx.SM5G_PDU_SESSION_ACTIVE, Ip: "10.45.0.2"})
+	ue := Ue{}
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/ues/1", &ue))
+	assert.Equal(t, "MM5G_REGISTERED", ue.StateMM)
+	assert.Equal(t, []PduSession{{Id: 1, StateSM: "SM5G_PDU_SESSION_ACTIVE", Ip: "10.45.0.2"}}, ue.PduSessions)
+
+	// the UE closed its channel
+	server.UpdateUe(1, scenario.ScenarioMessage{})
+	assert.Equal(t, http.StatusConflict, request(http.MethodPost, "/ues/1/deregister", nil))
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/ues/3", nil))
+}
@@ -0,0 +1,168 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/free5gc/nas/nasMessage"
+)
+
+// ECIES parameters of Profile A and Profile B, TS 33.501 C.3.4
+const (
+	eciesEncKeyLen = 16
+	eciesIcbLen    = 16
+	eciesMacKeyLen = 32
+	eciesMacLen    = 8
+)
+
+// ConcealSchemeInput returns the scheme output of the SUCI, the scheme input (the MSIN in BCD) concealed for the home
+// network public key with ECIES Profile A or Profile B, TS 33.501 C.3.2.
+func ConcealSchemeInput(protectionScheme uint8, homeNetworkPublicKey []byte, schemeInput []byte) ([]byte, error) {
+	curve, err := eciesCurve(protectionScheme)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := eciesPublicKey(protectionScheme, homeNetworkPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid home network public key: %w", err)
+	}
+	sharedKey, err := ephemeralKey.ECDH(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profile B uses the compressed ephemeral public key
+	ephemeralPublicKey := ephemeralKey.PublicKey().Bytes()
+	if protectionScheme == uint8(nasMessage.ProtectionSchemeECIESProfileB) {
+		ephemeralPublicKey = compressP256(ephemeralPublicKey)
+	}
+
+	encKey, icb, macKey := eciesKeys(sharedKey, ephemeralPublicKey)
+	cipherText, err := aesCtr(encKey, icb, schemeInput)
+	if err != nil {
+		return nil, err
+	}
+
+	schemeOutput := append([]byte{}, ephemeralPublicKey...)
+	schemeOutput = append(schemeOutput, cipherText...)
+	return append(schemeOutput, eciesMac(macKey, cipherText)...), nil
+}
+
+// DeconcealSchemeOutput returns the scheme input of a SUCI scheme output concealed with ECIES Profile A or Profile B,
+// using the home network private key, TS 33.501 C.3.3.
+func DeconcealSchemeOutput(protectionScheme uint8, homeNetworkPrivateKey []byte, schemeOutput []byte) ([]byte, error) {
+	curve, err := eciesCurve(protectionScheme)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := curve.NewPrivateKey(homeNetworkPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid home network private key: %w", err)
+	}
+
+	ephemeralPublicKeyLen := 32
+	if protectionScheme == uint8(nasMessage.ProtectionSchemeECIESProfileB) {
+		ephemeralPublicKeyLen = 33
+	}
+	if len(schemeOutput) <= ephemeralPublicKeyLen+eciesMacLen {
+		return nil, errors.New("scheme output is too short")
+	}
+	ephemeralPublicKey := schemeOutput[:ephemeralPublicKeyLen]
+	cipherText := schemeOutput[ephemeralPublicKeyLen : len(schemeOutput)-eciesMacLen]
+	mac := schemeOutput[len(schemeOutput)-eciesMacLen:]
+
+	publicKey, err := eciesPublicKey(protectionScheme, ephemeralPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ephemeral public key: %w", err)
+	}
+	sharedKey, err := privateKey.ECDH(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encKey, icb, macKey := eciesKeys(sharedKey, ephemeralPublicKey)
+	if !hmac.Equal(mac, eciesMac(macKey, cipherText)) {
+		return nil, errors.New("MAC of the scheme output does not match")
+	}
+	return aesCtr(encKey, icb, cipherText)
+}
+
+func eciesCurve(protectionScheme uint8) (ecdh.Curve, error) {
+	switch int(protectionScheme) {
+	case nasMessage.ProtectionSchemeECIESProfileA:
+		return ecdh.X25519(), nil
+	case nasMessage.ProtectionSchemeECIESProfileB:
+		return ecdh.P256(), nil
+	default:
+		return nil, fmt.Errorf("protection scheme %d is not an ECIES profile", protectionScheme)
+	}
+}
+
+// eciesPublicKey parses a public key of the profile, compressed or not for Profile B.
+func eciesPublicKey(protectionScheme uint8, key []byte) (*ecdh.PublicKey, error) {
+	curve, err := eciesCurve(protectionScheme)
+	if err != nil {
+		return nil, err
+	}
+	if protectionScheme == uint8(nasMessage.ProtectionSchemeECIESProfileB) && len(key) == 33 {
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), key)
+		if x == nil {
+			return nil, errors.New("not a point of secp256r1")
+		}
+		key = elliptic.Marshal(elliptic.P256(), x, y)
+	}
+	return curve.NewPublicKey(key)
+}
+
+// compressP256 returns the compressed form of an uncompressed secp256r1 public key, SEC 1 2.3.3.
+func compressP256(key []byte) []byte {
+	return append([]byte{0x02 | key[64]&0x01}, key[1:33]...)
+}
+
+// eciesKeys derives the encryption key, ICB and MAC key from the shared key with the ANSI-X9.63 KDF, using the
+// ephemeral public key as SharedInfo1, TS 33.501 C.3.4.
+func eciesKeys(sharedKey []byte, ephemeralPublicKey []byte) (encKey []byte, icb []byte, macKey []byte) {
+	var keys []byte
+	counter := make([]byte, 4)
+	for i := uint32(1); len(keys) < eciesEncKeyLen+eciesIcbLen+eciesMacKeyLen; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		hash := sha256.New()
+		hash.Write(sharedKey)
+		hash.Write(counter)
+		hash.Write(ephemeralPublicKey)
+		keys = hash.Sum(keys)
+	}
+	return keys[:eciesEncKeyLen], keys[eciesEncKeyLen : eciesEncKeyLen+eciesIcbLen], keys[eciesEncKeyLen+eciesIcbLen : eciesEncKeyLen+eciesIcbLen+eciesMacKeyLen]
+}
+
+func aesCtr(key []byte, icb []byte, text []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(text))
+	cipher.NewCTR(block, icb).XORKeyStream(out, text)
+	return out, nil
+}
+
+func eciesMac(macKey []byte, cipherText []byte) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(cipherText)
+	return mac.Sum(nil)[:eciesMacLen]
+}
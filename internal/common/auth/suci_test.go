@@ -0,0 +1,69 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package auth
+
+import (
+	"crypto/ecdh"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test vectors of TS 33.501 C.4.3 (Profile A) and C.4.4 (Profile B)
+var suciTestVectors = []struct {
+	protectionScheme uint8
+	curve            ecdh.Curve
+	privateKey       string
+	schemeOutput     string
+}{
+	{1, ecdh.X25519(), "c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d",
+		"b2e92f836055a255837debf850b528997ce0201cb82adfe4be1f587d07d8457dcb02352410cddd9e730ef3fa87"},
+	{2, ecdh.P256(), "f1ab1074477ebcc7f554ea1c5fc368b1616730155e0041ac447d6301975fecda",
+		"039aab8376597021e855679a9778ea0b67396e68c66df32c0f41e9acca2da9b9d146a33fc2716ac7dae96aa30a4d"},
+}
+
+var suciTestSchemeInput = []byte{0x00, 0x01, 0x20, 0x80, 0xf6}
+
+func TestDeconcealSchemeOutput(t *testing.T) {
+	for _, vector := range suciTestVectors {
+		privateKey, _ := hex.DecodeString(vector.privateKey)
+		schemeOutput, _ := hex.DecodeString(vector.schemeOutput)
+
+		schemeInput, err := DeconcealSchemeOutput(vector.protectionScheme, privateKey, schemeOutput)
+		assert.NoError(t, err)
+		assert.Equal(t, suciTestSchemeInput, schemeInput)
+
+		schemeOutput[len(schemeOutput)-1] ^= 0x01
+		_, err = DeconcealSchemeOutput(vector.protectionScheme, privateKey, schemeOutput)
+		assert.Error(t, err)
+	}
+}
+
+func TestConcealSchemeInput(t *testing.T) {
+	for _, vector := range suciTestVectors {
+		privateKeyBytes, _ := hex.DecodeString(vector.privateKey)
+		privateKey, err := vector.curve.NewPrivateKey(privateKeyBytes)
+		assert.NoError(t, err)
+
+		publicKey := privateKey.PublicKey().Bytes()
+		publicKeys := [][]byte{publicKey}
+		if vector.protectionScheme == 2 {
+			publicKeys = append(publicKeys, compressP256(publicKey))
+		}
+		for _, publicKey := range publicKeys {
+			schemeOutput, err := ConcealSchemeInput(vector.protectionScheme, publicKey, suciTestSchemeInput)
+			assert.NoError(t, err)
+			assert.Len(t, schemeOutput, len(vector.schemeOutput)/2)
+
+			schemeInput, err := DeconcealSchemeOutput(vector.protectionScheme, privateKeyBytes, schemeOutput)
+			assert.NoError(t, err)
+			assert.Equal(t, suciTestSchemeInput, schemeInput)
+		}
+	}
+
+	_, err := ConcealSchemeInput(0, nil, suciTestSchemeInput)
+	assert.Error(t, err)
+}
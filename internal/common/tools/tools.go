@@ -12,6 +12,9 @@ import (
 	"my5G-RANTester/internal/control_test_engine/procedures"
 	"my5G-RANTester/internal/control_test_engine/ue"
 	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/scenario"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/report"
 	"net"
 	"strconv"
 	"sync"
@@ -22,23 +25,79 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func CreateGnbs(count int, cfg config.Config, wg *sync.WaitGroup) map[string]*gnbCxt.GNBContext {
-	gnbs := make(map[string]*gnbCxt.GNBContext)
+// CreateGnbs starts count gNodeBs.
+// When the gnodebs list is given in the configuration, its first count gNodeBs are used.
+// Otherwise, gNodeBs are derived from the gnodeb section, with sequential IPs on both N2 and N3, eg:
+// gnb[0].n2_ip = 192.168.2.10, gnb[0].n3_ip = 192.168.3.10
+// gnb[1].n2_ip = 192.168.2.11, gnb[1].n3_ip = 192.168.3.11
+// ...
+func CreateGnbs(count int, cfg config.Config, wg *sync.WaitGroup) []*gnbCxt.GNBContext {
+	gnbs := make([]*gnbCxt.GNBContext, 0, count)
+	for _, gnbCfg := range gnodebsConfig(count, cfg) {
+		cfg.GNodeB = gnbCfg
+		gnbs = append(gnbs, gnb.InitGnb(cfg, wg))
+		wg.Add(1)
+	}
+	return gnbs
+}
+
+// Shutdown stops the run and drains it: the UEs release their PDU Sessions and deregister, then the gNodeBs request
+// the release of the UE contexts left, all within the drain timeout. The UEs which did not detach cleanly are logged.
+func Shutdown(ueWg *sync.WaitGroup, gnbs []*gnbCxt.GNBContext) {
+	deadline := time.Now().Add(lifecycle.DrainTimeout())
+	lifecycle.Stop()
+
+	if ueWg != nil {
+		detached := make(chan struct{})
+		go func() {
+			ueWg.Wait()
+			close(detached)
+		}()
+		select {
+		case <-detached:
+		case <-time.After(time.Until(deadline)):
+			log.Warn("[TESTER] Some UEs did not detach before the drain timeout")
+		}
+	}
+
+	gnbWg := sync.WaitGroup{}
+	for _, gnbCtx := range gnbs {
+		gnbWg.Add(1)
+		go func(gnbCtx *gnbCxt.GNBContext) {
+			defer gnbWg.Done()
+			gnb.Shutdown(gnbCtx, deadline)
+		}(gnbCtx)
+	}
+	gnbWg.Wait()
+
+	failures := report.DetachFailures()
+	if len(failures) == 0 {
+		return
+	}
+	log.Warn("[TESTER] ", len(failures), " UE(s) did not detach cleanly:")
+	for _, failure := range failures {
+		log.Warn("[TESTER] UE ", failure.Msin, ": ", failure.Reason)
+	}
+}
+
+func gnodebsConfig(count int, cfg config.Config) []config.GNodeB {
+	if len(cfg.GNodeBs) > 0 {
+		if count > len(cfg.GNodeBs) {
+			log.Fatal("[GNB][CONFIG] ", count, " gNodeBs are required, but only ", len(cfg.GNodeBs), " are defined in gnodebs")
+		}
+		return cfg.GNodeBs[:count]
+	}
+
+	gnbCfgs := make([]config.GNodeB, 0, count)
 	var err error
-	// Each gNB have their own IP address on both N2 and N3
-	// TODO: Limitation for now, these IPs must be sequential, eg:
-	// gnb[0].n2_ip = 192.168.2.10, gnb[0].n3_ip = 192.168.3.10
-	// gnb[1].n2_ip = 192.168.2.11, gnb[1].n3_ip = 192.168.3.11
-	// ...
 	n2Ip := cfg.GNodeB.ControlIF.Ip
 	n3Ip := cfg.GNodeB.DataIF.Ip
 	for i := 1; i <= count; i++ {
-		cfg.GNodeB.PlmnList.GnbId = gnbIdGenerator(i)
-		cfg.GNodeB.ControlIF.Ip = n2Ip
-		cfg.GNodeB.DataIF.Ip = n3Ip
-
-		gnbs[cfg.GNodeB.PlmnList.GnbId] = gnb.InitGnb(cfg, wg)
-		wg.Add(1)
+		gnbCfg := cfg.GNodeB
+		gnbCfg.PlmnList.GnbId = gnbIdGenerator(i)
+		gnbCfg.ControlIF.Ip = n2Ip
+		gnbCfg.DataIF.Ip = n3Ip
+		gnbCfgs = append(gnbCfgs, gnbCfg)
 
 		// TODO: We could find the interfaces where N2/N3 are
 		// and check that the generated IPs, still belong to the interfaces' subnet
@@ -50,9 +109,8 @@ func CreateGnbs(count int, cfg config.Config, wg *sync.WaitGroup) map[string]*gn
 		if err != nil {
 			log.Fatal("[GNB][CONFIG] Error while allocating ip for N3: " + err.Error())
 		}
-
 	}
-	return gnbs
+	return gnbCfgs
 }
 
 func IncrementIP(origIP, cidr string) (string, error) {
@@ -101,31 +159,34 @@ func Contains(s []string, str string) bool {
 
 type UESimulationConfig struct {
 	UeId                     int
-	Gnbs                     map[string]*gnbCxt.GNBContext
+	Gnbs                     []*gnbCxt.GNBContext
 	Cfg                      config.Config
 	ScenarioChan             chan procedures.UeTesterMessage
 	TimeBeforeDeregistration int
 	TimeBeforeHandover       int
 	NumPduSessions           int
+	// Subscribers, when not empty, holds the profile of each UE, UeId n using Subscribers[n-1]
+	Subscribers []config.Ue
+	// OnStateChange, when set, is called on every state change of a UE
+	OnStateChange func(ueId int, msg scenario.ScenarioMessage)
 }
 
 func SimulateSingleUE(simConfig UESimulationConfig, wg *sync.WaitGroup) {
 	numGnb := len(simConfig.Gnbs)
-	ueCfg := simConfig.Cfg
-	ueCfg.Ue.Msin = IncrementMsin(simConfig.UeId, simConfig.Cfg.Ue.Msin)
+	ueCfg := UeConfig(simConfig.UeId, simConfig.Cfg, simConfig.Subscribers)
 	log.Info("[TESTER] TESTING REGISTRATION USING IMSI ", ueCfg.Ue.Msin, " UE")
 
-	ueCfg.GNodeB.PlmnList.GnbId = gnbIdGenerator(simConfig.UeId%numGnb + 1)
+	gnb := simConfig.Gnbs[simConfig.UeId%numGnb]
+	ueCfg.GNodeB.PlmnList.GnbId = gnb.GetGnbId()
 
 	// Launch a coroutine to handle UE's individual scenario
+	wg.Add(1)
 	go func(scenarioChan chan procedures.UeTesterMessage, ueId int) {
-		wg.Add(1)
-
 		ueRx := make(chan procedures.UeTesterMessage)
 
 		// Create a new UE coroutine
 		// ue.NewUE returns context of the new UE
-		ueTx := ue.NewUE(ueCfg, uint8(ueId), ueRx, simConfig.Gnbs[ueCfg.GNodeB.PlmnList.GnbId], wg)
+		ueTx := ue.NewUE(ueCfg, uint8(ueId), ueRx, gnb, wg)
 
 		// We tell the UE to perform a registration
 		ueRx <- procedures.UeTesterMessage{Type: procedures.Registration}
@@ -150,7 +211,7 @@ func SimulateSingleUE(simConfig UESimulationConfig, wg *sync.WaitGroup) {
 				}
 			case <-handoverChannel:
 				if ueRx != nil {
-					ueRx <- procedures.UeTesterMessage{Type: procedures.Handover, GnbChan: simConfig.Gnbs[gnbIdGenerator((ueId+1)%numGnb+1)].GetInboundChannel()}
+					ueRx <- procedures.UeTesterMessage{Type: procedures.Handover, GnbChan: simConfig.Gnbs[(ueId+1)%numGnb].GetInboundChannel()}
 				}
 			case msg := <-scenarioChan:
 				if ueRx != nil {
@@ -160,6 +221,13 @@ func SimulateSingleUE(simConfig UESimulationConfig, wg *sync.WaitGroup) {
 					}
 				}
 			case msg := <-ueTx:
+				if simConfig.OnStateChange != nil {
+					simConfig.OnStateChange(ueId, msg)
+				}
+				if msg.PduSessionId != 0 {
+					// PDU Session changes are not used by this scenario
+					break
+				}
 				log.Info("[UE] Switched from state ", state, " to state ", msg.StateChange)
 				switch msg.StateChange {
 				case ueCtx.MM5G_REGISTERED:
@@ -177,6 +245,26 @@ func SimulateSingleUE(simConfig UESimulationConfig, wg *sync.WaitGroup) {
 	}(simConfig.ScenarioChan, simConfig.UeId)
 }
 
+// UeConfig returns the configuration of the UE ueId, using Subscribers[ueId-1] when subscribers are given,
+// or else the ue section of cfg with an incremented MSIN.
+func UeConfig(ueId int, cfg config.Config, subscribers []config.Ue) config.Config {
+	ueCfg := cfg
+	if len(subscribers) > 0 {
+		ueCfg.Ue = subscribers[ueId-1]
+		ueCfg.Ue.TunnelEnabled = cfg.Ue.TunnelEnabled
+	} else {
+		ueCfg.Ue.Msin = IncrementMsin(ueId, cfg.Ue.Msin)
+		// the serial numbers of the device identities are incremented, their TAC, check or SVN digits are kept
+		if cfg.Ue.Imei != "" {
+			ueCfg.Ue.Imei = IncrementMsin(ueId, cfg.Ue.Imei[:14]) + cfg.Ue.Imei[14:]
+		}
+		if cfg.Ue.Imeisv != "" {
+			ueCfg.Ue.Imeisv = IncrementMsin(ueId, cfg.Ue.Imeisv[:14]) + cfg.Ue.Imeisv[14:]
+		}
+	}
+	return ueCfg
+}
+
 func IncrementMsin(i int, msin string) string {
 
 	msin_int, err := strconv.Atoi(msin)
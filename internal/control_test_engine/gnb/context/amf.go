@@ -5,6 +5,9 @@
 package context
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/ishidawataru/sctp"
 )
 
@@ -18,6 +21,7 @@ type GNBAmf struct {
 	amfPort             int            // AMF port
 	amfId               int64          // AMF id
 	tnla                TNLAssociation // AMF sctp associations
+	tnlaMu              sync.Mutex     // guards the SCTP association of tnla, replaced on reconnection
 	relativeAmfCapacity int64          // AMF capacity
 	state               int
 	name                string // amf name.
@@ -28,14 +32,27 @@ type GNBAmf struct {
 	slices              *SliceSupported
 	lenSlice            int
 	lenPlmn             int
+	guamis              []Guami      // served GUAMIs
+	numUes              atomic.Int64 // UE contexts of the gNB served by the AMF
+	ngSetupResponses    atomic.Int64
+	ngSetupFailures     atomic.Int64
 	// TODO implement the other fields of the AMF Context
 }
 
+// Guami identifies an AMF, TS 23.003 2.10.1
+type Guami struct {
+	Plmn     [3]uint8 // mcc and mnc in octets
+	RegionId uint8
+	SetId    uint16 // 10 bits
+	Pointer  uint8  // 6 bits
+}
+
 type TNLAssociation struct {
 	sctpConn         *sctp.SCTPConn
 	tnlaWeightFactor int64
 	usage            bool
 	streams          uint16
+	lost             chan struct{} // closed once the association is lost
 }
 
 type SliceSupported struct {
@@ -171,6 +188,36 @@ func (amf *GNBAmf) AddedSlice(sst string, sd string) {
 	amf.lenSlice++
 }
 
+// ClearServedInformation forgets the PLMNs, slices and GUAMIs served by the AMF, before a new NG Setup Response.
+func (amf *GNBAmf) ClearServedInformation() {
+	amf.plmns = nil
+	amf.lenPlmn = 0
+	amf.slices = nil
+	amf.lenSlice = 0
+	amf.guamis = nil
+}
+
+func (amf *GNBAmf) AddServedGuami(guami Guami) {
+	amf.guamis = append(amf.guamis, guami)
+}
+
+func (amf *GNBAmf) GetServedGuamis() []Guami {
+	return amf.guamis
+}
+
+func (amf *GNBAmf) ServesGuami(guami Guami) bool {
+	for _, served := range amf.guamis {
+		if served == guami {
+			return true
+		}
+	}
+	return false
+}
+
+func (amf *GNBAmf) GetNumUes() int64 {
+	return amf.numUes.Load()
+}
+
 func (amf *GNBAmf) getTNLAs() TNLAssociation {
 	return amf.tnla
 }
@@ -192,11 +239,52 @@ func (amf *GNBAmf) GetState() int {
 }
 
 func (amf *GNBAmf) GetSCTPConn() *sctp.SCTPConn {
+	amf.tnlaMu.Lock()
+	defer amf.tnlaMu.Unlock()
 	return amf.tnla.sctpConn
 }
 
 func (amf *GNBAmf) SetSCTPConn(conn *sctp.SCTPConn) {
+	amf.tnlaMu.Lock()
+	defer amf.tnlaMu.Unlock()
 	amf.tnla.sctpConn = conn
+	if conn != nil {
+		amf.tnla.lost = make(chan struct{})
+	}
+}
+
+// AssociationLost returns a channel closed once the current SCTP association with the AMF is lost.
+func (amf *GNBAmf) AssociationLost() <-chan struct{} {
+	amf.tnlaMu.Lock()
+	defer amf.tnlaMu.Unlock()
+	return amf.tnla.lost
+}
+
+// SetAssociationLost records the loss of the SCTP association conn, unless it was already replaced.
+func (amf *GNBAmf) SetAssociationLost(conn *sctp.SCTPConn) {
+	amf.tnlaMu.Lock()
+	defer amf.tnlaMu.Unlock()
+	if amf.tnla.sctpConn != conn || amf.tnla.lost == nil {
+		return
+	}
+	select {
+	case <-amf.tnla.lost:
+	default:
+		close(amf.tnla.lost)
+	}
+}
+
+func (amf *GNBAmf) IncNgSetupResponses() {
+	amf.ngSetupResponses.Add(1)
+}
+
+func (amf *GNBAmf) IncNgSetupFailures() {
+	amf.ngSetupFailures.Add(1)
+}
+
+// GetNgSetupOutcomes returns the number of NG Setup Responses and Failures received from the AMF.
+func (amf *GNBAmf) GetNgSetupOutcomes() (int64, int64) {
+	return amf.ngSetupResponses.Load(), amf.ngSetupFailures.Load()
 }
 
 func (amf *GNBAmf) setTNLAWeight(weight int64) {
@@ -5,8 +5,14 @@
 package context
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"my5G-RANTester/internal/events"
+	"my5G-RANTester/internal/monitoring"
+	"my5G-RANTester/internal/report"
+	"sort"
+	"strconv"
 	"sync"
 
 	"github.com/ishidawataru/sctp"
@@ -20,11 +26,16 @@ type GNBContext struct {
 	uePool         sync.Map    // map[in64]*GNBUe, UeRanNgapId as key
 	amfPool        sync.Map    // map[int64]*GNBAmf, AmfId as key
 	teidPool       sync.Map    // map[uint32]*GNBUe, downlinkTeid as key
+	idleUePool     sync.Map    // map[string]chan UEMessage, 5G-S-TMSI of the CM-IDLE UEs as key
 	sliceInfo      Slice
-	idUeGenerator  int64  // ran UE id.
-	idAmfGenerator int64  // ran amf id
-	teidGenerator  uint32 // ran UE downlink Teid
-	ueIpGenerator  uint8  // ran ue ip.
+	slices         []Slice // additional supported slices
+	idUeGenerator  int64   // ran UE id.
+	idAmfGenerator int64   // ran amf id
+	teidGenerator  uint32  // ran UE downlink Teid
+	ueIpGenerator  uint8   // ran ue ip.
+	amfSelection   sync.Mutex
+	terminate      sync.Once
+	terminated     chan struct{} // closed once the gnb is terminated
 }
 
 type DataInfo struct {
@@ -41,11 +52,19 @@ type Slice struct {
 	sst string
 }
 
+type Plmn struct {
+	mcc string
+	mnc string
+}
+
 type ControlInfo struct {
 	mcc            string
 	mnc            string
 	tac            string
 	gnbId          string
+	gnbIdLength    int      // gnb id length in bits
+	tacs           []string // additional supported TACs
+	plmns          []Plmn   // additional broadcast PLMNs
 	gnbIp          string
 	gnbPort        int
 	inboundChannel chan UEMessage
@@ -57,6 +76,7 @@ func (gnb *GNBContext) NewRanGnbContext(gnbId, mcc, mnc, tac, sst, sd, ip, ipDat
 	gnb.controlInfo.mnc = mnc
 	gnb.controlInfo.tac = tac
 	gnb.controlInfo.gnbId = gnbId
+	gnb.controlInfo.gnbIdLength = 4 * len(gnbId)
 	gnb.controlInfo.inboundChannel = make(chan UEMessage, 1)
 	gnb.sliceInfo.sd = sd
 	gnb.sliceInfo.sst = sst
@@ -72,9 +92,26 @@ func (gnb *GNBContext) NewRanGnbContext(gnbId, mcc, mnc, tac, sst, sd, ip, ipDat
 	gnb.dataInfo.upfIp = ""
 	gnb.dataInfo.gnbIp = ipData
 	gnb.dataInfo.gnbPort = portData
+	gnb.terminated = make(chan struct{})
+}
+
+func (gnb *GNBContext) SetGnbIdLength(bitLength int) {
+	gnb.controlInfo.gnbIdLength = bitLength
 }
 
-func (gnb *GNBContext) NewGnBUe(gnbTx chan UEMessage, gnbRx chan UEMessage, msin string) *GNBUe {
+func (gnb *GNBContext) AddSupportedTac(tac string) {
+	gnb.controlInfo.tacs = append(gnb.controlInfo.tacs, tac)
+}
+
+func (gnb *GNBContext) AddBroadcastPlmn(mcc, mnc string) {
+	gnb.controlInfo.plmns = append(gnb.controlInfo.plmns, Plmn{mcc: mcc, mnc: mnc})
+}
+
+func (gnb *GNBContext) AddSupportedSlice(sst, sd string) {
+	gnb.slices = append(gnb.slices, Slice{sst: sst, sd: sd})
+}
+
+func (gnb *GNBContext) NewGnBUe(gnbTx chan UEMessage, gnbRx chan UEMessage, msin string, guami *Guami) *GNBUe {
 
 	// TODO if necessary add more information for UE.
 	// TODO implement mutex
@@ -99,12 +136,17 @@ func (gnb *GNBContext) NewGnBUe(gnbTx chan UEMessage, gnbRx chan UEMessage, msin
 	// store UE in the UE Pool of GNB.
 	gnb.uePool.Store(ranId, ue)
 
-	// select AMF with Capacity is more than 0.
-	amf := gnb.selectAmFByActive()
+	// select the AMF already serving the UE, or else the least loaded AMF.
+	amf := gnb.selectAmf(guami)
 	if amf == nil {
 		log.Error("No AMF available for this UE")
 		return nil
 	}
+	log.Info("[GNB] Selected AMF ", amf.GetAmfName(), " (", amf.GetAmfIp(), ":", amf.GetAmfPort(), ") for UE ", msin)
+	report.SetServingNodes(msin, gnb.GetGnbId(), fmt.Sprintf("%s:%d", amf.GetAmfIp(), amf.GetAmfPort()))
+	if conn := amf.GetSCTPConn(); conn != nil && events.Enabled() {
+		events.Emit(events.Event{Type: events.UeContext, Msin: msin, Gnb: monitoring.N2Addr(conn), Ngap: &events.NgapInfo{RanUeNgapId: ranId}})
+	}
 
 	// set amfId and SCTP association for UE.
 	ue.SetAmfId(amf.GetAmfId())
@@ -127,7 +169,9 @@ func (gnb *GNBContext) GetN3GnbIp() string {
 }
 
 func (gnb *GNBContext) DeleteGnBUe(ue *GNBUe) {
-	gnb.uePool.Delete(ue.ranUeNgapId)
+	if _, loaded := gnb.uePool.LoadAndDelete(ue.ranUeNgapId); loaded {
+		gnb.unselectAmf(ue.GetAmfId())
+	}
 	for _, pduSession := range ue.context.pduSession {
 		if pduSession != nil {
 			gnb.teidPool.Delete(pduSession.GetTeidDownlink())
@@ -141,6 +185,36 @@ func (gnb *GNBContext) DeleteGnBUe(ue *GNBUe) {
 	ue.Unlock()
 }
 
+// AddIdleUe records a CM-IDLE UE camping on the gNB, it is paged through pagingChannel.
+func (gnb *GNBContext) AddIdleUe(fiveGSTmsi string, pagingChannel chan UEMessage) {
+	gnb.idleUePool.Store(fiveGSTmsi, pagingChannel)
+}
+
+// RemoveIdleUe forgets a UE which is no longer CM-IDLE.
+func (gnb *GNBContext) RemoveIdleUe(fiveGSTmsi string) {
+	gnb.idleUePool.Delete(fiveGSTmsi)
+}
+
+// PageUe sends a paging indication to the CM-IDLE UE identified by fiveGSTmsi, it returns false if no such UE is
+// camping on the gNB.
+func (gnb *GNBContext) PageUe(fiveGSTmsi string) bool {
+	pagingChannel, ok := gnb.idleUePool.Load(fiveGSTmsi)
+	if !ok {
+		return false
+	}
+	select {
+	case pagingChannel.(chan UEMessage) <- UEMessage{Paging: true}:
+	default:
+		// the UE was already paged
+	}
+	return true
+}
+
+// FiveGSTmsi returns the 5G-S-TMSI of a UE as an hexadecimal string: AMF Set ID, AMF Pointer and 5G-TMSI, TS 23.003 2.11.
+func FiveGSTmsi(amfSetId uint16, amfPointer uint8, tmsi [4]uint8) string {
+	return fmt.Sprintf("%04x%s", amfSetId<<6|uint16(amfPointer&0x3f), hex.EncodeToString(tmsi[:]))
+}
+
 func (gnb *GNBContext) GetGnbUe(ranUeId int64) (*GNBUe, error) {
 	ue, err := gnb.uePool.Load(ranUeId)
 	if !err {
@@ -149,6 +223,16 @@ func (gnb *GNBContext) GetGnbUe(ranUeId int64) (*GNBUe, error) {
 	return ue.(*GNBUe), nil
 }
 
+// GetGnbUes returns the UE contexts of the gNodeB.
+func (gnb *GNBContext) GetGnbUes() []*GNBUe {
+	var ues []*GNBUe
+	gnb.uePool.Range(func(key, value interface{}) bool {
+		ues = append(ues, value.(*GNBUe))
+		return true
+	})
+	return ues
+}
+
 func (gnb *GNBContext) GetGnbUeByTeid(teid uint32) (*GNBUe, error) {
 	ue, err := gnb.teidPool.Load(teid)
 	if !err {
@@ -190,18 +274,66 @@ func (gnb *GNBContext) deleteGnBAmf(amfId int64) {
 	gnb.amfPool.Delete(amfId)
 }
 
-func (gnb *GNBContext) selectAmFByCapacity() *GNBAmf {
+func (gnb *GNBContext) selectAmf(guami *Guami) *GNBAmf {
+	gnb.amfSelection.Lock()
+	defer gnb.amfSelection.Unlock()
+
+	var amf *GNBAmf
+	if guami != nil {
+		amf = gnb.selectAmfByGuami(*guami)
+	}
+	if amf == nil {
+		amf = gnb.selectAmFByCapacity()
+	}
+	if amf == nil {
+		amf = gnb.selectAmFByActive()
+	}
+	if amf != nil {
+		amf.numUes.Add(1)
+	}
+	return amf
+}
+
+// unselectAmf releases the AMF selected for a UE whose context is deleted, so that only the UEs it serves count in
+// its load.
+func (gnb *GNBContext) unselectAmf(amfId int64) {
+	gnb.amfSelection.Lock()
+	defer gnb.amfSelection.Unlock()
+
+	amf, err := gnb.getGnbAmf(amfId)
+	if err == nil && amf.numUes.Load() > 0 {
+		amf.numUes.Add(-1)
+	}
+}
+
+// selectAmfByGuami returns the active AMF serving guami, TS 38.410 8.3
+func (gnb *GNBContext) selectAmfByGuami(guami Guami) *GNBAmf {
 	var amfSelect *GNBAmf
 	gnb.amfPool.Range(func(key, value interface{}) bool {
 		amf := value.(*GNBAmf)
-		if amf.relativeAmfCapacity > 0 {
+		if amf.GetState() == Active && amf.ServesGuami(guami) {
 			amfSelect = amf
-			// select AMF and decrement capacity.
-			amfSelect.relativeAmfCapacity--
 			return false
-		} else {
+		}
+		return true
+	})
+
+	return amfSelect
+}
+
+// selectAmFByCapacity spreads UEs over the active AMFs proportionally to their relative capacity.
+func (gnb *GNBContext) selectAmFByCapacity() *GNBAmf {
+	var amfSelect *GNBAmf
+	gnb.amfPool.Range(func(key, value interface{}) bool {
+		amf := value.(*GNBAmf)
+		if amf.GetState() != Active || amf.relativeAmfCapacity <= 0 {
 			return true
 		}
+		// select the AMF with the lowest load relative to its capacity.
+		if amfSelect == nil || (amf.numUes.Load()+1)*amfSelect.relativeAmfCapacity < (amfSelect.numUes.Load()+1)*amf.relativeAmfCapacity {
+			amfSelect = amf
+		}
+		return true
 	})
 
 	return amfSelect
@@ -222,6 +354,29 @@ func (gnb *GNBContext) selectAmFByActive() *GNBAmf {
 	return amfSelect
 }
 
+// GetActiveAmfs returns the number of AMFs the gNB is able to select.
+func (gnb *GNBContext) GetActiveAmfs() int {
+	count := 0
+	gnb.amfPool.Range(func(key, value interface{}) bool {
+		if value.(*GNBAmf).GetState() == Active {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// GetAmfs returns every AMF of the gNB, ordered by id.
+func (gnb *GNBContext) GetAmfs() []*GNBAmf {
+	var amfs []*GNBAmf
+	gnb.amfPool.Range(func(key, value interface{}) bool {
+		amfs = append(amfs, value.(*GNBAmf))
+		return true
+	})
+	sort.Slice(amfs, func(i, j int) bool { return amfs[i].amfId < amfs[j].amfId })
+	return amfs
+}
+
 func (gnb *GNBContext) getGnbAmf(amfId int64) (*GNBAmf, error) {
 	amf, err := gnb.amfPool.Load(amfId)
 	if !err {
@@ -347,14 +502,26 @@ func (gnb *GNBContext) GetGnbPort() int {
 }
 
 func (gnb *GNBContext) GetGnbIdInBytes() []byte {
-	// changed for bytes.
-	resu, err := hex.DecodeString(gnb.controlInfo.gnbId)
+	id, err := strconv.ParseUint(gnb.controlInfo.gnbId, 16, 32)
 	if err != nil {
 		fmt.Println(err)
 	}
+
+	// gnb id is a bit string, left aligned in its octets.
+	length := (gnb.controlInfo.gnbIdLength + 7) / 8
+	id <<= uint(length*8 - gnb.controlInfo.gnbIdLength)
+	resu := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		resu[i] = byte(id)
+		id >>= 8
+	}
 	return resu
 }
 
+func (gnb *GNBContext) GetGnbIdLength() int {
+	return gnb.controlInfo.gnbIdLength
+}
+
 func (gnb *GNBContext) getTac() string {
 	return gnb.controlInfo.tac
 }
@@ -368,18 +535,48 @@ func (gnb *GNBContext) GetTacInBytes() []byte {
 	return resu
 }
 
+// GetSupportedTacsInBytes returns every TAC supported by the gNB, starting with the TAC of the gNB.
+func (gnb *GNBContext) GetSupportedTacsInBytes() [][]byte {
+	tacs := [][]byte{gnb.GetTacInBytes()}
+	for _, tac := range gnb.controlInfo.tacs {
+		resu, err := hex.DecodeString(tac)
+		if err != nil {
+			fmt.Println(err)
+		}
+		tacs = append(tacs, resu)
+	}
+	return tacs
+}
+
 func (gnb *GNBContext) getSlice() (string, string) {
 	return gnb.sliceInfo.sst, gnb.sliceInfo.sd
 }
 
 func (gnb *GNBContext) GetSliceInBytes() ([]byte, []byte) {
-	sstBytes, err := hex.DecodeString(gnb.sliceInfo.sst)
+	return gnb.sliceInfo.inBytes()
+}
+
+// GetSupportedSlicesInBytes returns the SST and SD of every slice supported by the gNB, starting with the slice of the gNB.
+// SD is nil when not set.
+func (gnb *GNBContext) GetSupportedSlicesInBytes() ([][]byte, [][]byte) {
+	sst, sd := gnb.sliceInfo.inBytes()
+	ssts, sds := [][]byte{sst}, [][]byte{sd}
+	for _, slice := range gnb.slices {
+		sst, sd = slice.inBytes()
+		ssts = append(ssts, sst)
+		sds = append(sds, sd)
+	}
+	return ssts, sds
+}
+
+func (slice Slice) inBytes() ([]byte, []byte) {
+	sstBytes, err := hex.DecodeString(slice.sst)
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	if gnb.sliceInfo.sd != "" {
-		sdBytes, err := hex.DecodeString(gnb.sliceInfo.sd)
+	if slice.sd != "" {
+		sdBytes, err := hex.DecodeString(slice.sd)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -393,21 +590,57 @@ func (gnb *GNBContext) GetMccAndMnc() (string, string) {
 }
 
 func (gnb *GNBContext) GetMccAndMncInOctets() []byte {
+	resu := plmnInOctets(gnb.controlInfo.mcc, gnb.controlInfo.mnc)
+
+	log.Info("[GNB] resu: " + hex.EncodeToString(resu))
+	return resu
+}
+
+// GetTaiInOctets returns the TAI of the gNB: its PLMN and TAC, in octets.
+func (gnb *GNBContext) GetTaiInOctets() []byte {
+	return append(plmnInOctets(gnb.controlInfo.mcc, gnb.controlInfo.mnc), gnb.GetTacInBytes()...)
+}
+
+// GetBroadcastPlmnsInOctets returns every PLMN broadcast by the gNB, starting with the PLMN of the gNB.
+func (gnb *GNBContext) GetBroadcastPlmnsInOctets() [][]byte {
+	plmns := [][]byte{gnb.GetMccAndMncInOctets()}
+	for _, plmn := range gnb.controlInfo.plmns {
+		plmns = append(plmns, plmnInOctets(plmn.mcc, plmn.mnc))
+	}
+	return plmns
+}
+
+// ServesTai returns true if the gNB broadcasts plmn and supports tac.
+func (gnb *GNBContext) ServesTai(plmn []byte, tac []byte) bool {
+	for _, broadcastPlmn := range gnb.GetBroadcastPlmnsInOctets() {
+		if !bytes.Equal(broadcastPlmn, plmn) {
+			continue
+		}
+		for _, supportedTac := range gnb.GetSupportedTacsInBytes() {
+			if bytes.Equal(supportedTac, tac) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func plmnInOctets(mcc string, mnc string) []byte {
 
 	// reverse mcc and mnc
-	mcc := reverse(gnb.controlInfo.mcc)
-	mnc := reverse(gnb.controlInfo.mnc)
+	reversedMcc := reverse(mcc)
+	reversedMnc := reverse(mnc)
 
 	// include mcc and mnc in octets
-	oct5 := mcc[1:3]
+	oct5 := reversedMcc[1:3]
 	var oct6 string
 	var oct7 string
-	if len(gnb.controlInfo.mnc) == 2 {
-		oct6 = "f" + string(mcc[0])
-		oct7 = mnc
+	if len(mnc) == 2 {
+		oct6 = "f" + string(reversedMcc[0])
+		oct7 = reversedMnc
 	} else {
-		oct6 = string(mnc[2]) + string(mcc[0])
-		oct7 = mnc[0:2]
+		oct6 = string(reversedMnc[2]) + string(reversedMcc[0])
+		oct7 = reversedMnc[0:2]
 	}
 
 	// changed for bytes.
@@ -415,24 +648,33 @@ func (gnb *GNBContext) GetMccAndMncInOctets() []byte {
 	if err != nil {
 		fmt.Println(err)
 	}
-
-	log.Info("[GNB] resu: " + hex.EncodeToString(resu))
 	return resu
 }
 
 func (gnb *GNBContext) Terminate() {
+	gnb.terminate.Do(func() {
+		// close all connections
+		close(gnb.GetInboundChannel())
+		log.Info("[GNB][UE] NAS channel Terminated")
+
+		gnb.amfPool.Range(func(key, value interface{}) bool {
+			amf := value.(*GNBAmf)
+			if n2 := amf.GetSCTPConn(); n2 != nil {
+				log.Info("[GNB][AMF] N2/TNLA Terminated with AMF ", amf.GetAmfIp(), ":", amf.GetAmfPort())
+				amf.SetStateInactive()
+				n2.Close()
+			}
+			return true
+		})
 
-	// close all connections
-	close(gnb.GetInboundChannel())
-	log.Info("[GNB][UE] NAS channel Terminated")
-
-	n2 := gnb.GetN2()
-	if n2 != nil {
-		log.Info("[GNB][AMF] N2/TNLA Terminated")
-		n2.Close()
-	}
+		log.Info("GNB Terminated")
+		close(gnb.terminated)
+	})
+}
 
-	log.Info("GNB Terminated")
+// Terminated returns a channel closed once the gnb is terminated.
+func (gnb *GNBContext) Terminated() <-chan struct{} {
+	return gnb.terminated
 }
 
 func reverse(s string) string {
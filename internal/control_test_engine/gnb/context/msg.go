@@ -13,8 +13,15 @@ type UEMessage struct {
 	IsNas bool
 	Nas   []byte
 	ConnectionClosed bool
+	Inactive bool // the UE has no more activity, its context is released and it goes CM-IDLE
+	Idle bool // the UE is CM-IDLE and camping on the gNB, it is paged through GNBTx
+	Paging bool // the network has pending downlink data or signalling for the UE
+	Terminated bool // the CM-IDLE UE is terminated, it no longer camps on the gNB
+	FiveGSTmsi string // 5G-S-TMSI of the UE, if registered
 	AmfId int64
 	Msin string
 	Mcc string
 	Mnc string
+	Tai []byte // TAI of the gNB the UE is connected to, PLMN and TAC in octets
+	Guami *Guami // AMF already serving the UE, if any
 }
@@ -11,153 +11,119 @@ import (
 	serviceNas "my5G-RANTester/internal/control_test_engine/gnb/nas/service"
 	serviceNgap "my5G-RANTester/internal/control_test_engine/gnb/ngap/service"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/trigger"
-	"my5G-RANTester/internal/monitoring"
-	"os"
-	"os/signal"
+	"my5G-RANTester/internal/report"
+	"my5G-RANTester/lib/ngap/ngapType"
 	"sync"
 	"time"
 )
 
-func InitGnb(conf config.Config, wg *sync.WaitGroup) *context.GNBContext {
-
-	// instance new gnb.
+func newGnbContext(conf config.GNodeB) *context.GNBContext {
 	gnb := &context.GNBContext{}
 
 	// new gnb context.
 	gnb.NewRanGnbContext(
-		conf.GNodeB.PlmnList.GnbId,
-		conf.GNodeB.PlmnList.Mcc,
-		conf.GNodeB.PlmnList.Mnc,
-		conf.GNodeB.PlmnList.Tac,
-		conf.GNodeB.SliceSupportList.Sst,
-		conf.GNodeB.SliceSupportList.Sd,
-		conf.GNodeB.ControlIF.Ip,
-		conf.GNodeB.DataIF.Ip,
-		conf.GNodeB.ControlIF.Port,
-		conf.GNodeB.DataIF.Port)
-
-	// start communication with AMF (server SCTP).
+		conf.PlmnList.GnbId,
+		conf.PlmnList.Mcc,
+		conf.PlmnList.Mnc,
+		conf.PlmnList.Tac,
+		conf.SliceSupportList.Sst,
+		conf.SliceSupportList.Sd,
+		conf.ControlIF.Ip,
+		conf.DataIF.Ip,
+		conf.ControlIF.Port,
+		conf.DataIF.Port)
+
+	gnb.SetGnbIdLength(conf.GetGnbIdLength())
+	for _, tac := range conf.TacList {
+		gnb.AddSupportedTac(tac)
+	}
+	for _, plmn := range conf.BroadcastPlmnList {
+		gnb.AddBroadcastPlmn(plmn.Mcc, plmn.Mnc)
+	}
+	for _, slice := range conf.SliceList {
+		gnb.AddSupportedSlice(slice.Sst, slice.Sd)
+	}
 
-	// new AMF context.
-	amf := gnb.NewGnBAmf(conf.AMF.Ip, conf.AMF.Port)
-
-	// start communication with AMF(SCTP).
-	if err := serviceNgap.InitConn(amf, gnb); err != nil {
-		log.Fatal("Error in", err)
-	} else {
-		log.Info("[GNB] SCTP/NGAP service is running")
-		// wg.Add(1)
+	return gnb
+}
+
+func InitGnb(conf config.Config, wg *sync.WaitGroup) *context.GNBContext {
+
+	// instance new gnb.
+	gnb := newGnbContext(conf.GNodeB)
+
+	// start communication with every AMF (server SCTP).
+	var amfs []*context.GNBAmf
+	for _, amfConf := range conf.GetAMFs() {
+		// new AMF context.
+		amf := gnb.NewGnBAmf(amfConf.Ip, amfConf.Port)
+
+		// start communication with AMF(SCTP).
+		if err := serviceNgap.InitConn(amf, gnb); err != nil {
+			log.Error("[GNB] Unable to connect to AMF ", amfConf.Ip, ":", amfConf.Port, ": ", err)
+			continue
+		}
+		log.Info("[GNB] SCTP/NGAP service is running with AMF ", amfConf.Ip, ":", amfConf.Port)
+		amfs = append(amfs, amf)
+	}
+	if len(amfs) == 0 {
+		log.Fatal("[GNB] Unable to connect to any AMF")
 	}
 
 	// start communication with UE (server UNIX sockets).
 	serviceNas.InitServer(gnb)
 
-	trigger.SendNgSetupRequest(gnb, amf)
+	for _, amf := range amfs {
+		trigger.SendNgSetupRequest(gnb, amf)
+	}
 
 	go func() {
-		// control the signals
-		sigGnb := make(chan os.Signal, 1)
-		signal.Notify(sigGnb, os.Interrupt)
-
-		// Block until a signal is received.
-		<-sigGnb
-		//gnb.Terminate()
+		// Block until the gnb is shut down.
+		<-gnb.Terminated()
 		wg.Done()
 	}()
 
 	return gnb
 }
 
-func InitGnbForLoadSeconds(conf config.Config, wg *sync.WaitGroup,
-	monitor *monitoring.Monitor) {
+// InitGnbForMonitor starts a gNodeB for the first AMF of the configuration, without connecting to the AMF, so that the
+// health monitor can (re-)establish the association with serviceNgap.InitConn.
+func InitGnbForMonitor(conf config.Config) (*context.GNBContext, *context.GNBAmf) {
 
 	// instance new gnb.
-	gnb := &context.GNBContext{}
-
-	// new gnb context.
-	gnb.NewRanGnbContext(
-		conf.GNodeB.PlmnList.GnbId,
-		conf.GNodeB.PlmnList.Mcc,
-		conf.GNodeB.PlmnList.Mnc,
-		conf.GNodeB.PlmnList.Tac,
-		conf.GNodeB.SliceSupportList.Sst,
-		conf.GNodeB.SliceSupportList.Sd,
-		conf.GNodeB.ControlIF.Ip,
-		conf.GNodeB.DataIF.Ip,
-		conf.GNodeB.ControlIF.Port,
-		conf.GNodeB.DataIF.Port)
-
-	// start communication with AMF (server SCTP).
+	gnb := newGnbContext(conf.GNodeB)
 
 	// new AMF context.
-	amf := gnb.NewGnBAmf(conf.AMF.Ip, conf.AMF.Port)
-
-	// start communication with AMF(SCTP).
-	serviceNgap.InitConn(amf, gnb)
-
-	trigger.SendNgSetupRequest(gnb, amf)
+	amfConf := conf.GetAMFs()[0]
+	amf := gnb.NewGnBAmf(amfConf.Ip, amfConf.Port)
 
-	// timeout is 1 second for receive NG Setup Response
-	time.Sleep(1000 * time.Millisecond)
-
-	// AMF responds message sends by Tester
-	// means AMF is available
-	if amf.GetState() == 0x01 {
-		monitor.IncRqs()
-	}
+	// start communication with UE (server UNIX sockets).
+	serviceNas.InitServer(gnb)
 
-	gnb.Terminate()
-	wg.Done()
-	// os.Exit(0)
+	return gnb, amf
 }
 
-func InitGnbForAvaibility(conf config.Config,
-	monitor *monitoring.Monitor) {
-
-	// instance new gnb.
-	gnb := &context.GNBContext{}
-
-	// new gnb context.
-	gnb.NewRanGnbContext(
-		conf.GNodeB.PlmnList.GnbId,
-		conf.GNodeB.PlmnList.Mcc,
-		conf.GNodeB.PlmnList.Mnc,
-		conf.GNodeB.PlmnList.Tac,
-		conf.GNodeB.SliceSupportList.Sst,
-		conf.GNodeB.SliceSupportList.Sd,
-		conf.GNodeB.ControlIF.Ip,
-		conf.GNodeB.DataIF.Ip,
-		conf.GNodeB.ControlIF.Port,
-		conf.GNodeB.DataIF.Port)
-
-	// start communication with AMF (server SCTP).
-
-	// new AMF context.
-	amf := gnb.NewGnBAmf(conf.AMF.Ip, conf.AMF.Port)
-
-	// start communication with AMF(SCTP).
-	if err := serviceNgap.InitConn(amf, gnb); err != nil {
-		log.Info("Error in ", err)
-
-		return
-
-	} else {
-		log.Info("[GNB] SCTP/NGAP service is running")
-
+// Shutdown requests the AMF to release the UE contexts left on the gnb, eg: of the UEs which could not deregister, then
+// terminates the gnb once they are released, or at deadline.
+func Shutdown(gnb *context.GNBContext, deadline time.Time) {
+	for _, ue := range gnb.GetGnbUes() {
+		if ue.GetAmfUeId() == 0 {
+			// the UE is unknown to the AMF
+			gnb.DeleteGnBUe(ue)
+			continue
+		}
+		trigger.SendUeContextReleaseRequest(ue, ngapType.CauseRadioNetworkPresentReleaseDueToNgranGeneratedReason)
 	}
 
-	trigger.SendNgSetupRequest(gnb, amf)
-
-	// timeout is 1 second for receive NG Setup Response
-	time.Sleep(1000 * time.Millisecond)
-
-	// AMF responds message sends by Tester
-	// means AMF is available
-	if amf.GetState() == 0x01 {
-		monitor.IncAvaibility()
-
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+	for len(gnb.GetGnbUes()) > 0 && time.Now().Before(deadline) {
+		<-poll.C
+	}
+	for _, ue := range gnb.GetGnbUes() {
+		log.Warn("[GNB] UE context of ", ue.GetMsin(), " not released by the AMF before the drain timeout")
+		report.DetachFailed(ue.GetMsin(), "UE context not released by the AMF")
 	}
 
 	gnb.Terminate()
-	// os.Exit(0)
 }
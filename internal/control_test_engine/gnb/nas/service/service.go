@@ -9,6 +9,7 @@ import (
 	"my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/gnb/nas"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/trigger"
+	"my5G-RANTester/lib/ngap/ngapType"
 )
 
 func InitServer(gnb *context.GNBContext)  {
@@ -19,7 +20,27 @@ func gnbListen(gnb *context.GNBContext) {
 	ln := gnb.GetInboundChannel()
 
 	for {
-		message := <- ln
+		message, open := <- ln
+		if !open {
+			// the gNodeB was terminated
+			return
+		}
+
+		if message.Idle {
+			// the UE keeps camping on the gNodeB until paged
+			log.Info("[GNB] UE ", message.Msin, " is CM-IDLE with 5G-S-TMSI ", message.FiveGSTmsi)
+			gnb.AddIdleUe(message.FiveGSTmsi, message.GNBTx)
+			continue
+		}
+		if message.Terminated {
+			// the UE can no longer be paged
+			log.Info("[GNB] CM-IDLE UE ", message.Msin, " with 5G-S-TMSI ", message.FiveGSTmsi, " is terminated")
+			gnb.RemoveIdleUe(message.FiveGSTmsi)
+			continue
+		}
+		if message.FiveGSTmsi != "" {
+			gnb.RemoveIdleUe(message.FiveGSTmsi)
+		}
 
 		// TODO this region of the code may induces race condition.
 
@@ -28,15 +49,15 @@ func gnbListen(gnb *context.GNBContext) {
 		// store UE connection
 		// select AMF and get sctp association
 		// make a tun interface
-		ue := gnb.NewGnBUe(message.GNBTx, message.GNBRx, message.Msin)
+		ue := gnb.NewGnBUe(message.GNBTx, message.GNBRx, message.Msin, message.Guami)
 		mcc, mnc := gnb.GetMccAndMnc()
-		message.GNBTx <- context.UEMessage{Mcc: mcc, Mnc: mnc}
-		ue.SetPduSessions(message.GNBPduSessions)
+		message.GNBTx <- context.UEMessage{Mcc: mcc, Mnc: mnc, Tai: gnb.GetTaiInOctets()}
 
 		if ue == nil {
 			log.Warn("[GNB] UE has not been created")
-			break
+			continue
 		}
+		ue.SetPduSessions(message.GNBPduSessions)
 
 		// accept and handle connection.
 		go processingConn(ue, gnb)
@@ -66,6 +87,9 @@ func processingConn(ue *context.GNBUe, gnb *context.GNBContext) {
 			gnb.DeleteGnBUe(ue)
 		} else if message.IsNas {
 			nas.Dispatch(ue, message.Nas, gnb)
+		} else if message.Inactive {
+			log.Info("[GNB] UE ", ue.GetRanUeId(), " is inactive: Requesting the release of its context")
+			trigger.SendUeContextReleaseRequest(ue, ngapType.CauseRadioNetworkPresentUserInactivity)
 		} else if message.AmfId >= 0 {
 			log.Info("[GNB] Received incoming handover for UE")
 			gnbUeContext.SetStateReady()
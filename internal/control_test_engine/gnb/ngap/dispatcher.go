@@ -5,9 +5,12 @@
 package ngap
 
 import (
+	"errors"
 	log "github.com/sirupsen/logrus"
 	"my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/handler"
+	"my5G-RANTester/internal/control_test_engine/gnb/ngap/trigger"
+	"my5G-RANTester/internal/report"
 	"my5G-RANTester/lib/ngap"
 	"my5G-RANTester/lib/ngap/ngapType"
 )
@@ -15,18 +18,17 @@ import (
 func Dispatch(amf *context.GNBAmf, gnb *context.GNBContext, message []byte) {
 
 	if message == nil {
-		// TODO return error
-		log.Info("[GNB][NGAP] NGAP message is nil")
+		log.Error("[GNB][NGAP] NGAP message is nil")
+		return
 	}
 
 	// decode NGAP message.
 	ngapMsg, err := ngap.Decoder(message)
 	if err != nil {
-		log.Info("[GNB][NGAP] Error decoding NGAP message in ", gnb.GetGnbId(), " GNB")
+		log.Error("[GNB][NGAP] Error decoding NGAP message in ", gnb.GetGnbId(), " GNB: ", err)
+		return
 	}
 
-	// check RanUeId and get UE.
-
 	// handle NGAP message.
 	switch ngapMsg.Present {
 
@@ -37,22 +39,22 @@ func Dispatch(amf *context.GNBAmf, gnb *context.GNBContext, message []byte) {
 		case ngapType.ProcedureCodeDownlinkNASTransport:
 			// handler NGAP Downlink NAS Transport.
 			log.Info("[GNB][NGAP] Receive Downlink NAS Transport")
-			handler.HandlerDownlinkNasTransport(gnb, ngapMsg)
+			err = handler.HandlerDownlinkNasTransport(gnb, ngapMsg)
 
 		case ngapType.ProcedureCodeInitialContextSetup:
 			// handler NGAP Initial Context Setup Request.
 			log.Info("[GNB][NGAP] Receive Initial Context Setup Request")
-			handler.HandlerInitialContextSetupRequest(gnb, ngapMsg)
+			err = handler.HandlerInitialContextSetupRequest(gnb, ngapMsg)
 
 		case ngapType.ProcedureCodePDUSessionResourceSetup:
 			// handler NGAP PDU Session Resource Setup Request.
 			log.Info("[GNB][NGAP] Receive PDU Session Resource Setup Request")
-			handler.HandlerPduSessionResourceSetupRequest(gnb, ngapMsg)
+			err = handler.HandlerPduSessionResourceSetupRequest(gnb, ngapMsg)
 
 		case ngapType.ProcedureCodePDUSessionResourceRelease:
 			// handler NGAP PDU Session Resource Release
 			log.Info("[GNB][NGAP] Receive PDU Session Release Command")
-			handler.HandlerPduSessionReleaseCommand(gnb, ngapMsg)
+			err = handler.HandlerPduSessionReleaseCommand(gnb, ngapMsg)
 
 		case ngapType.ProcedureCodeUEContextRelease:
 			// handler NGAP UE Context Release
@@ -64,6 +66,11 @@ func Dispatch(amf *context.GNBAmf, gnb *context.GNBContext, message []byte) {
 			log.Info("[GNB][NGAP] Receive AMF Configuration Update")
 			handler.HandlerAmfConfigurationUpdate(amf, gnb, ngapMsg)
 
+		case ngapType.ProcedureCodePaging:
+			// handler NGAP Paging
+			log.Info("[GNB][NGAP] Receive Paging")
+			handler.HandlerPaging(gnb, ngapMsg)
+
 		case ngapType.ProcedureCodeErrorIndication:
 			// handler Error Indicator
 			log.Error("[GNB][NGAP] Receive Error Indication")
@@ -85,7 +92,7 @@ func Dispatch(amf *context.GNBAmf, gnb *context.GNBContext, message []byte) {
 		case ngapType.ProcedureCodePathSwitchRequest:
 			// handler PathSwitchRequestAcknowledge
 			log.Info("[GNB][NGAP] Receive PathSwitchRequestAcknowledge")
-			handler.HandlerPathSwitchRequestAcknowledge(gnb, ngapMsg)
+			err = handler.HandlerPathSwitchRequestAcknowledge(gnb, ngapMsg)
 
 		default:
 			log.Info("[GNB][NGAP] Received unknown NGAP message")
@@ -100,8 +107,31 @@ func Dispatch(amf *context.GNBAmf, gnb *context.GNBContext, message []byte) {
 			log.Info("[GNB][NGAP] Receive Ng Setup Failure")
 			handler.HandlerNgSetupFailure(amf, gnb, ngapMsg)
 
+		case ngapType.ProcedureCodePathSwitchRequest:
+			// handler Path Switch Request Failure.
+			log.Info("[GNB][NGAP] Receive Path Switch Request Failure")
+			handler.HandlerPathSwitchRequestFailure(gnb, ngapMsg)
+
 		default:
 			log.Info("[GNB][NGAP] Received unknown NGAP message")
 		}
 	}
+
+	if err != nil {
+		failUe(amf, gnb, err)
+	}
+}
+
+// failUe fails the UE of an invalid NGAP message, and answers the message with an Error Indication.
+func failUe(amf *context.GNBAmf, gnb *context.GNBContext, err error) {
+	log.Error("[GNB][NGAP] ", err)
+
+	var ueErr *handler.UeError
+	if !errors.As(err, &ueErr) {
+		return
+	}
+	if ue, err := gnb.GetGnbUe(ueErr.RanUeId); err == nil && ue != nil {
+		report.FailUe(ue.GetMsin(), ueErr.Reason)
+	}
+	trigger.SendErrorIndication(amf, ueErr.AmfUeId, ueErr.RanUeId, ueErr.Cause)
 }
@@ -0,0 +1,41 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package handler
+
+import (
+	"my5G-RANTester/lib/aper"
+	"my5G-RANTester/lib/ngap/ngapType"
+)
+
+// UeError is an invalid NGAP message about a UE, the gNodeB answers it with an Error Indication of Cause.
+// The UE NGAP IDs are 0 when they are unknown.
+type UeError struct {
+	AmfUeId int64
+	RanUeId int64
+	Cause   ngapType.Cause
+	Reason  string
+}
+
+func (err *UeError) Error() string {
+	return err.Reason
+}
+
+func missingIe(amfUeId int64, ranUeId int64, reason string) error {
+	return protocolError(amfUeId, ranUeId, ngapType.CauseProtocolPresentAbstractSyntaxErrorFalselyConstructedMessage, reason)
+}
+
+func invalidIe(amfUeId int64, ranUeId int64, reason string) error {
+	return protocolError(amfUeId, ranUeId, ngapType.CauseProtocolPresentSemanticError, reason)
+}
+
+func unknownUe(amfUeId int64, ranUeId int64, reason string) error {
+	cause := ngapType.Cause{Present: ngapType.CausePresentRadioNetwork, RadioNetwork: &ngapType.CauseRadioNetwork{Value: ngapType.CauseRadioNetworkPresentUnknownLocalUENGAPID}}
+	return &UeError{AmfUeId: amfUeId, RanUeId: ranUeId, Cause: cause, Reason: reason}
+}
+
+func protocolError(amfUeId int64, ranUeId int64, value aper.Enumerated, reason string) error {
+	cause := ngapType.Cause{Present: ngapType.CausePresentProtocol, Protocol: &ngapType.CauseProtocol{Value: value}}
+	return &UeError{AmfUeId: amfUeId, RanUeId: ranUeId, Cause: cause, Reason: reason}
+}
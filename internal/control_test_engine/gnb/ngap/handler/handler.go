@@ -12,6 +12,7 @@ import (
 	"my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/gnb/nas/message/sender"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/trigger"
+	"my5G-RANTester/internal/report"
 	"my5G-RANTester/lib/aper"
 	"my5G-RANTester/lib/ngap/ngapConvert"
 	"my5G-RANTester/lib/ngap/ngapType"
@@ -19,7 +20,7 @@ import (
 	"time"
 )
 
-func HandlerDownlinkNasTransport(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
+func HandlerDownlinkNasTransport(gnb *context.GNBContext, message *ngapType.NGAPPDU) error {
 
 	var ranUeId int64
 	var amfUeId int64
@@ -33,34 +34,35 @@ func HandlerDownlinkNasTransport(gnb *context.GNBContext, message *ngapType.NGAP
 
 		case ngapType.ProtocolIEIDAMFUENGAPID:
 			if ies.Value.AMFUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] AMF UE NGAP ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "AMF UE NGAP ID is missing")
 			}
 			amfUeId = ies.Value.AMFUENGAPID.Value
 
 		case ngapType.ProtocolIEIDRANUENGAPID:
 			if ies.Value.RANUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] RAN UE NGAP ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "RAN UE NGAP ID is missing")
 			}
 			ranUeId = ies.Value.RANUENGAPID.Value
 
 		case ngapType.ProtocolIEIDNASPDU:
 			if ies.Value.NASPDU == nil {
-				log.Fatal("[GNB][NGAP] NAS PDU is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "NAS PDU is missing")
 			}
 			messageNas = ies.Value.NASPDU.Value
 		}
 	}
 
-	ue := getUeFromContext(gnb, ranUeId, amfUeId)
+	ue, err := getUeFromContext(gnb, ranUeId, amfUeId)
+	if err != nil {
+		return err
+	}
 
 	// send NAS message to UE.
 	sender.SendToUe(ue, messageNas)
+	return nil
 }
 
-func HandlerInitialContextSetupRequest(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
+func HandlerInitialContextSetupRequest(gnb *context.GNBContext, message *ngapType.NGAPPDU) error {
 
 	var ranUeId int64
 	var amfUeId int64
@@ -69,6 +71,7 @@ func HandlerInitialContextSetupRequest(gnb *context.GNBContext, message *ngapTyp
 	var sd []string
 	var mobilityRestrict = "not informed"
 	var maskedImeisv string
+	var pduSessionResourceSetupList *ngapType.PDUSessionResourceSetupListCxtReq
 	// var securityKey []byte
 
 	valueMessage := message.InitiatingMessage.Value.InitialContextSetupRequest
@@ -80,40 +83,39 @@ func HandlerInitialContextSetupRequest(gnb *context.GNBContext, message *ngapTyp
 
 		case ngapType.ProtocolIEIDAMFUENGAPID:
 			if ies.Value.AMFUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] AMF UE NGAP ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "AMF UE NGAP ID is missing")
 			}
 			amfUeId = ies.Value.AMFUENGAPID.Value
 
 		case ngapType.ProtocolIEIDRANUENGAPID:
 			if ies.Value.RANUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] RAN UE NGAP ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "RAN UE NGAP ID is missing")
 			}
 			ranUeId = ies.Value.RANUENGAPID.Value
 
 		case ngapType.ProtocolIEIDNASPDU:
+			// that field is not mandatory.
 			if ies.Value.NASPDU == nil {
 				log.Info("[GNB][NGAP] NAS PDU is missing")
-				// TODO SEND ERROR INDICATION
+			} else {
+				messageNas = ies.Value.NASPDU.Value
 			}
-			messageNas = ies.Value.NASPDU.Value
 
 		case ngapType.ProtocolIEIDSecurityKey:
 			// TODO using for create new security context between GNB and UE.
 			if ies.Value.SecurityKey == nil {
-				log.Fatal("[GNB][NGAP] Security-Key is missing")
+				return missingIe(amfUeId, ranUeId, "Security-Key is missing")
 			}
 			// securityKey = ies.Value.SecurityKey.Value.Bytes
 
 		case ngapType.ProtocolIEIDGUAMI:
 			if ies.Value.GUAMI == nil {
-				log.Fatal("[GNB][NGAP] GUAMI is missing")
+				return missingIe(amfUeId, ranUeId, "GUAMI is missing")
 			}
 
 		case ngapType.ProtocolIEIDAllowedNSSAI:
 			if ies.Value.AllowedNSSAI == nil {
-				log.Fatal("[GNB][NGAP] Allowed NSSAI is missing")
+				return missingIe(amfUeId, ranUeId, "Allowed NSSAI is missing")
 			}
 
 			valor := len(ies.Value.AllowedNSSAI.List)
@@ -159,13 +161,20 @@ func HandlerInitialContextSetupRequest(gnb *context.GNBContext, message *ngapTyp
 			// TODO using for create new security context between UE and GNB.
 			// TODO algorithms for create new security context between UE and GNB.
 			if ies.Value.UESecurityCapabilities == nil {
-				log.Fatal("[GNB][NGAP] UE Security Capabilities is missing")
+				return missingIe(amfUeId, ranUeId, "UE Security Capabilities is missing")
 			}
+
+		case ngapType.ProtocolIEIDPDUSessionResourceSetupListCxtReq:
+			// that field is not mandatory, the PDU Sessions of a UE leaving CM-IDLE are reactivated.
+			pduSessionResourceSetupList = ies.Value.PDUSessionResourceSetupListCxtReq
 		}
 
 	}
 
-	ue := getUeFromContext(gnb, ranUeId, amfUeId)
+	ue, err := getUeFromContext(gnb, ranUeId, amfUeId)
+	if err != nil {
+		return err
+	}
 
 	// create UE context.
 	ue.CreateUeContext(mobilityRestrict, maskedImeisv, sst, sd)
@@ -180,28 +189,37 @@ func HandlerInitialContextSetupRequest(gnb *context.GNBContext, message *ngapTyp
 	log.Info("[GNB][UE] Allowed Nssai-- Sst: ", sst, " Sd: ", sd)
 
 	// send NAS message to UE.
-	log.Info("[GNB][NAS][UE] Send Registration Accept.")
-	sender.SendToUe(ue, messageNas)
+	if messageNas != nil {
+		log.Info("[GNB][NAS][UE] Send Registration Accept.")
+		sender.SendToUe(ue, messageNas)
+	}
+
+	var pduSessions []*context.GnbPDUSession
+	if pduSessionResourceSetupList != nil {
+		for _, item := range pduSessionResourceSetupList.List {
+			pduSession, err := setupPduSession(gnb, ue, item.PDUSessionID.Value, item.SNSSAI, item.PDUSessionResourceSetupRequestTransfer)
+			if err != nil {
+				return err
+			}
+			if item.NASPDU != nil {
+				sender.SendToUe(ue, item.NASPDU.Value)
+			}
+			sendPduSessionToUe(gnb, ue, pduSession)
+			pduSessions = append(pduSessions, pduSession)
+		}
+	}
 
 	// send Initial Context Setup Response.
 	log.Info("[GNB][NGAP][AMF] Send Initial Context Setup Response.")
-	trigger.SendInitialContextSetupResponse(ue)
+	trigger.SendInitialContextSetupResponse(ue, pduSessions, gnb)
+	return nil
 }
 
-func HandlerPduSessionResourceSetupRequest(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
+func HandlerPduSessionResourceSetupRequest(gnb *context.GNBContext, message *ngapType.NGAPPDU) error {
 
 	var ranUeId int64
 	var amfUeId int64
-	var pduSessionId int64
-	var ulTeid uint32
-	var upfAddress []byte
-	var messageNas []byte
-	var sst string
-	var sd string
-	var pduSType uint64
-	var qosId int64
-	var fiveQi int64
-	var priArp int64
+	var pduSessionResourceSetupList *ngapType.PDUSessionResourceSetupListSUReq
 
 	valueMessage := message.InitiatingMessage.Value.PDUSessionResourceSetupRequest
 
@@ -213,100 +231,128 @@ func HandlerPduSessionResourceSetupRequest(gnb *context.GNBContext, message *nga
 		case ngapType.ProtocolIEIDAMFUENGAPID:
 
 			if ies.Value.AMFUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] AMF UE ID is missing")
+				return missingIe(amfUeId, ranUeId, "AMF UE ID is missing")
 			}
 			amfUeId = ies.Value.AMFUENGAPID.Value
 
 		case ngapType.ProtocolIEIDRANUENGAPID:
 
 			if ies.Value.RANUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] RAN UE ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "RAN UE ID is missing")
 			}
 			ranUeId = ies.Value.RANUENGAPID.Value
 
 		case ngapType.ProtocolIEIDPDUSessionResourceSetupListSUReq:
 
 			if ies.Value.PDUSessionResourceSetupListSUReq == nil {
-				log.Fatal("[GNB][NGAP] PDU SESSION RESOURCE SETUP LIST SU REQ is missing")
+				return missingIe(amfUeId, ranUeId, "PDU SESSION RESOURCE SETUP LIST SU REQ is missing")
 			}
-			pDUSessionResourceSetupList := ies.Value.PDUSessionResourceSetupListSUReq
+			pduSessionResourceSetupList = ies.Value.PDUSessionResourceSetupListSUReq
+		}
+	}
 
-			for _, item := range pDUSessionResourceSetupList.List {
+	ue, err := getUeFromContext(gnb, ranUeId, amfUeId)
+	if err != nil {
+		return err
+	}
 
-				// check PDU Session NAS PDU.
-				if item.PDUSessionNASPDU != nil {
-					messageNas = item.PDUSessionNASPDU.Value
-				} else {
-					log.Fatal("[GNB][NGAP] NAS PDU is missing")
-				}
+	if pduSessionResourceSetupList == nil {
+		return missingIe(amfUeId, ranUeId, "PDU SESSION RESOURCE SETUP LIST SU REQ is missing")
+	}
 
-				// check pdu session id and nssai information for create a PDU Session.
+	for _, item := range pduSessionResourceSetupList.List {
 
-				// create a PDU session(PDU SESSION ID + NSSAI).
-				pduSessionId = item.PDUSessionID.Value
+		// check PDU Session NAS PDU.
+		if item.PDUSessionNASPDU == nil {
+			return missingIe(amfUeId, ranUeId, "NAS PDU is missing")
+		}
 
-				if item.SNSSAI.SD != nil {
-					sd = fmt.Sprintf("%x", item.SNSSAI.SD.Value)
-				} else {
-					sd = "not informed"
-				}
+		// create a PDU session(PDU SESSION ID + NSSAI).
+		pduSession, err := setupPduSession(gnb, ue, item.PDUSessionID.Value, item.SNSSAI, item.PDUSessionResourceSetupRequestTransfer)
+		if err != nil {
+			return err
+		}
 
-				if item.SNSSAI.SST.Value != nil {
-					sst = fmt.Sprintf("%x", item.SNSSAI.SST.Value)
-				} else {
-					sst = "not informed"
-				}
+		// send NAS message to UE.
+		sender.SendToUe(ue, item.PDUSessionNASPDU.Value)
+
+		sendPduSessionToUe(gnb, ue, pduSession)
 
-				if item.PDUSessionResourceSetupRequestTransfer != nil {
+		// send PDU Session Resource Setup Response.
+		trigger.SendPduSessionResourceSetupResponse(pduSession, ue, gnb)
+	}
+	return nil
+}
 
-					pdu := &ngapType.PDUSessionResourceSetupRequestTransfer{}
+// setupPduSession creates the PDU Session of a PDU Session Resource Setup Request Transfer for the UE.
+func setupPduSession(gnb *context.GNBContext, ue *context.GNBUe, pduSessionId int64, snssai ngapType.SNSSAI, transfer aper.OctetString) (*context.GnbPDUSession, error) {
+	var ulTeid uint32
+	var upfAddress []byte
+	var sst string
+	var sd string
+	var pduSType uint64
+	var qosId int64
+	var fiveQi int64
+	var priArp int64
 
-					err := aper.UnmarshalWithParams(item.PDUSessionResourceSetupRequestTransfer, pdu, "valueExt")
-					if err == nil {
-						for _, ies := range pdu.ProtocolIEs.List {
+	amfUeId := ue.GetAmfUeId()
+	ranUeId := ue.GetRanUeId()
 
-							switch ies.Id.Value {
+	if snssai.SD != nil {
+		sd = fmt.Sprintf("%x", snssai.SD.Value)
+	} else {
+		sd = "not informed"
+	}
 
-							case ngapType.ProtocolIEIDULNGUUPTNLInformation:
-								ulTeid = binary.BigEndian.Uint32(ies.Value.ULNGUUPTNLInformation.GTPTunnel.GTPTEID.Value)
-								upfAddress = ies.Value.ULNGUUPTNLInformation.GTPTunnel.TransportLayerAddress.Value.Bytes
+	if snssai.SST.Value != nil {
+		sst = fmt.Sprintf("%x", snssai.SST.Value)
+	} else {
+		sst = "not informed"
+	}
 
-							case ngapType.ProtocolIEIDQosFlowSetupRequestList:
-								for _, itemsQos := range ies.Value.QosFlowSetupRequestList.List {
-									qosId = itemsQos.QosFlowIdentifier.Value
-									fiveQi = itemsQos.QosFlowLevelQosParameters.QosCharacteristics.NonDynamic5QI.FiveQI.Value
-									priArp = itemsQos.QosFlowLevelQosParameters.AllocationAndRetentionPriority.PriorityLevelARP.Value
-								}
+	if transfer == nil {
+		return nil, missingIe(amfUeId, ranUeId, "Error in Pdu Session Resource Setup Request, Pdu Session Resource Setup Request Transfer is missing")
+	}
 
-							case ngapType.ProtocolIEIDPDUSessionAggregateMaximumBitRate:
+	pdu := &ngapType.PDUSessionResourceSetupRequestTransfer{}
+	err := aper.UnmarshalWithParams(transfer, pdu, "valueExt")
+	if err != nil {
+		return nil, invalidIe(amfUeId, ranUeId, fmt.Sprint("Error in decode Pdu Session Resource Setup Request Transfer: ", err))
+	}
 
-							case ngapType.ProtocolIEIDPDUSessionType:
-								pduSType = uint64(ies.Value.PDUSessionType.Value)
+	for _, ies := range pdu.ProtocolIEs.List {
 
-							case ngapType.ProtocolIEIDSecurityIndication:
+		switch ies.Id.Value {
 
-							}
-						}
-					} else {
-						log.Info("[GNB][NGAP] Error in decode Pdu Session Resource Setup Request Transfer")
-					}
-				} else {
-					log.Fatal("[GNB][NGAP] Error in Pdu Session Resource Setup Request, Pdu Session Resource Setup Request Transfer is missing")
-				}
+		case ngapType.ProtocolIEIDULNGUUPTNLInformation:
+			ulTeid = binary.BigEndian.Uint32(ies.Value.ULNGUUPTNLInformation.GTPTunnel.GTPTEID.Value)
+			upfAddress = ies.Value.ULNGUUPTNLInformation.GTPTunnel.TransportLayerAddress.Value.Bytes
 
+		case ngapType.ProtocolIEIDQosFlowSetupRequestList:
+			for _, itemsQos := range ies.Value.QosFlowSetupRequestList.List {
+				qosId = itemsQos.QosFlowIdentifier.Value
+				fiveQi = itemsQos.QosFlowLevelQosParameters.QosCharacteristics.NonDynamic5QI.FiveQI.Value
+				priArp = itemsQos.QosFlowLevelQosParameters.AllocationAndRetentionPriority.PriorityLevelARP.Value
 			}
+
+		case ngapType.ProtocolIEIDPDUSessionAggregateMaximumBitRate:
+
+		case ngapType.ProtocolIEIDPDUSessionType:
+			pduSType = uint64(ies.Value.PDUSessionType.Value)
+
+		case ngapType.ProtocolIEIDSecurityIndication:
+
 		}
 	}
 
-	ue := getUeFromContext(gnb, ranUeId, amfUeId)
+	if len(upfAddress) < 4 {
+		return nil, invalidIe(amfUeId, ranUeId, "UPF Address is missing in Pdu Session Resource Setup Request Transfer")
+	}
 
 	// create PDU Session for GNB UE.
 	pduSession, err := ue.CreatePduSession(pduSessionId, sst, sd, pduSType, qosId, priArp, fiveQi, ulTeid, gnb.GetUeTeid(ue))
 	if err != nil {
-		log.Error("[GNB][NGAP] Error in Pdu Session Resource Setup Request.")
-		log.Error("[GNB][NGAP] ", err)
-
+		return nil, invalidIe(amfUeId, ranUeId, fmt.Sprint("Error in Pdu Session Resource Setup Request: ", err))
 	}
 	log.Info("[GNB][NGAP][UE] PDU Session was created with successful.")
 	log.Info("[GNB][NGAP][UE] PDU Session Id: ", pduSession.GetPduSessionId())
@@ -320,27 +366,25 @@ func HandlerPduSessionResourceSetupRequest(gnb *context.GNBContext, message *nga
 	log.Info("[GNB][NGAP][UE] Priority Level ARP: ", pduSession.GetPriorityARP())
 	log.Info("[GNB][NGAP][UE] UPF Address: ", fmt.Sprintf("%d.%d.%d.%d", upfAddress[0], upfAddress[1], upfAddress[2], upfAddress[3]), " :2152")
 
-
 	// get UPF ip.
 	if gnb.GetUpfIp() == "" {
 		upfIp := fmt.Sprintf("%d.%d.%d.%d", upfAddress[0], upfAddress[1], upfAddress[2], upfAddress[3])
 		gnb.SetUpfIp(upfIp)
 	}
 
-	// send NAS message to UE.
-	sender.SendToUe(ue, messageNas)
+	return pduSession, nil
+}
 
+// sendPduSessionToUe sends the tunnel of a PDU Session to the UE.
+func sendPduSessionToUe(gnb *context.GNBContext, ue *context.GNBUe, pduSession *context.GnbPDUSession) {
 	var pduSessions [16]*context.GnbPDUSession
 	pduSessions[0] = pduSession
-    msg := context.UEMessage{GnbIp: gnb.GetN3GnbIp(), UpfIp: gnb.GetUpfIp(), GNBPduSessions: pduSessions}
+	msg := context.UEMessage{GnbIp: gnb.GetN3GnbIp(), UpfIp: gnb.GetUpfIp(), GNBPduSessions: pduSessions}
 
 	sender.SendMessageToUe(ue, msg)
-
-	// send PDU Session Resource Setup Response.
-	trigger.SendPduSessionResourceSetupResponse(pduSession, ue, gnb)
 }
 
-func HandlerPduSessionReleaseCommand(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
+func HandlerPduSessionReleaseCommand(gnb *context.GNBContext, message *ngapType.NGAPPDU) error {
 	valueMessage := message.InitiatingMessage.Value.PDUSessionResourceReleaseCommand
 
 	var amfUeId int64
@@ -356,29 +400,29 @@ func HandlerPduSessionReleaseCommand(gnb *context.GNBContext, message *ngapType.
 		case ngapType.ProtocolIEIDAMFUENGAPID:
 
 			if ies.Value.AMFUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] AMF UE ID is missing")
+				return missingIe(amfUeId, ranUeId, "AMF UE ID is missing")
 			}
 			amfUeId = ies.Value.AMFUENGAPID.Value
 
 		case ngapType.ProtocolIEIDRANUENGAPID:
 
 			if ies.Value.RANUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] RAN UE ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "RAN UE ID is missing")
 			}
 			ranUeId = ies.Value.RANUENGAPID.Value
 
 		case ngapType.ProtocolIEIDNASPDU:
+			// that field is not mandatory.
 			if ies.Value.NASPDU == nil {
 				log.Info("[GNB][NGAP] NAS PDU is missing")
-				// TODO SEND ERROR INDICATION
+			} else {
+				messageNas = ies.Value.NASPDU.Value
 			}
-			messageNas = ies.Value.NASPDU.Value
 
 		case ngapType.ProtocolIEIDPDUSessionResourceToReleaseListRelCmd:
 
 			if ies.Value.PDUSessionResourceToReleaseListRelCmd == nil {
-				log.Fatal("[GNB][NGAP] PDU SESSION RESOURCE SETUP LIST SU REQ is missing")
+				return missingIe(amfUeId, ranUeId, "PDU SESSION RESOURCE SETUP LIST SU REQ is missing")
 			}
 			pDUSessionRessourceToReleaseListRelCmd := ies.Value.PDUSessionResourceToReleaseListRelCmd
 
@@ -388,7 +432,10 @@ func HandlerPduSessionReleaseCommand(gnb *context.GNBContext, message *ngapType.
 		}
 	}
 
-	ue := getUeFromContext(gnb, ranUeId, amfUeId)
+	ue, err := getUeFromContext(gnb, ranUeId, amfUeId)
+	if err != nil {
+		return err
+	}
 
 	for _, pduSessionId := range pduSessionIds {
 		pduSession, err := ue.GetPduSession(pduSessionId.Value)
@@ -402,7 +449,10 @@ func HandlerPduSessionReleaseCommand(gnb *context.GNBContext, message *ngapType.
 
 	trigger.SendPduSessionReleaseResponse(pduSessionIds, ue)
 
-	sender.SendToUe(ue, messageNas)
+	if messageNas != nil {
+		sender.SendToUe(ue, messageNas)
+	}
+	return nil
 }
 
 func HandlerNgSetupResponse(amf *context.GNBAmf, gnb *context.GNBContext, message *ngapType.NGAPPDU) {
@@ -410,8 +460,9 @@ func HandlerNgSetupResponse(amf *context.GNBAmf, gnb *context.GNBContext, messag
 	err := false
 	var plmn string
 
-	// check information about AMF and add in AMF context.
+	// check information about AMF and add in AMF context, replacing the previous NG Setup Response if any.
 	valueMessage := message.SuccessfulOutcome.Value.NGSetupResponse
+	amf.ClearServedInformation()
 
 	for _, ies := range valueMessage.ProtocolIEs.List {
 
@@ -436,6 +487,9 @@ func HandlerNgSetupResponse(amf *context.GNBAmf, gnb *context.GNBContext, messag
 				err = true
 			}
 			for _, items := range ies.Value.ServedGUAMIList.List {
+				if items.GUAMI.AMFRegionID.Value.Bytes != nil && items.GUAMI.AMFSetID.Value.Bytes != nil && items.GUAMI.AMFPointer.Value.Bytes != nil {
+					amf.AddServedGuami(guamiFromNgap(items.GUAMI))
+				}
 				if items.GUAMI.AMFRegionID.Value.Bytes == nil {
 					log.Info("[GNB][NGAP] Error in NG SETUP RESPONSE,Served Guami list is inappropriate")
 					log.Info("[GNB][NGAP] Error in NG SETUP RESPONSE, AMFRegionId is missing")
@@ -506,10 +560,11 @@ func HandlerNgSetupResponse(amf *context.GNBAmf, gnb *context.GNBContext, messag
 	}
 
 	if err {
-		log.Fatal("[GNB][AMF] AMF is inactive")
+		log.Error("[GNB][AMF] AMF is inactive")
 		amf.SetStateInactive()
 	} else {
 		amf.SetStateActive()
+		amf.IncNgSetupResponses()
 		log.Info("[GNB][AMF] AMF Name: ", amf.GetAmfName())
 		log.Info("[GNB][AMF] State of AMF: Active")
 		log.Info("[GNB][AMF] Capacity of AMF: ", amf.GetAmfCapacity())
@@ -521,10 +576,27 @@ func HandlerNgSetupResponse(amf *context.GNBAmf, gnb *context.GNBContext, messag
 			sst, sd := amf.GetSliceSupport(i)
 			log.Info("[GNB][AMF] List of AMF slices Supported by AMF -- sst:", sst, " sd:", sd)
 		}
+		for _, guami := range amf.GetServedGuamis() {
+			log.Info("[GNB][AMF] GUAMI served by AMF -- region: ", guami.RegionId, " set: ", guami.SetId, " pointer: ", guami.Pointer)
+		}
 	}
 
 }
 
+// guamiFromNgap converts the bit strings of a NGAP GUAMI, TS 38.413 9.3.3.3
+func guamiFromNgap(ngapGuami ngapType.GUAMI) context.Guami {
+	guami := context.Guami{}
+	copy(guami.Plmn[:], ngapGuami.PLMNIdentity.Value)
+	guami.RegionId = ngapGuami.AMFRegionID.Value.Bytes[0]
+	setId := ngapGuami.AMFSetID.Value.Bytes
+	guami.SetId = uint16(setId[0]) << 2
+	if len(setId) > 1 {
+		guami.SetId |= uint16(setId[1]) >> 6
+	}
+	guami.Pointer = ngapGuami.AMFPointer.Value.Bytes[0] >> 2
+	return guami
+}
+
 func HandlerNgSetupFailure(amf *context.GNBAmf, gnb *context.GNBContext, message *ngapType.NGAPPDU) {
 
 	// check information about AMF and add in AMF context.
@@ -567,6 +639,7 @@ func HandlerNgSetupFailure(amf *context.GNBAmf, gnb *context.GNBContext, message
 
 	// redundant but useful for information about code.
 	amf.SetStateInactive()
+	amf.IncNgSetupFailures()
 
 	log.Info("[GNB][NGAP] AMF is inactive")
 }
@@ -606,6 +679,64 @@ func HandlerUeContextReleaseCommand(gnb *context.GNBContext, message *ngapType.N
 	log.Info("[GNB][NGAP] Releasing UE Context, cause: ", causeToString(cause))
 }
 
+// HandlerPaging pages the CM-IDLE UE identified by the 5G-S-TMSI of the Paging, if it camps on a TAI of the paging
+// area served by the gNodeB.
+func HandlerPaging(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
+
+	valueMessage := message.InitiatingMessage.Value.Paging
+
+	var fiveGSTmsi *ngapType.FiveGSTMSI
+	var taiList *ngapType.TAIListForPaging
+
+	for _, ies := range valueMessage.ProtocolIEs.List {
+
+		switch ies.Id.Value {
+
+		case ngapType.ProtocolIEIDUEPagingIdentity:
+			if ies.Value.UEPagingIdentity != nil {
+				fiveGSTmsi = ies.Value.UEPagingIdentity.FiveGSTMSI
+			}
+
+		case ngapType.ProtocolIEIDTAIListForPaging:
+			taiList = ies.Value.TAIListForPaging
+		}
+	}
+
+	if fiveGSTmsi == nil || taiList == nil {
+		log.Error("[GNB][NGAP] Paging without 5G-S-TMSI or TAI List for Paging")
+		return
+	}
+
+	served := false
+	for _, item := range taiList.List {
+		if gnb.ServesTai(item.TAI.PLMNIdentity.Value, item.TAI.TAC.Value) {
+			served = true
+			break
+		}
+	}
+	if !served {
+		log.Info("[GNB][NGAP] Ignoring Paging as the gNodeB serves none of its TAIs")
+		return
+	}
+
+	// AMF Set ID on 10 bits and AMF Pointer on 6 bits, both left aligned
+	amfSetId := fiveGSTmsi.AMFSetID.Value.Bytes
+	amfPointer := fiveGSTmsi.AMFPointer.Value.Bytes
+	var tmsi [4]uint8
+	if len(amfSetId) < 2 || len(amfPointer) < 1 || len(fiveGSTmsi.FiveGTMSI.Value) != len(tmsi) {
+		log.Error("[GNB][NGAP] Paging with an invalid 5G-S-TMSI")
+		return
+	}
+	copy(tmsi[:], fiveGSTmsi.FiveGTMSI.Value)
+	ueId := context.FiveGSTmsi(uint16(amfSetId[0])<<2|uint16(amfSetId[1])>>6, amfPointer[0]>>2, tmsi)
+
+	if !gnb.PageUe(ueId) {
+		log.Info("[GNB][NGAP] No CM-IDLE UE with 5G-S-TMSI ", ueId, " camping on the gNodeB")
+		return
+	}
+	log.Info("[GNB][NGAP] Paging UE with 5G-S-TMSI ", ueId)
+}
+
 func HandlerAmfConfigurationUpdate(amf *context.GNBAmf, gnb *context.GNBContext, message *ngapType.NGAPPDU)  {
 
 	// TODO: Implement update AMF Context from AMFConfigurationUpdate
@@ -616,7 +747,7 @@ func HandlerAmfConfigurationUpdate(amf *context.GNBAmf, gnb *context.GNBContext,
 	trigger.SendAmfConfigurationUpdateAcknowledge(amf)
 }
 
-func HandlerPathSwitchRequestAcknowledge(gnb *context.GNBContext, message *ngapType.NGAPPDU)  {
+func HandlerPathSwitchRequestAcknowledge(gnb *context.GNBContext, message *ngapType.NGAPPDU) error {
 	var pduSessionResourceSwitchedList *ngapType.PDUSessionResourceSwitchedList
 	valueMessage := message.SuccessfulOutcome.Value.PathSwitchRequestAcknowledge
 
@@ -628,32 +759,34 @@ func HandlerPathSwitchRequestAcknowledge(gnb *context.GNBContext, message *ngapT
 		case ngapType.ProtocolIEIDAMFUENGAPID:
 
 			if ies.Value.AMFUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] AMF UE ID is missing")
+				return missingIe(amfUeId, ranUeId, "AMF UE ID is missing")
 			}
 			amfUeId = ies.Value.AMFUENGAPID.Value
 
 		case ngapType.ProtocolIEIDRANUENGAPID:
 
 			if ies.Value.RANUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] RAN UE ID is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "RAN UE ID is missing")
 			}
 			ranUeId = ies.Value.RANUENGAPID.Value
 
 		case ngapType.ProtocolIEIDPDUSessionResourceSwitchedList:
 			pduSessionResourceSwitchedList = ies.Value.PDUSessionResourceSwitchedList
 			if pduSessionResourceSwitchedList == nil {
-				log.Fatal("[GNB][NGAP] PduSessionResourceSwitchedList is missing")
-				// TODO SEND ERROR INDICATION
+				return missingIe(amfUeId, ranUeId, "PduSessionResourceSwitchedList is missing")
 			}
 		}
 
 	}
-	ue := getUeFromContext(gnb, ranUeId, amfUeId)
+	ue, err := getUeFromContext(gnb, ranUeId, amfUeId)
+	if err != nil {
+		return err
+	}
+	report.Succeed(ue.GetMsin(), report.Handover)
 
 	if pduSessionResourceSwitchedList == nil || len(pduSessionResourceSwitchedList.List) == 0 {
 		log.Warn("[GNB] No PDU Sessions to be switched")
-		return
+		return nil
 	}
 
 	for _, pduSessionResourceSwitchedItem := range pduSessionResourceSwitchedList.List {
@@ -688,50 +821,75 @@ func HandlerPathSwitchRequestAcknowledge(gnb *context.GNBContext, message *ngapT
 	}
 
 	log.Info("[GNB] Handover completed successfully for UE ", ue.GetMsin())
+	return nil
 }
 
-func HandlerErrorIndication(gnb *context.GNBContext, message *ngapType.NGAPPDU)  {
+func HandlerErrorIndication(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
 
 	valueMessage := message.InitiatingMessage.Value.ErrorIndication
 
 	var amfUeId, ranUeId int64
+	var cause *ngapType.Cause
 
 	for _, ies := range valueMessage.ProtocolIEs.List {
 		switch ies.Id.Value {
 
 		case ngapType.ProtocolIEIDAMFUENGAPID:
-
-			if ies.Value.AMFUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] AMF UE ID is missing")
+			if ies.Value.AMFUENGAPID != nil {
+				amfUeId = ies.Value.AMFUENGAPID.Value
 			}
-			amfUeId = ies.Value.AMFUENGAPID.Value
 
 		case ngapType.ProtocolIEIDRANUENGAPID:
-
-			if ies.Value.RANUENGAPID == nil {
-				log.Fatal("[GNB][NGAP] RAN UE ID is missing")
-				// TODO SEND ERROR INDICATION
+			if ies.Value.RANUENGAPID != nil {
+				ranUeId = ies.Value.RANUENGAPID.Value
 			}
-			ranUeId = ies.Value.RANUENGAPID.Value
+
+		case ngapType.ProtocolIEIDCause:
+			cause = ies.Value.Cause
 		}
 	}
 
-	ue := getUeFromContext(gnb, ranUeId, amfUeId)
+	report.ErrorIndicationReceived()
 
-	log.Warn("[GNB][AMF] Received an Error Indication for UE with AMF UE ID: ", ue.GetAmfUeId(), ", RAN UE ID: ", ue.GetRanUeId())
+	// an Error Indication is never answered with an Error Indication.
+	ue, err := gnb.GetGnbUe(ranUeId)
+	if err != nil || ue == nil {
+		log.Warn("[GNB][AMF] Received an Error Indication, AMF UE ID: ", amfUeId, ", RAN UE ID: ", ranUeId, ", cause: ", causeToString(cause))
+		return
+	}
+
+	log.Warn("[GNB][AMF] Received an Error Indication for UE with AMF UE ID: ", ue.GetAmfUeId(), ", RAN UE ID: ", ue.GetRanUeId(), ", cause: ", causeToString(cause))
+}
+
+func HandlerPathSwitchRequestFailure(gnb *context.GNBContext, message *ngapType.NGAPPDU) {
+	valueMessage := message.UnsuccessfulOutcome.Value.PathSwitchRequestFailure
+
+	var ranUeId int64
+	for _, ies := range valueMessage.ProtocolIEs.List {
+		if ies.Id.Value == ngapType.ProtocolIEIDRANUENGAPID && ies.Value.RANUENGAPID != nil {
+			ranUeId = ies.Value.RANUENGAPID.Value
+		}
+	}
+
+	ue, err := gnb.GetGnbUe(ranUeId)
+	if err != nil || ue == nil {
+		log.Error("[GNB][NGAP] Path Switch Request Failure for an unknown UE, RAN UE NGAP ID: ", ranUeId)
+		return
+	}
+	log.Error("[GNB][NGAP] Handover of UE ", ue.GetMsin(), " failed")
+	report.Fail(ue.GetMsin(), report.Handover, "Path Switch Request Failure")
 }
 
-func getUeFromContext(gnb *context.GNBContext, ranUeId int64, amfUeId int64) *context.GNBUe {
+func getUeFromContext(gnb *context.GNBContext, ranUeId int64, amfUeId int64) (*context.GNBUe, error) {
 	// check RanUeId and get UE.
 	ue, err := gnb.GetGnbUe(ranUeId)
 	if err != nil || ue == nil {
-		log.Fatal("[GNB][NGAP] RAN UE NGAP ID is incorrect, found: ", ranUeId)
-		// TODO SEND ERROR INDICATION
+		return nil, unknownUe(amfUeId, ranUeId, fmt.Sprint("RAN UE NGAP ID is incorrect, found: ", ranUeId))
 	}
 
-		ue.SetAmfUeId(amfUeId)
+	ue.SetAmfUeId(amfUeId)
 
-	return ue
+	return ue, nil
 }
 
 func causeToString(cause *ngapType.Cause) string {
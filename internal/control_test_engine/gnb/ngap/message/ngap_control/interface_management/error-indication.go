@@ -0,0 +1,66 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package interface_management
+
+import (
+	"my5G-RANTester/lib/ngap"
+	"my5G-RANTester/lib/ngap/ngapType"
+)
+
+func ErrorIndication(amfUeNgapID, ranUeNgapID int64, cause ngapType.Cause) ([]byte, error) {
+	message := BuildErrorIndication(amfUeNgapID, ranUeNgapID, cause)
+
+	return ngap.Encoder(message)
+}
+
+// BuildErrorIndication builds an Error Indication, about the UE with the given NGAP IDs unless the RAN UE NGAP ID is 0.
+func BuildErrorIndication(amfUeNgapID, ranUeNgapID int64, cause ngapType.Cause) (pdu ngapType.NGAPPDU) {
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeErrorIndication
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentErrorIndication
+	initiatingMessage.Value.ErrorIndication = new(ngapType.ErrorIndication)
+
+	errorIndication := initiatingMessage.Value.ErrorIndication
+	errorIndicationIEs := &errorIndication.ProtocolIEs
+
+	if ranUeNgapID != 0 {
+		// AMF UE NGAP ID
+		ie := ngapType.ErrorIndicationIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.ErrorIndicationIEsPresentAMFUENGAPID
+		ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+		ie.Value.AMFUENGAPID.Value = amfUeNgapID
+
+		errorIndicationIEs.List = append(errorIndicationIEs.List, ie)
+
+		// RAN UE NGAP ID
+		ie = ngapType.ErrorIndicationIEs{}
+		ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+		ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+		ie.Value.Present = ngapType.ErrorIndicationIEsPresentRANUENGAPID
+		ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+		ie.Value.RANUENGAPID.Value = ranUeNgapID
+
+		errorIndicationIEs.List = append(errorIndicationIEs.List, ie)
+	}
+
+	// Cause
+	ie := ngapType.ErrorIndicationIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.ErrorIndicationIEsPresentCause
+	ie.Value.Cause = &cause
+
+	errorIndicationIEs.List = append(errorIndicationIEs.List, ie)
+
+	return
+}
@@ -70,38 +70,43 @@ func BuildNGSetupRequest(gnb *context.GNBContext) (pdu ngapType.NGAPPDU) {
 
 	supportedTAList := ie.Value.SupportedTAList
 
-	// SupportedTAItem in SupportedTAList
-	supportedTAItem := ngapType.SupportedTAItem{}
-	// supportedTAItem.TAC.Value = aper.OctetString("\x00\x00\x01")
-	supportedTAItem.TAC.Value = gnb.GetTacInBytes()
-
-	broadcastPLMNList := &supportedTAItem.BroadcastPLMNList
-	// BroadcastPLMNItem in BroadcastPLMNList
-	broadcastPLMNItem := ngapType.BroadcastPLMNItem{}
-	// broadcastPLMNItem.PLMNIdentity.Value = aper.OctetString("\x02\xf8\x39")
-	broadcastPLMNItem.PLMNIdentity.Value = gnb.GetMccAndMncInOctets()
-
-	sliceSupportList := &broadcastPLMNItem.TAISliceSupportList
-
-	// SliceSupportItem in SliceSupportList
-	sliceSupportItem := ngapType.SliceSupportItem{}
-	sst, sd := gnb.GetSliceInBytes()
-
-	// sliceSupportItem.SNSSAI.SST.Value = aper.OctetString("\x01")
-	sliceSupportItem.SNSSAI.SST.Value = sst
-
-	// sliceSupportItem.SNSSAI.SD.Value = aper.OctetString("\x01\x02\x03")
-	if sd != nil {
-		sliceSupportItem.SNSSAI.SD = new(ngapType.SD)
-		sliceSupportItem.SNSSAI.SD.Value = sd
+	// SupportedTAItem in SupportedTAList, every TA broadcasts every PLMN with every slice
+	ssts, sds := gnb.GetSupportedSlicesInBytes()
+	for _, tac := range gnb.GetSupportedTacsInBytes() {
+		supportedTAItem := ngapType.SupportedTAItem{}
+		// supportedTAItem.TAC.Value = aper.OctetString("\x00\x00\x01")
+		supportedTAItem.TAC.Value = tac
+
+		broadcastPLMNList := &supportedTAItem.BroadcastPLMNList
+		for _, plmn := range gnb.GetBroadcastPlmnsInOctets() {
+			// BroadcastPLMNItem in BroadcastPLMNList
+			broadcastPLMNItem := ngapType.BroadcastPLMNItem{}
+			// broadcastPLMNItem.PLMNIdentity.Value = aper.OctetString("\x02\xf8\x39")
+			broadcastPLMNItem.PLMNIdentity.Value = plmn
+
+			sliceSupportList := &broadcastPLMNItem.TAISliceSupportList
+			for i := range ssts {
+				// SliceSupportItem in SliceSupportList
+				sliceSupportItem := ngapType.SliceSupportItem{}
+
+				// sliceSupportItem.SNSSAI.SST.Value = aper.OctetString("\x01")
+				sliceSupportItem.SNSSAI.SST.Value = ssts[i]
+
+				// sliceSupportItem.SNSSAI.SD.Value = aper.OctetString("\x01\x02\x03")
+				if sds[i] != nil {
+					sliceSupportItem.SNSSAI.SD = new(ngapType.SD)
+					sliceSupportItem.SNSSAI.SD.Value = sds[i]
+				}
+
+				sliceSupportList.List = append(sliceSupportList.List, sliceSupportItem)
+			}
+
+			broadcastPLMNList.List = append(broadcastPLMNList.List, broadcastPLMNItem)
+		}
+
+		supportedTAList.List = append(supportedTAList.List, supportedTAItem)
 	}
 
-	sliceSupportList.List = append(sliceSupportList.List, sliceSupportItem)
-
-	broadcastPLMNList.List = append(broadcastPLMNList.List, broadcastPLMNItem)
-
-	supportedTAList.List = append(supportedTAList.List, supportedTAItem)
-
 	nGSetupRequestIEs.List = append(nGSetupRequestIEs.List, ie)
 
 	// PagingDRX
@@ -125,7 +130,7 @@ func NGSetupRequest(gnb *context.GNBContext, name string) ([]byte, error) {
 	ie := message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[0]
 	gnbID := ie.Value.GlobalRANNodeID.GlobalGNBID.GNBID.GNBID
 	gnbID.Bytes = gnb.GetGnbIdInBytes()
-	gnbID.BitLength = 24
+	gnbID.BitLength = uint64(gnb.GetGnbIdLength())
 	// RANNodeName
 	ie = message.InitiatingMessage.Value.NGSetupRequest.ProtocolIEs.List[1]
 	ie.Value.RANNodeName.Value = name
@@ -6,8 +6,10 @@ package ue_context_management
 
 import (
 	"my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/control_test_engine/gnb/ngap/message/ngap_control/pdu_session_management"
 	"my5G-RANTester/lib/ngap"
 	"my5G-RANTester/lib/ngap/ngapType"
+	"net"
 )
 
 /*
@@ -26,8 +28,35 @@ func initialContextSetupResponse(connN2 *sctp.SCTPConn, amfUeNgapID int64, ranUe
 }
 */
 
-func InitialContextSetupResponse(ue *context.GNBUe) ([]byte, error) {
+// InitialContextSetupResponse returns an Initial Context Setup Response, listing the PDU Sessions set up for the UE.
+func InitialContextSetupResponse(ue *context.GNBUe, pduSessions []*context.GnbPDUSession, ipv4 string) ([]byte, error) {
 	message := BuildInitialContextSetupResponseForRegistraionTest(ue.GetAmfUeId(), ue.GetRanUeId())
+	if len(pduSessions) == 0 {
+		return ngap.Encoder(message)
+	}
+
+	// check hostname(Error in docker if using hostname)
+	nameIp, err := net.LookupHost(ipv4)
+	if err != nil {
+		return nil, err
+	}
+
+	// PDU Session Resource Setup Response List
+	ie := ngapType.InitialContextSetupResponseIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDPDUSessionResourceSetupListCxtRes
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.InitialContextSetupResponseIEsPresentPDUSessionResourceSetupListCxtRes
+	ie.Value.PDUSessionResourceSetupListCxtRes = new(ngapType.PDUSessionResourceSetupListCxtRes)
+
+	for _, pduSession := range pduSessions {
+		item := ngapType.PDUSessionResourceSetupItemCxtRes{}
+		item.PDUSessionID.Value = pduSession.GetPduSessionId()
+		item.PDUSessionResourceSetupResponseTransfer = pdu_session_management.GetPDUSessionResourceSetupResponseTransfer(nameIp[0], pduSession.GetTeidDownlink(), pduSession.GetQosId())
+		ie.Value.PDUSessionResourceSetupListCxtRes.List = append(ie.Value.PDUSessionResourceSetupListCxtRes.List, item)
+	}
+
+	initialContextSetupResponseIEs := &message.SuccessfulOutcome.Value.InitialContextSetupResponse.ProtocolIEs
+	initialContextSetupResponseIEs.List = append(initialContextSetupResponseIEs.List, ie)
 
 	return ngap.Encoder(message)
 }
@@ -0,0 +1,69 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package ue_context_management
+
+import (
+	"my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/lib/aper"
+	"my5G-RANTester/lib/ngap"
+	"my5G-RANTester/lib/ngap/ngapType"
+)
+
+func UeContextReleaseRequest(ue *context.GNBUe, cause aper.Enumerated) ([]byte, error) {
+	message := BuildUeContextReleaseRequest(ue.GetAmfUeId(), ue.GetRanUeId(), cause)
+
+	return ngap.Encoder(message)
+}
+
+// BuildUeContextReleaseRequest builds a UE Context Release Request with a Radio Network Layer cause.
+func BuildUeContextReleaseRequest(amfUeNgapID, ranUeNgapID int64, cause aper.Enumerated) (pdu ngapType.NGAPPDU) {
+
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUEContextReleaseRequest
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentIgnore
+
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUEContextReleaseRequest
+	initiatingMessage.Value.UEContextReleaseRequest = new(ngapType.UEContextReleaseRequest)
+
+	ueContextReleaseRequest := initiatingMessage.Value.UEContextReleaseRequest
+	ueContextReleaseRequestIEs := &ueContextReleaseRequest.ProtocolIEs
+
+	// AMF UE NGAP ID
+	ie := ngapType.UEContextReleaseRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDAMFUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UEContextReleaseRequestIEsPresentAMFUENGAPID
+	ie.Value.AMFUENGAPID = new(ngapType.AMFUENGAPID)
+	ie.Value.AMFUENGAPID.Value = amfUeNgapID
+
+	ueContextReleaseRequestIEs.List = append(ueContextReleaseRequestIEs.List, ie)
+
+	// RAN UE NGAP ID
+	ie = ngapType.UEContextReleaseRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDRANUENGAPID
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UEContextReleaseRequestIEsPresentRANUENGAPID
+	ie.Value.RANUENGAPID = new(ngapType.RANUENGAPID)
+	ie.Value.RANUENGAPID.Value = ranUeNgapID
+
+	ueContextReleaseRequestIEs.List = append(ueContextReleaseRequestIEs.List, ie)
+
+	// Cause
+	ie = ngapType.UEContextReleaseRequestIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.UEContextReleaseRequestIEsPresentCause
+	ie.Value.Cause = new(ngapType.Cause)
+	ie.Value.Cause.Present = ngapType.CausePresentRadioNetwork
+	ie.Value.Cause.RadioNetwork = new(ngapType.CauseRadioNetwork)
+	ie.Value.Cause.RadioNetwork.Value = cause
+
+	ueContextReleaseRequestIEs.List = append(ueContextReleaseRequestIEs.List, ie)
+
+	return
+}
@@ -7,6 +7,8 @@ package sender
 import (
 	"fmt"
 	"github.com/ishidawataru/sctp"
+	"my5G-RANTester/internal/events"
+	"my5G-RANTester/internal/monitoring"
 	"my5G-RANTester/lib/ngap/ngapSctp"
 )
 
@@ -22,6 +24,9 @@ func SendToAmF(message []byte, conn *sctp.SCTPConn) error {
 	if err != nil {
 		return fmt.Errorf("Error sending NGAP message ", err)
 	}
+	gnb := monitoring.N2Addr(conn)
+	monitoring.IncNgapMessage(gnb, "tx", message)
+	events.NgapMessage(gnb, events.Uplink, message)
 
 	return nil
 }
@@ -10,6 +10,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap"
+	"my5G-RANTester/internal/events"
+	"my5G-RANTester/internal/monitoring"
 )
 
 func InitConn(amf *context.GNBAmf, gnb *context.GNBContext) error {
@@ -56,6 +58,7 @@ func GnbListen(amf *context.GNBAmf, gnb *context.GNBContext) {
 
 	buf := make([]byte, 65535)
 	conn := amf.GetSCTPConn()
+	n2Addr := monitoring.N2Addr(conn)
 
 	/*
 		defer func() {
@@ -70,6 +73,13 @@ func GnbListen(amf *context.GNBAmf, gnb *context.GNBContext) {
 
 		n, info, err := conn.SCTPRead(buf[:])
 		if err != nil {
+			// new UEs will be served by the remaining AMFs.
+			if amf.GetState() == context.Active {
+				amf.SetStateInactive()
+				log.Error("[GNB][SCTP] Association with AMF ", amf.GetAmfIp(), ":", amf.GetAmfPort(), " is lost: ", err)
+				log.Warn("[GNB][AMF] ", gnb.GetActiveAmfs(), " AMF(s) remaining for new UEs")
+			}
+			amf.SetAssociationLost(conn)
 			break
 		}
 
@@ -77,6 +87,8 @@ func GnbListen(amf *context.GNBAmf, gnb *context.GNBContext) {
 
 		forwardData := make([]byte, n)
 		copy(forwardData, buf[:n])
+		monitoring.IncNgapMessage(n2Addr, "rx", forwardData)
+		events.NgapMessage(n2Addr, events.Downlink, forwardData)
 
 		// handling NGAP message.
 		go ngap.Dispatch(amf, gnb, forwardData)
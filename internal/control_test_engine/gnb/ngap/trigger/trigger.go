@@ -12,6 +12,7 @@ import (
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/message/ngap_control/ue_context_management"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/message/ngap_control/ue_mobility_management"
 	"my5G-RANTester/internal/control_test_engine/gnb/ngap/message/sender"
+	"my5G-RANTester/lib/aper"
 	"my5G-RANTester/lib/ngap/ngapType"
 )
 
@@ -22,7 +23,8 @@ func SendPduSessionResourceSetupResponse(pduSession *context.GnbPDUSession, ue *
 	gnbIp := gnb.GetGnbIpByData()
 	ngapMsg, err := pdu_session_management.PDUSessionResourceSetupResponse(pduSession, ue, gnbIp)
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending PDU Session Resource Setup Response.")
+		log.Error("[GNB][NGAP] Error sending PDU Session Resource Setup Response.")
+		return
 	}
 
 	ue.SetStateReady()
@@ -31,7 +33,7 @@ func SendPduSessionResourceSetupResponse(pduSession *context.GnbPDUSession, ue *
 	conn := ue.GetSCTP()
 	err = sender.SendToAmF(ngapMsg, conn)
 	if err != nil {
-		log.Fatal("[GNB][AMF] Error sending PDU Session Resource Setup Response.: ", err)
+		log.Error("[GNB][AMF] Error sending PDU Session Resource Setup Response.: ", err)
 	}
 }
 
@@ -39,35 +41,38 @@ func SendPduSessionReleaseResponse(pduSessionIds []ngapType.PDUSessionID, ue *co
 	log.Info("[GNB] Initiating PDU Session Release Response")
 
 	if len(pduSessionIds) == 0 {
-		log.Fatal("[GNB][NGAP] Trying to send a PDU Session Release Reponse for no PDU Session")
+		log.Error("[GNB][NGAP] Trying to send a PDU Session Release Reponse for no PDU Session")
+		return
 	}
 
 	ngapMsg, err := pdu_session_management.PDUSessionReleaseResponse(pduSessionIds, ue)
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending PDU Session Release Response.: ", err)
+		log.Error("[GNB][NGAP] Error sending PDU Session Release Response.: ", err)
+		return
 	}
 
 	conn := ue.GetSCTP()
 	err = sender.SendToAmF(ngapMsg, conn)
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending PDU Session Release Response.: ", err)
+		log.Error("[GNB][NGAP] Error sending PDU Session Release Response.: ", err)
 	}
 }
 
-func SendInitialContextSetupResponse(ue *context.GNBUe) {
+func SendInitialContextSetupResponse(ue *context.GNBUe, pduSessions []*context.GnbPDUSession, gnb *context.GNBContext) {
 	log.Info("[GNB] Initiating Initial Context Setup Response")
 
 	// send Initial Context Setup Response.
-	ngapMsg, err := ue_context_management.InitialContextSetupResponse(ue)
+	ngapMsg, err := ue_context_management.InitialContextSetupResponse(ue, pduSessions, gnb.GetGnbIpByData())
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending Initial Context Setup Response")
+		log.Error("[GNB][NGAP] Error sending Initial Context Setup Response")
+		return
 	}
 
 	// Send Initial Context Setup Response.
 	conn := ue.GetSCTP()
 	err = sender.SendToAmF(ngapMsg, conn)
 	if err != nil {
-		log.Fatal("[GNB][AMF] Error sending Initial Context Setup Response: ", err)
+		log.Error("[GNB][AMF] Error sending Initial Context Setup Response: ", err)
 	}
 }
 
@@ -78,14 +83,35 @@ func SendUeContextReleaseComplete(ue *context.GNBUe) {
 	// send UE Context Release Complete
 	ngapMsg, err := ue_context_management.UeContextReleaseComplete(ue)
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending UE Context Complete")
+		log.Error("[GNB][NGAP] Error sending UE Context Complete")
+		return
 	}
 
 	// Send UE Context Release Complete
 	conn := ue.GetSCTP()
 	err = sender.SendToAmF(ngapMsg, conn)
 	if err != nil {
-		log.Fatal("[GNB][AMF] Error sending UE Context Complete: ", err)
+		log.Error("[GNB][AMF] Error sending UE Context Complete: ", err)
+	}
+}
+
+// SendUeContextReleaseRequest requests the AMF to release the UE context, eg: when the gNodeB is shutting down, or
+// when the UE is inactive.
+func SendUeContextReleaseRequest(ue *context.GNBUe, cause aper.Enumerated) {
+	log.Info("[GNB] Initiating UE Context Release Request")
+
+	// send UE Context Release Request
+	ngapMsg, err := ue_context_management.UeContextReleaseRequest(ue, cause)
+	if err != nil {
+		log.Error("[GNB][NGAP] Error sending UE Context Release Request: ", err)
+		return
+	}
+
+	// Send UE Context Release Request
+	conn := ue.GetSCTP()
+	err = sender.SendToAmF(ngapMsg, conn)
+	if err != nil {
+		log.Error("[GNB][AMF] Error sending UE Context Release Request: ", err)
 	}
 }
 
@@ -95,14 +121,15 @@ func SendAmfConfigurationUpdateAcknowledge(amf *context.GNBAmf) {
 	// send AMF Configure Update Acknowledge
 	ngapMsg, err := interface_management.AmfConfigurationUpdateAcknowledge()
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending AMF Configuration Update Acknowledge")
+		log.Error("[GNB][NGAP] Error sending AMF Configuration Update Acknowledge")
+		return
 	}
 
 	// Send AMF Configure Update Acknowledge
 	conn := amf.GetSCTPConn()
 	err = sender.SendToAmF(ngapMsg, conn)
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending AMF Configuration Update Acknowledge")
+		log.Error("[GNB][NGAP] Error sending AMF Configuration Update Acknowledge")
 	}
 }
 
@@ -136,6 +163,21 @@ func SendPathSwitchRequest(gnb *context.GNBContext, ue *context.GNBUe) {
 	conn := ue.GetSCTP()
 	err = sender.SendToAmF(ngapMsg, conn)
 	if err != nil {
-		log.Fatal("[GNB][NGAP] Error sending Path Switch Request.: ", err)
+		log.Error("[GNB][NGAP] Error sending Path Switch Request.: ", err)
 	}
-}
\ No newline at end of file
+}
+func SendErrorIndication(amf *context.GNBAmf, amfUeId int64, ranUeId int64, cause ngapType.Cause) {
+	log.Info("[GNB] Initiating Error Indication")
+
+	ngapMsg, err := interface_management.ErrorIndication(amfUeId, ranUeId, cause)
+	if err != nil {
+		log.Error("[GNB][NGAP] Error sending Error Indication: ", err)
+		return
+	}
+
+	conn := amf.GetSCTPConn()
+	err = sender.SendToAmF(ngapMsg, conn)
+	if err != nil {
+		log.Error("[GNB][NGAP] Error sending Error Indication: ", err)
+	}
+}
@@ -16,6 +16,8 @@ const (
 	Terminate         UeTesterMessageType = 4
 	Kill              UeTesterMessageType = 5
 	Handover          UeTesterMessageType = 6
+	ConnectionRelease UeTesterMessageType = 7 // the UE goes CM-IDLE
+	ServiceRequest    UeTesterMessageType = 8 // the UE goes back to CM-CONNECTED
 )
 
 type UeTesterMessage struct {
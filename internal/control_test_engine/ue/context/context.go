@@ -12,13 +12,18 @@ import (
 	"fmt"
 	"my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/ue/scenario"
+	"my5G-RANTester/internal/events"
+	"my5G-RANTester/internal/monitoring"
+	"my5G-RANTester/internal/report"
 	"my5G-RANTester/lib/UeauCommon"
 	"my5G-RANTester/lib/milenage"
 	"net"
 	"reflect"
 	"regexp"
 	"sync"
+	"time"
 
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/nas/nasType"
 	"github.com/free5gc/nas/security"
 
@@ -42,15 +47,34 @@ const SM5G_PDU_SESSION_INACTIVE = 0x06
 const SM5G_PDU_SESSION_ACTIVE_PENDING = 0x07
 const SM5G_PDU_SESSION_ACTIVE = 0x08
 
+// 5GMM connection management states in the UE, TS 24.501 5.1.3.2.1.
+const CM5G_IDLE = 0x00
+const CM5G_CONNECTED = 0x01
+
 type UEContext struct {
 	id         uint8
 	UeSecurity SECURITY
 	StateMM    int
+	StateCM    int
 	gnbRx      chan context.UEMessage
 	gnbTx      chan context.UEMessage
+	servingGnb chan context.UEMessage // inbound channel of the gNodeB the UE is camping on
 	PduSession [16]*UEPDUSession
 	amfInfo    Amf
 
+	registrationType uint8         // registration type of the last Registration Request
+	servingTai       []byte        // TAI of the gNodeB the UE is connected to, in octets
+	taiList          [][]byte      // registration area of the UE, TAIs in octets
+	t3512            time.Duration // periodic registration update timer, 0 if deactivated
+
+	reRegistrationRequired bool // the network deregistered the UE, which registers again once its connection is released
+
+	ngKsi       uint8 // key set identifier of the NAS security context, assigned by the AMF
+	usimInvalid bool  // the USIM is invalid for 5GS services, the UE no longer registers
+
+	imei   string // PEI of the UE, answered to Identity Requests, optional
+	imeisv string
+
 	// TODO: Modify config so you can configure these parameters per PDUSession
 	Dnn           string
 	Snssai        models.Snssai
@@ -63,6 +87,7 @@ type UEContext struct {
 }
 
 type Amf struct {
+	amfPlmn     [3]uint8 // plmn of the 5G-GUTI, in octets
 	amfRegionId uint8
 	amfSetId    uint16
 	amfPointer  uint8
@@ -104,6 +129,7 @@ type SECURITY struct {
 	AuthenticationSubs   models.AuthenticationSubscription
 	Suci                 nasType.MobileIdentity5GS
 	RoutingIndicator     string
+	suciProtection       suciProtection
 	Guti                 [4]byte
 }
 
@@ -180,6 +206,9 @@ func (ue *UEContext) NewRanUeContext(msin string,
 
 	ue.scenarioChan = scenarioChan
 
+	// no NAS security context until the UE is authenticated
+	ue.ngKsi = uint8(nasMessage.NasKeySetIdentifierNoKeyIsAvailable)
+
 	// added initial state for MM(NULL)
 	ue.StateMM = MM5G_NULL
 }
@@ -210,8 +239,20 @@ func (ue *UEContext) GetUeId() uint8 {
 	return ue.id
 }
 
+// GetSuci returns the SUCI of the UE, concealed with a fresh ephemeral key pair on each call unless the null scheme
+// is used, so that two SUCIs of the UE cannot be linked, TS 33.501 6.12.2.
 func (ue *UEContext) GetSuci() nasType.MobileIdentity5GS {
-	return ue.UeSecurity.Suci
+	protection := ue.UeSecurity.suciProtection
+	if protection.scheme == uint8(nasMessage.ProtectionSchemeNullScheme) {
+		return ue.UeSecurity.Suci
+	}
+	suci, err := ue.concealSuci(protection)
+	if err != nil {
+		// the MSIN is never sent in clear when a protection scheme is configured
+		log.Error("[UE][NAS] Unable to conceal the SUCI: ", err)
+		return nasType.MobileIdentity5GS{Len: 1, Buffer: []uint8{nasMessage.MobileIdentity5GSTypeNoIdentity}}
+	}
+	return suci
 }
 
 func (ue *UEContext) GetMsin() string {
@@ -224,33 +265,95 @@ func (ue *UEContext) GetSupi() string {
 
 func (ue *UEContext) SetStateMM_DEREGISTERED_INITIATED() {
 	ue.StateMM = MM5G_DEREGISTERED_INIT
+	ue.recordStateMM("MM5G_DEREGISTERED_INIT")
 	ue.scenarioChan <- scenario.ScenarioMessage{StateChange: ue.StateMM}
 }
 
 func (ue *UEContext) SetStateMM_MM5G_SERVICE_REQ_INIT() {
 	ue.StateMM = MM5G_SERVICE_REQ_INIT
+	ue.recordStateMM("MM5G_SERVICE_REQ_INIT")
 	ue.scenarioChan <- scenario.ScenarioMessage{StateChange: ue.StateMM}
 }
 
 func (ue *UEContext) SetStateMM_REGISTERED_INITIATED() {
 	ue.StateMM = MM5G_REGISTERED_INITIATED
+	ue.recordStateMM("MM5G_REGISTERED_INITIATED")
 	ue.scenarioChan <- scenario.ScenarioMessage{StateChange: ue.StateMM}
 }
 
 func (ue *UEContext) SetStateMM_REGISTERED() {
 	ue.StateMM = MM5G_REGISTERED
+	ue.recordStateMM("MM5G_REGISTERED")
 	ue.scenarioChan <- scenario.ScenarioMessage{StateChange: ue.StateMM}
 }
 
 func (ue *UEContext) SetStateMM_NULL() {
 	ue.StateMM = MM5G_NULL
+	ue.recordStateMM("MM5G_NULL")
 }
 
 func (ue *UEContext) SetStateMM_DEREGISTERED() {
 	ue.StateMM = MM5G_DEREGISTERED
+	ue.recordStateMM("MM5G_DEREGISTERED")
 	ue.scenarioChan <- scenario.ScenarioMessage{StateChange: ue.StateMM}
 }
 
+func (ue *UEContext) SetStateCM_IDLE() {
+	ue.StateCM = CM5G_IDLE
+	ue.recordStateCM("CM5G_IDLE")
+}
+
+func (ue *UEContext) SetStateCM_CONNECTED() {
+	ue.StateCM = CM5G_CONNECTED
+	ue.recordStateCM("CM5G_CONNECTED")
+}
+
+func (ue *UEContext) GetStateCM() int {
+	return ue.StateCM
+}
+
+func (ue *UEContext) recordStateCM(stateCM string) {
+	events.Emit(events.Event{Type: events.UeState, Msin: ue.GetMsin(), Supi: ue.GetSupi(), StateCM: stateCM})
+}
+
+func (ue *UEContext) recordStateMM(stateMM string) {
+	monitoring.SetUeState(ue.GetMsin(), stateMM)
+	events.Emit(events.Event{Type: events.UeState, Msin: ue.GetMsin(), Supi: ue.GetSupi(), StateMM: stateMM})
+}
+
+// RecordPduSessionState records the new 5GSM state of a PDU Session for the metrics and the events.
+func (ue *UEContext) RecordPduSessionState(pduSessionId uint8, stateSM string) {
+	monitoring.SetPduSessionState(ue.GetMsin(), pduSessionId, stateSM)
+	events.Emit(events.Event{Type: events.PduSessionState, Msin: ue.GetMsin(), Supi: ue.GetSupi(), PduSessionId: pduSessionId, StateSM: stateSM})
+}
+
+// RecordNasMessage emits an event for a NAS message sent or received by the UE.
+func (ue *UEContext) RecordNasMessage(direction string, messageType uint8, securityHeaderType uint8) {
+	if !events.Enabled() {
+		return
+	}
+	count := ue.UeSecurity.DLCount.Get()
+	if direction == events.Uplink {
+		count = ue.UeSecurity.ULCount.Get()
+	}
+	events.Emit(events.Event{Type: events.Nas, Msin: ue.GetMsin(), Supi: ue.GetSupi(), Nas: &events.NasInfo{
+		Direction:          direction,
+		MessageType:        events.NasMessageType(messageType),
+		SecurityHeaderType: securityHeaderType,
+		Count:              count,
+	}})
+}
+
+// SendPduSessionState notifies the scenario of the state of a PDU Session
+func (ue *UEContext) SendPduSessionState(pduSession *UEPDUSession) {
+	ue.scenarioChan <- scenario.ScenarioMessage{
+		StateChange:  ue.StateMM,
+		PduSessionId: pduSession.Id,
+		StateSM:      pduSession.GetStateSM(),
+		Ip:           pduSession.GetIp(),
+	}
+}
+
 func (ue *UEContext) GetStateMM() int {
 	return ue.StateMM
 }
@@ -271,6 +374,14 @@ func (ue *UEContext) GetGnbTx() chan context.UEMessage {
 	return ue.gnbTx
 }
 
+func (ue *UEContext) SetServingGnb(servingGnb chan context.UEMessage) {
+	ue.servingGnb = servingGnb
+}
+
+func (ue *UEContext) GetServingGnb() chan context.UEMessage {
+	return ue.servingGnb
+}
+
 func (ue *UEContext) Lock() {
 	ue.lock.Lock()
 }
@@ -284,7 +395,7 @@ func (ue *UEContext) IsTunnelEnabled() bool {
 }
 
 func (ue *UEContext) GetPduSession(pduSessionid uint8) (*UEPDUSession, error) {
-	if pduSessionid > 15 || ue.PduSession[pduSessionid-1] == nil {
+	if pduSessionid == 0 || pduSessionid > 16 || ue.PduSession[pduSessionid-1] == nil {
 		return nil, errors.New("Unable to find GnbPDUSession ID " + string(pduSessionid))
 	}
 	return ue.PduSession[pduSessionid-1], nil
@@ -302,20 +413,43 @@ func (ue *UEContext) GetPduSessions() [16]*context.GnbPDUSession {
 	return pduSessions
 }
 
+// GetPduSessionStatus returns the PDU Session Status of the UE, a bitmap of its established PDU Sessions, TS 24.501 9.11.3.44.
+func (ue *UEContext) GetPduSessionStatus() [2]uint8 {
+	var status [2]uint8
+	for _, pduSession := range ue.PduSession {
+		if pduSession != nil && pduSession.Id < 16 && pduSession.GetStateSM() == SM5G_PDU_SESSION_ACTIVE {
+			status[pduSession.Id/8] |= 1 << (pduSession.Id % 8)
+		}
+	}
+	return status
+}
+
 func (ue *UEContext) DeletePduSession(pduSessionid uint8) error {
-	if pduSessionid > 15 || ue.PduSession[pduSessionid-1] == nil {
+	if pduSessionid == 0 || pduSessionid > 16 || ue.PduSession[pduSessionid-1] == nil {
 		return errors.New("Unable to find GnbPDUSession ID " + string(pduSessionid))
 	}
 	pduSession := ue.PduSession[pduSessionid-1]
+	ue.scenarioChan <- scenario.ScenarioMessage{StateChange: ue.StateMM, PduSessionId: pduSessionid, StateSM: SM5G_PDU_SESSION_INACTIVE}
 	close(pduSession.Wait)
 	stopSignal := pduSession.GetStopSignal()
 	if stopSignal != nil {
 		stopSignal <- true
 	}
 	ue.PduSession[pduSessionid-1] = nil
+	monitoring.RemovePduSession(ue.GetMsin(), pduSessionid)
+	events.Emit(events.Event{Type: events.PduSessionState, Msin: ue.GetMsin(), Supi: ue.GetSupi(), PduSessionId: pduSessionid, StateSM: "released"})
 	return nil
 }
 
+// ReleasePduSessions releases locally every PDU Session of the UE, eg: once deregistered.
+func (ue *UEContext) ReleasePduSessions() {
+	for i := uint8(1); i <= 16; i++ {
+		if ue.PduSession[i-1] != nil {
+			ue.DeletePduSession(i)
+		}
+	}
+}
+
 func (pduSession *UEPDUSession) SetIp(ip [12]uint8) {
 	pduSession.ueIP = fmt.Sprintf("%d.%d.%d.%d", ip[0], ip[1], ip[2], ip[3])
 }
@@ -489,10 +623,64 @@ func (ue *UEContext) EncodeUeSuci() (uint8, uint8, uint8, uint8, uint8) {
 	}
 }
 
+// suciProtection is the protection scheme of the SUCI, and the home network public key it is concealed for.
+type suciProtection struct {
+	scheme                 uint8
+	homeNetworkPublicKeyId uint8
+	homeNetworkPublicKey   []byte
+}
+
+// SetSuciProtection sets the ECIES protection scheme the MSIN of the SUCI is concealed with, for the home network public
+// key identified by homeNetworkPublicKeyId, TS 33.501 6.12.2. The SUCI is left with the null scheme for protection
+// scheme 0.
+func (ue *UEContext) SetSuciProtection(protectionScheme uint8, homeNetworkPublicKeyId uint8, homeNetworkPublicKey []byte) error {
+	protection := suciProtection{protectionScheme, homeNetworkPublicKeyId, homeNetworkPublicKey}
+	if protectionScheme != uint8(nasMessage.ProtectionSchemeNullScheme) {
+		// the key is checked once, the SUCI is concealed again each time it is sent, see GetSuci
+		if _, err := ue.concealSuci(protection); err != nil {
+			return err
+		}
+	}
+	ue.UeSecurity.suciProtection = protection
+	return nil
+}
+
+func (ue *UEContext) concealSuci(protection suciProtection) (nasType.MobileIdentity5GS, error) {
+	// the scheme input is the MSIN encoded as with the null scheme
+	buffer := ue.UeSecurity.Suci.Buffer
+	schemeOutput, err := auth.ConcealSchemeInput(protection.scheme, protection.homeNetworkPublicKey, buffer[8:])
+	if err != nil {
+		return nasType.MobileIdentity5GS{}, err
+	}
+	buffer = append([]uint8{buffer[0], buffer[1], buffer[2], buffer[3], buffer[4], buffer[5], protection.scheme, protection.homeNetworkPublicKeyId}, schemeOutput...)
+	return nasType.MobileIdentity5GS{
+		Len:    uint16(len(buffer)),
+		Buffer: buffer,
+	}, nil
+}
+
 func (ue *UEContext) SetAmfRegionId(amfRegionId uint8) {
 	ue.amfInfo.amfRegionId = amfRegionId
 }
 
+func (ue *UEContext) SetAmfPlmn(plmn [3]uint8) {
+	ue.amfInfo.amfPlmn = plmn
+}
+
+// GetGuami returns the GUAMI of the AMF serving the UE, taken from its 5G-GUTI.
+// It returns nil if no 5G-GUTI was allocated to the UE.
+func (ue *UEContext) GetGuami() *context.Guami {
+	if ue.amfInfo.amfPlmn == [3]uint8{} {
+		return nil
+	}
+	return &context.Guami{
+		Plmn:     ue.amfInfo.amfPlmn,
+		RegionId: ue.amfInfo.amfRegionId,
+		SetId:    ue.amfInfo.amfSetId,
+		Pointer:  ue.amfInfo.amfPointer,
+	}
+}
+
 func (ue *UEContext) GetAmfRegionId() uint8 {
 	return ue.amfInfo.amfRegionId
 }
@@ -532,10 +720,177 @@ func (ue *UEContext) Get5gGuti() [4]uint8 {
 	return ue.UeSecurity.Guti
 }
 
+// Get5gSTmsi returns the 5G-S-TMSI of the UE, see context.FiveGSTmsi, or an empty string if the UE has no 5G-GUTI.
+func (ue *UEContext) Get5gSTmsi() string {
+	if ue.GetGuami() == nil {
+		return ""
+	}
+	return context.FiveGSTmsi(ue.GetAmfSetId(), ue.GetAmfPointer(), ue.Get5gGuti())
+}
+
 func (ue *UEContext) Set5gGuti(guti [4]uint8) {
 	ue.UeSecurity.Guti = guti
 }
 
+// Get5gGutiMobileIdentity returns the 5G-GUTI of the UE as a 5GS mobile identity, TS 24.501 9.11.3.4.
+func (ue *UEContext) Get5gGutiMobileIdentity() nasType.MobileIdentity5GS {
+	guti := ue.Get5gGuti()
+	buffer := []uint8{0xf0 | nasMessage.MobileIdentity5GSType5gGuti}
+	buffer = append(buffer, ue.amfInfo.amfPlmn[:]...)
+	buffer = append(buffer, ue.amfInfo.amfRegionId, uint8(ue.amfInfo.amfSetId>>2), uint8(ue.amfInfo.amfSetId&0x03)<<6|ue.amfInfo.amfPointer&0x3f)
+	buffer = append(buffer, guti[:]...)
+	return nasType.MobileIdentity5GS{Len: uint16(len(buffer)), Buffer: buffer}
+}
+
+// DeleteGuti deletes the 5G-GUTI of the UE, which then registers with its SUCI.
+func (ue *UEContext) DeleteGuti() {
+	ue.amfInfo.amfPlmn = [3]uint8{}
+	ue.Set5gGuti([4]uint8{})
+}
+
+// DeleteRegistration deletes the 5G-GUTI, TAI list and ngKSI of a UE rejected or deregistered by the network, it
+// registers again with its SUCI and is authenticated, TS 24.501 5.5.1.2.5 and 5.5.2.3.4.
+func (ue *UEContext) DeleteRegistration() {
+	ue.DeleteGuti()
+	ue.SetTaiList(nil)
+	ue.SetNgKsi(uint8(nasMessage.NasKeySetIdentifierNoKeyIsAvailable))
+}
+
+// SetNgKsi sets the key set identifier of the NAS security context of the UE.
+func (ue *UEContext) SetNgKsi(ngKsi uint8) {
+	ue.ngKsi = ngKsi
+}
+
+func (ue *UEContext) GetNgKsi() uint8 {
+	return ue.ngKsi
+}
+
+// SetUsimInvalid considers the USIM of the UE as invalid for 5GS services, until the UE is stopped.
+func (ue *UEContext) SetUsimInvalid() {
+	ue.usimInvalid = true
+}
+
+func (ue *UEContext) IsUsimInvalid() bool {
+	return ue.usimInvalid
+}
+
+// GetRegistrationMobileIdentity returns the identity of the UE in an initial Registration Request, its last 5G-GUTI, or
+// its SUCI if it has none, TS 24.501 5.5.1.2.2.
+func (ue *UEContext) GetRegistrationMobileIdentity() nasType.MobileIdentity5GS {
+	if ue.GetGuami() != nil {
+		return ue.Get5gGutiMobileIdentity()
+	}
+	return ue.GetSuci()
+}
+
+// GetMobileIdentity returns the identity of identityType of the UE as a 5GS mobile identity, or "no identity" if the UE
+// has none, TS 24.501 9.11.3.4.
+func (ue *UEContext) GetMobileIdentity(identityType uint8) nasType.MobileIdentity5GS {
+	switch identityType {
+	case nasMessage.MobileIdentity5GSTypeSuci:
+		return ue.GetSuci()
+	case nasMessage.MobileIdentity5GSType5gGuti:
+		if ue.GetGuami() != nil {
+			return ue.Get5gGutiMobileIdentity()
+		}
+	case nasMessage.MobileIdentity5GSType5gSTmsi:
+		if ue.GetGuami() != nil {
+			guti := ue.Get5gGuti()
+			buffer := []uint8{0xf0 | nasMessage.MobileIdentity5GSType5gSTmsi}
+			buffer = append(buffer, uint8(ue.amfInfo.amfSetId>>2), uint8(ue.amfInfo.amfSetId&0x03)<<6|ue.amfInfo.amfPointer&0x3f)
+			buffer = append(buffer, guti[:]...)
+			return nasType.MobileIdentity5GS{Len: uint16(len(buffer)), Buffer: buffer}
+		}
+	case nasMessage.MobileIdentity5GSTypeImei:
+		if ue.imei != "" {
+			return encodeDigitsMobileIdentity(identityType, ue.imei)
+		}
+	case nasMessage.MobileIdentity5GSTypeImeisv:
+		if ue.imeisv != "" {
+			return encodeDigitsMobileIdentity(identityType, ue.imeisv)
+		}
+	}
+	return nasType.MobileIdentity5GS{Len: 1, Buffer: []uint8{nasMessage.MobileIdentity5GSTypeNoIdentity}}
+}
+
+// encodeDigitsMobileIdentity encodes an IMEI or IMEISV, the first digit along the type of identity and the odd/even
+// indication, and the next ones in BCD, filled with 'f' when their number is odd.
+func encodeDigitsMobileIdentity(identityType uint8, digits string) nasType.MobileIdentity5GS {
+	oddIndication := uint8(len(digits)%2) << 3
+	buffer := []uint8{(digits[0]-'0')<<4 | oddIndication | identityType}
+	for i := 1; i < len(digits); i += 2 {
+		octet := 0xf0 | (digits[i] - '0')
+		if i+1 < len(digits) {
+			octet = (digits[i+1]-'0')<<4 | (digits[i] - '0')
+		}
+		buffer = append(buffer, octet)
+	}
+	return nasType.MobileIdentity5GS{Len: uint16(len(buffer)), Buffer: buffer}
+}
+
+// SetPei sets the IMEI and IMEISV of the UE, either one may be empty.
+func (ue *UEContext) SetPei(imei string, imeisv string) {
+	ue.imei = imei
+	ue.imeisv = imeisv
+}
+
+func (ue *UEContext) SetReRegistrationRequired(reRegistrationRequired bool) {
+	ue.reRegistrationRequired = reRegistrationRequired
+}
+
+func (ue *UEContext) IsReRegistrationRequired() bool {
+	return ue.reRegistrationRequired
+}
+
+func (ue *UEContext) SetRegistrationType(registrationType uint8) {
+	ue.registrationType = registrationType
+}
+
+// GetRegistrationProcedure returns the procedure of the last Registration Request, as reported.
+func (ue *UEContext) GetRegistrationProcedure() report.Procedure {
+	switch ue.registrationType {
+	case nasMessage.RegistrationType5GSMobilityRegistrationUpdating:
+		return report.MobilityRegistrationUpdate
+	case nasMessage.RegistrationType5GSPeriodicRegistrationUpdating:
+		return report.PeriodicRegistrationUpdate
+	}
+	return report.Registration
+}
+
+func (ue *UEContext) SetServingTai(tai []byte) {
+	ue.servingTai = tai
+}
+
+func (ue *UEContext) GetServingTai() []byte {
+	return ue.servingTai
+}
+
+// SetTaiList sets the registration area of the UE, assigned by the AMF.
+func (ue *UEContext) SetTaiList(taiList [][]byte) {
+	ue.taiList = taiList
+}
+
+// IsInTaiList returns true if tai belongs to the registration area of the UE, or if the UE has no registration area.
+func (ue *UEContext) IsInTaiList(tai []byte) bool {
+	if len(ue.taiList) == 0 {
+		return true
+	}
+	for _, registeredTai := range ue.taiList {
+		if bytes.Equal(registeredTai, tai) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ue *UEContext) SetT3512(t3512 time.Duration) {
+	ue.t3512 = t3512
+}
+
+func (ue *UEContext) GetT3512() time.Duration {
+	return ue.t3512
+}
+
 func (ue *UEContext) deriveAUTN(autn []byte, ak []uint8) ([]byte, []byte, []byte) {
 
 	sqn := make([]byte, 6)
@@ -713,6 +1068,19 @@ func (ue *UEContext) SetAuthSubscription(k, opc, op, amf, sqn string) {
 	ue.UeSecurity.AuthenticationSubs.AuthenticationMethod = models.AuthMethod__5_G_AKA
 }
 
+// ReleaseConnection closes the connection of the UE with its gNodeB once its context was released, the UE goes
+// CM-IDLE and keeps its NAS security context and PDU Sessions.
+func (ue *UEContext) ReleaseConnection() {
+	ue.Lock()
+	if ue.gnbRx != nil {
+		close(ue.gnbRx)
+		ue.gnbRx = nil
+	}
+	ue.gnbTx = nil
+	ue.Unlock()
+	ue.SetStateCM_IDLE()
+}
+
 func (ue *UEContext) Terminate() {
 	ue.SetStateMM_NULL()
 
@@ -746,6 +1114,7 @@ func (ue *UEContext) Terminate() {
 	}
 	ue.Unlock()
 	close(ue.scenarioChan)
+	monitoring.RemoveUe(ue.GetMsin())
 
 	log.Info("[UE] UE Terminated")
 }
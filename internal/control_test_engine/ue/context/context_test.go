@@ -0,0 +1,56 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package context
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"my5G-RANTester/internal/common/auth"
+	"testing"
+
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSuciConcealedOnEachCall(t *testing.T) {
+	profileA := uint8(nasMessage.ProtectionSchemeECIESProfileA)
+	schemeInput := []uint8{0x00, 0x00, 0x00, 0x21, 0x00}
+	ue := &UEContext{}
+	ue.UeSecurity.Suci = nasType.MobileIdentity5GS{
+		Len:    13,
+		Buffer: append([]uint8{0x01, 0x02, 0xf8, 0x39, 0xf0, 0xff, 0x00, 0x00}, schemeInput...),
+	}
+	assert.Equal(t, ue.UeSecurity.Suci, ue.GetSuci())
+
+	homeNetworkKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	err = ue.SetSuciProtection(profileA, 1, homeNetworkKey.PublicKey().Bytes())
+	assert.NoError(t, err)
+
+	first, second := ue.GetSuci(), ue.GetSuci()
+	assert.NotEqual(t, first.Buffer, second.Buffer)
+	for _, suci := range []nasType.MobileIdentity5GS{first, second} {
+		assert.Equal(t, []uint8{0x01, 0x02, 0xf8, 0x39, 0xf0, 0xff, profileA, 0x01}, suci.Buffer[:8])
+		decoded, err := auth.DeconcealSchemeOutput(profileA, homeNetworkKey.Bytes(), suci.Buffer[8:])
+		assert.NoError(t, err)
+		assert.Equal(t, schemeInput, decoded)
+	}
+
+	err = ue.SetSuciProtection(uint8(nasMessage.ProtectionSchemeECIESProfileB), 1, []byte{0x02})
+	assert.Error(t, err)
+}
+
+func TestIsInTaiList(t *testing.T) {
+	ue := &UEContext{}
+	assert.True(t, ue.IsInTaiList([]byte{0x02, 0xf8, 0x39, 0x00, 0x00, 0x01}))
+
+	ue.SetTaiList([][]byte{{0x02, 0xf8, 0x39, 0x00, 0x00, 0x01}, {0x13, 0x00, 0x14, 0x00, 0x00, 0x02}})
+	assert.True(t, ue.IsInTaiList([]byte{0x02, 0xf8, 0x39, 0x00, 0x00, 0x01}))
+	assert.True(t, ue.IsInTaiList([]byte{0x13, 0x00, 0x14, 0x00, 0x00, 0x02}))
+	assert.False(t, ue.IsInTaiList([]byte{0x02, 0xf8, 0x39, 0x00, 0x00, 0x02}))
+	assert.False(t, ue.IsInTaiList([]byte{0x13, 0x00, 0x14, 0x00, 0x00, 0x01}))
+	assert.False(t, ue.IsInTaiList(nil))
+}
@@ -0,0 +1,50 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package service
+
+import (
+	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+const uplinkPollInterval = 100 * time.Millisecond
+
+// WatchUplinkData returns a channel closed once a packet is sent through the tunnel of the UE, eg: by an application
+// running in its VRF, until done is closed. The channel is nil if the UE has no tunnel.
+func WatchUplinkData(ue *context.UEContext, done <-chan struct{}) <-chan struct{} {
+	pduSession, err := ue.GetPduSession(1)
+	if err != nil || pduSession.GetTunInterface() == nil {
+		return nil
+	}
+	index := pduSession.GetTunInterface().Attrs().Index
+	txPackets := func() uint64 {
+		link, err := netlink.LinkByIndex(index)
+		if err != nil || link.Attrs().Statistics == nil {
+			return 0
+		}
+		return link.Attrs().Statistics.TxPackets
+	}
+
+	uplinkData := make(chan struct{})
+	sent := txPackets()
+	go func() {
+		ticker := time.NewTicker(uplinkPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if txPackets() > sent {
+					close(uplinkData)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return uplinkData
+}
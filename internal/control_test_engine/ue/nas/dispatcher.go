@@ -5,8 +5,11 @@
 package nas
 
 import (
+	"errors"
 	"my5G-RANTester/internal/control_test_engine/ue/context"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/handler"
+	"my5G-RANTester/internal/events"
+	"my5G-RANTester/internal/report"
 	"reflect"
 
 	"github.com/free5gc/nas"
@@ -16,14 +19,14 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func DispatchNas(ue *context.UEContext, message []byte) {
+// DispatchNas handles a NAS message from the AMF, it returns an error if the message could not be handled.
+func DispatchNas(ue *context.UEContext, message []byte) error {
 
 	var cph bool
 
 	// check if message is null.
 	if message == nil {
-		// TODO return error
-		log.Fatal("[UE][NAS] NAS message is nil")
+		return errors.New("NAS message is nil")
 	}
 
 	// decode NAS message.
@@ -83,13 +86,13 @@ func DispatchNas(ue *context.UEContext, message []byte) {
 			security.DirectionDownlink, payload)
 		if err != nil {
 			log.Info("NAS MAC calculate error")
-			return
+			return nil
 		}
 
 		// check integrity
 		if !reflect.DeepEqual(mac32, macReceived) {
 			log.Info("[UE][NAS] NAS MAC verification failed(received:", macReceived, "expected:", mac32)
-			return
+			return nil
 		} else {
 			log.Info("[UE][NAS] successful NAS MAC verification")
 		}
@@ -99,7 +102,7 @@ func DispatchNas(ue *context.UEContext, message []byte) {
 			if err = security.NASEncrypt(ue.UeSecurity.CipheringAlg, ue.UeSecurity.KnasEnc, ue.UeSecurity.DLCount.Get(), security.Bearer3GPP,
 				security.DirectionDownlink, payload[1:]); err != nil {
 				log.Info("error in encrypt algorithm")
-				return
+				return nil
 			} else {
 				log.Info("[UE][NAS] successful NAS CIPHERING")
 			}
@@ -127,12 +130,15 @@ func DispatchNas(ue *context.UEContext, message []byte) {
 		}
 	}
 
+	ue.RecordNasMessage(events.Downlink, m.GmmHeader.GetMessageType(), m.SecurityHeaderType)
+
+	var err error
 	switch m.GmmHeader.GetMessageType() {
 
 	case nas.MsgTypeAuthenticationRequest:
 		// handler authentication request.
 		log.Info("[UE][NAS] Receive Authentication Request")
-		handler.HandlerAuthenticationRequest(ue, m)
+		err = handler.HandlerAuthenticationRequest(ue, m)
 
 	case nas.MsgTypeAuthenticationReject:
 		// handler authentication reject.
@@ -142,34 +148,77 @@ func DispatchNas(ue *context.UEContext, message []byte) {
 	case nas.MsgTypeIdentityRequest:
 		log.Info("[UE][NAS] Receive Identify Request")
 		// handler identity request.
-		handler.HandlerIdentityRequest(ue, m)
+		err = handler.HandlerIdentityRequest(ue, m)
 
 	case nas.MsgTypeSecurityModeCommand:
 		// handler security mode command.
 		log.Info("[UE][NAS] Receive Security Mode Command")
-		handler.HandlerSecurityModeCommand(ue, m)
+		err = handler.HandlerSecurityModeCommand(ue, m)
 
 	case nas.MsgTypeRegistrationAccept:
 		// handler registration accept.
 		log.Info("[UE][NAS] Receive Registration Accept")
-		handler.HandlerRegistrationAccept(ue, m)
+		err = handler.HandlerRegistrationAccept(ue, m)
 
 	case nas.MsgTypeConfigurationUpdateCommand:
 		log.Info("[UE][NAS] Receive Configuration Update Command")
-		handler.HandlerConfigurationUpdateCommand(ue, m)
+		err = handler.HandlerConfigurationUpdateCommand(ue, m)
 
 	case nas.MsgTypeDLNASTransport:
 		// handler DL NAS Transport.
 		log.Info("[UE][NAS] Receive DL NAS Transport")
 		handleCause5GMM(m.DLNASTransport.Cause5GMM)
-		handler.HandlerDlNasTransportPduaccept(ue, m)
+		err = handler.HandlerDlNasTransportPduaccept(ue, m)
 
 	case nas.MsgTypeRegistrationReject:
 		// handler registration reject
 		log.Error("[UE][NAS] Receive Registration Reject")
 		handleCause5GMM(&m.RegistrationReject.Cause5GMM)
+		cause := cause5GMMToString(m.RegistrationReject.Cause5GMM.Octet)
+		switch m.RegistrationReject.Cause5GMM.GetCauseValue() {
+		case nasMessage.Cause5GMMIllegalUE, nasMessage.Cause5GMMIllegalME, nasMessage.Cause5GMM5GSServicesNotAllowed:
+			log.Error("[UE][NAS] The USIM is now invalid for 5GS services")
+			ue.DeleteRegistration()
+			ue.SetUsimInvalid()
+		case nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork, nasMessage.Cause5GMMPLMNNotAllowed:
+			// the 5G-GUTI of the UE is no longer valid, the UE registers again with its SUCI
+			ue.DeleteRegistration()
+		}
+		if procedure := ue.GetRegistrationProcedure(); procedure != report.Registration {
+			report.Fail(ue.GetMsin(), procedure, cause)
+			ue.SetStateMM_DEREGISTERED()
+		} else {
+			report.Fail(ue.GetMsin(), report.Authentication, cause)
+			report.Fail(ue.GetMsin(), report.SecurityMode, cause)
+			report.Fail(ue.GetMsin(), report.Registration, cause)
+		}
+
+	case nas.MsgTypeDeregistrationAcceptUEOriginatingDeregistration:
+		log.Info("[UE][NAS] Receive Deregistration Accept")
+		err = handler.HandlerDeregistrationAccept(ue, m)
+
+	case nas.MsgTypeDeregistrationRequestUETerminatedDeregistration:
+		log.Info("[UE][NAS] Receive Deregistration Request")
+		handleCause5GMM(m.DeregistrationRequestUETerminatedDeregistration.Cause5GMM)
+		err = handler.HandlerDeregistrationRequest(ue, m)
+
+	case nas.MsgTypeServiceAccept:
+		log.Info("[UE][NAS] Receive Service Accept")
+		err = handler.HandlerServiceAccept(ue, m)
+
+	case nas.MsgTypeServiceReject:
+		log.Error("[UE][NAS] Receive Service Reject")
+		handleCause5GMM(&m.ServiceReject.Cause5GMM)
+		report.Fail(ue.GetMsin(), report.ServiceRequest, cause5GMMToString(m.ServiceReject.Cause5GMM.Octet))
+		handler.HandlerServiceReject(ue, m)
 	}
 
+	var messageErr *handler.MessageError
+	if errors.As(err, &messageErr) {
+		// the 5GMM Status is protected as the invalid message
+		messageErr.Protected = m.SecurityHeaderType != nas.SecurityHeaderTypePlainNas
+	}
+	return err
 }
 
 func handleCause5GMM(cause5GMM *nasType.Cause5GMM) {
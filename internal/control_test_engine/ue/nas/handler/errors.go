@@ -0,0 +1,38 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package handler
+
+import (
+	"github.com/free5gc/nas/nasMessage"
+)
+
+// MessageError is an invalid 5GMM message, the UE answers it with a 5GMM Status of Cause, TS 24.501 7.
+type MessageError struct {
+	Cause     uint8
+	Reason    string
+	Protected bool // whether the invalid message was security protected
+}
+
+func (err *MessageError) Error() string {
+	return err.Reason
+}
+
+// PduSessionError is an invalid 5GSM message, which only fails its PDU Session.
+type PduSessionError struct {
+	PduSessionId uint8
+	Reason       string
+}
+
+func (err *PduSessionError) Error() string {
+	return err.Reason
+}
+
+func missingIe(reason string) error {
+	return &MessageError{Cause: nasMessage.Cause5GMMInvalidMandatoryInformation, Reason: reason}
+}
+
+func invalidIe(reason string) error {
+	return &MessageError{Cause: nasMessage.Cause5GMMSemanticallyIncorrectMessage, Reason: reason}
+}
@@ -12,6 +12,7 @@ import (
 	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control/mm_5gs"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/message/sender"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/trigger"
+	"my5G-RANTester/internal/report"
 	"reflect"
 	"time"
 
@@ -24,54 +25,58 @@ import (
 func HandlerAuthenticationReject(ue *context.UEContext, message *nas.Message) {
 
 	log.Info("[UE][NAS] Authentication of UE ", ue.GetUeId(), " failed")
+	report.Fail(ue.GetMsin(), report.Authentication, "Authentication Reject")
+	report.Fail(ue.GetMsin(), report.Registration, "Authentication Reject")
 
 	ue.SetStateMM_DEREGISTERED()
 }
 
-func HandlerAuthenticationRequest(ue *context.UEContext, message *nas.Message) {
+func HandlerAuthenticationRequest(ue *context.UEContext, message *nas.Message) error {
 	var authenticationResponse []byte
 
 	// check the mandatory fields
 	if reflect.ValueOf(message.AuthenticationRequest.ExtendedProtocolDiscriminator).IsZero() {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Extended Protocol is missing")
+		return missingIe("Error in Authentication Request, Extended Protocol is missing")
 	}
 
 	if message.AuthenticationRequest.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Extended Protocol not the expected value")
+		return invalidIe("Error in Authentication Request, Extended Protocol not the expected value")
 	}
 
 	if message.AuthenticationRequest.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Spare Half Octet not the expected value")
+		return invalidIe("Error in Authentication Request, Spare Half Octet not the expected value")
 	}
 
 	if message.AuthenticationRequest.SpareHalfOctetAndSecurityHeaderType.GetSecurityHeaderType() != 0 {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Security Header Type not the expected value")
+		return invalidIe("Error in Authentication Request, Security Header Type not the expected value")
 	}
 
 	if reflect.ValueOf(message.AuthenticationRequest.AuthenticationRequestMessageIdentity).IsZero() {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Message Type is missing")
+		return missingIe("Error in Authentication Request, Message Type is missing")
 	}
 
 	if message.AuthenticationRequest.AuthenticationRequestMessageIdentity.GetMessageType() != 86 {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Message Type not the expected value")
+		return invalidIe("Error in Authentication Request, Message Type not the expected value")
 	}
 
 	if message.AuthenticationRequest.SpareHalfOctetAndNgksi.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Authentication Request, Spare Half Octet not the expected value")
+		return invalidIe("Error in Authentication Request, Spare Half Octet not the expected value")
 	}
 
 	if message.AuthenticationRequest.SpareHalfOctetAndNgksi.GetNasKeySetIdentifiler() == 7 {
-		log.Fatal("[UE][NAS] Error in Authentication Request, ngKSI not the expected value")
+		return invalidIe("Error in Authentication Request, ngKSI not the expected value")
 	}
 
 	if reflect.ValueOf(message.AuthenticationRequest.ABBA).IsZero() {
-		log.Fatal("[UE][NAS] Error in Authentication Request, ABBA is missing")
+		return missingIe("Error in Authentication Request, ABBA is missing")
 	}
 
 	if message.AuthenticationRequest.GetABBAContents() == nil {
-		log.Fatal("[UE][NAS] Error in Authentication Request, ABBA Content is missing")
+		return missingIe("Error in Authentication Request, ABBA Content is missing")
 	}
 
+	report.Start(ue.GetMsin(), report.Authentication)
+
 	// getting RAND and AUTN from the message.
 	rand := message.AuthenticationRequest.GetRANDValue()
 	autn := message.AuthenticationRequest.GetAUTN()
@@ -88,6 +93,7 @@ func HandlerAuthenticationRequest(ue *context.UEContext, message *nas.Message) {
 		log.Info("[UE][NAS][MAC] Authenticity of the authentication request message: FAILED")
 		log.Info("[UE][NAS] Send authentication failure with MAC failure")
 		authenticationResponse = mm_5gs.AuthenticationFailure("MAC failure", "", paramAutn)
+		report.Fail(ue.GetMsin(), report.Authentication, "MAC failure")
 		// not change the state of UE.
 
 	case "SQN failure":
@@ -95,6 +101,7 @@ func HandlerAuthenticationRequest(ue *context.UEContext, message *nas.Message) {
 		log.Info("[UE][NAS][SQN] SQN of the authentication request message: INVALID")
 		log.Info("[UE][NAS] Send authentication failure with Synch failure")
 		authenticationResponse = mm_5gs.AuthenticationFailure("SQN failure", "", paramAutn)
+		report.Fail(ue.GetMsin(), report.Authentication, "SQN failure")
 		// not change the state of UE.
 
 	case "successful":
@@ -103,6 +110,7 @@ func HandlerAuthenticationRequest(ue *context.UEContext, message *nas.Message) {
 		log.Info("[UE][NAS][SQN] SQN of the authentication request message: VALID")
 		log.Info("[UE][NAS] Send authentication response")
 		authenticationResponse = mm_5gs.AuthenticationResponse(paramAutn, "")
+		ue.SetNgKsi(message.AuthenticationRequest.SpareHalfOctetAndNgksi.GetNasKeySetIdentifiler())
 
 		// change state of UE for registered-initiated
 		ue.SetStateMM_REGISTERED_INITIATED()
@@ -110,49 +118,54 @@ func HandlerAuthenticationRequest(ue *context.UEContext, message *nas.Message) {
 
 	// sending to GNB
 	sender.SendToGnb(ue, authenticationResponse)
+	return nil
 }
 
-func HandlerSecurityModeCommand(ue *context.UEContext, message *nas.Message) {	// check the mandatory fields
+func HandlerSecurityModeCommand(ue *context.UEContext, message *nas.Message) error {	// check the mandatory fields
 	if reflect.ValueOf(message.SecurityModeCommand.ExtendedProtocolDiscriminator).IsZero() {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Extended Protocol is missing")
+		return missingIe("Error in Security Mode Command, Extended Protocol is missing")
 	}
 
 	if message.SecurityModeCommand.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Extended Protocol not the expected value")
+		return invalidIe("Error in Security Mode Command, Extended Protocol not the expected value")
 	}
 
 	if message.SecurityModeCommand.SpareHalfOctetAndSecurityHeaderType.GetSecurityHeaderType() != 0 {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Security Header Type not the expected value")
+		return invalidIe("Error in Security Mode Command, Security Header Type not the expected value")
 	}
 
 	if message.SecurityModeCommand.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Spare Half Octet not the expected value")
+		return invalidIe("Error in Security Mode Command, Spare Half Octet not the expected value")
 	}
 
 	if reflect.ValueOf(message.SecurityModeCommand.SecurityModeCommandMessageIdentity).IsZero() {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Message Type is missing")
+		return missingIe("Error in Security Mode Command, Message Type is missing")
 	}
 
 	if message.SecurityModeCommand.SecurityModeCommandMessageIdentity.GetMessageType() != 93 {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Message Type not the expected value")
+		return invalidIe("Error in Security Mode Command, Message Type not the expected value")
 	}
 
 	if reflect.ValueOf(message.SecurityModeCommand.SelectedNASSecurityAlgorithms).IsZero() {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, NAS Security Algorithms is missing")
+		return missingIe("Error in Security Mode Command, NAS Security Algorithms is missing")
 	}
 
 	if message.SecurityModeCommand.SpareHalfOctetAndNgksi.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Spare Half Octet is missing")
+		return missingIe("Error in Security Mode Command, Spare Half Octet is missing")
 	}
 
 	if message.SecurityModeCommand.SpareHalfOctetAndNgksi.GetNasKeySetIdentifiler() == 7 {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, ngKSI not the expected value")
+		return invalidIe("Error in Security Mode Command, ngKSI not the expected value")
 	}
 
 	if reflect.ValueOf(message.SecurityModeCommand.ReplayedUESecurityCapabilities).IsZero() {
-		log.Fatal("[UE][NAS] Error in Security Mode Command, Replayed UE Security Capabilities is missing")
+		return missingIe("Error in Security Mode Command, Replayed UE Security Capabilities is missing")
 	}
-	
+
+	// the AMF only sends a Security Mode Command once the UE is authenticated
+	report.Succeed(ue.GetMsin(), report.Authentication)
+	report.Start(ue.GetMsin(), report.SecurityMode)
+
 	ue.UeSecurity.CipheringAlg = message.SecurityModeCommand.SelectedNASSecurityAlgorithms.GetTypeOfCipheringAlgorithm()
 	switch ue.UeSecurity.CipheringAlg {
 	case 0:
@@ -181,61 +194,85 @@ func HandlerSecurityModeCommand(ue *context.UEContext, message *nas.Message) {	/
 	// getting NAS Security Mode Complete.
 	securityModeComplete, err := mm_5gs.SecurityModeComplete(ue, rinmr)
 	if err != nil {
-		log.Fatal("[UE][NAS] Error sending Security Mode Complete: ", err)
+		return fmt.Errorf("Error sending Security Mode Complete: %w", err)
 	}
 
 	// sending to GNB
 	sender.SendToGnb(ue, securityModeComplete)
+	return nil
 }
 
-func HandlerRegistrationAccept(ue *context.UEContext, message *nas.Message) {
+func HandlerRegistrationAccept(ue *context.UEContext, message *nas.Message) error {
 	// check the mandatory fields
 	if reflect.ValueOf(message.RegistrationAccept.ExtendedProtocolDiscriminator).IsZero() {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Extended Protocol is missing")
+		return missingIe("Error in Registration Accept, Extended Protocol is missing")
 	}
 
 	if message.RegistrationAccept.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Extended Protocol not the expected value")
+		return invalidIe("Error in Registration Accept, Extended Protocol not the expected value")
 	}
 
 	if message.RegistrationAccept.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Spare Half not the expected value")
+		return invalidIe("Error in Registration Accept, Spare Half not the expected value")
 	}
 
 	if message.RegistrationAccept.SpareHalfOctetAndSecurityHeaderType.GetSecurityHeaderType() != 0 {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Security Header not the expected value")
+		return invalidIe("Error in Registration Accept, Security Header not the expected value")
 	}
 
 	if reflect.ValueOf(message.RegistrationAccept.RegistrationAcceptMessageIdentity).IsZero() {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Message Type is missing")
+		return missingIe("Error in Registration Accept, Message Type is missing")
 	}
 
 	if message.RegistrationAccept.RegistrationAcceptMessageIdentity.GetMessageType() != 66 {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Message Type not the expected value")
+		return invalidIe("Error in Registration Accept, Message Type not the expected value")
 	}
 
 	if reflect.ValueOf(message.RegistrationAccept.RegistrationResult5GS).IsZero() {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Registration Result 5GS is missing")
+		return missingIe("Error in Registration Accept, Registration Result 5GS is missing")
 	}
 
 	if message.RegistrationAccept.RegistrationResult5GS.GetRegistrationResultValue5GS() != 1 {
-		log.Fatal("[UE][NAS] Error in Registration Accept, Registration Result 5GS not the expected value")
+		return invalidIe("Error in Registration Accept, Registration Result 5GS not the expected value")
 	}
 
 	// change the state of ue for registered
 	ue.SetStateMM_REGISTERED()
+	procedure := ue.GetRegistrationProcedure()
+	if procedure == report.Registration {
+		report.Succeed(ue.GetMsin(), report.SecurityMode)
+	}
+	report.Succeed(ue.GetMsin(), procedure)
 
-	// saved 5g GUTI and others information.
-	ue.SetAmfRegionId(message.RegistrationAccept.GetAMFRegionID())
-	ue.SetAmfPointer(message.RegistrationAccept.GetAMFPointer())
-	ue.SetAmfSetId(message.RegistrationAccept.GetAMFSetID())
-	ue.Set5gGuti(message.RegistrationAccept.GetTMSI5G())
+	// saved 5g GUTI and others information, a registration update may keep the 5G-GUTI of the UE.
+	if message.RegistrationAccept.GUTI5G != nil {
+		var plmn [3]uint8
+		copy(plmn[:], message.RegistrationAccept.GUTI5G.Octet[1:4])
+		ue.SetAmfPlmn(plmn)
+		ue.SetAmfRegionId(message.RegistrationAccept.GetAMFRegionID())
+		ue.SetAmfPointer(message.RegistrationAccept.GetAMFPointer())
+		ue.SetAmfSetId(message.RegistrationAccept.GetAMFSetID())
+		ue.Set5gGuti(message.RegistrationAccept.GetTMSI5G())
+	}
+
+	// the registration area and the periodic registration update timer of the UE
+	if message.RegistrationAccept.TAIList != nil {
+		ue.SetTaiList(decodeTaiList(message.RegistrationAccept.TAIList.GetPartialTrackingAreaIdentityList()))
+	}
+	if message.RegistrationAccept.T3512Value != nil {
+		t3512 := message.RegistrationAccept.T3512Value
+		ue.SetT3512(decodeGprsTimer3(t3512.GetUnit(), t3512.GetTimerValue()))
+		log.Info("[UE][NAS] T3512: ", ue.GetT3512())
+	}
 
 	// use the slice allowed by the network
 	// in PDU session request
 	if ue.Snssai.Sst == 0 {
 
 		// check the allowed NSSAI received from the 5GC
+		if message.RegistrationAccept.AllowedNSSAI == nil {
+			return missingIe("Error in Registration Accept, Allowed NSSAI is missing")
+		}
 		snssai := message.RegistrationAccept.AllowedNSSAI.GetSNSSAIValue()
 
 		// update UE slice selected for PDU Session
@@ -247,57 +284,63 @@ func HandlerRegistrationAccept(ue *context.UEContext, message *nas.Message) {
 
 	log.Info("[UE][NAS] UE 5G GUTI: ", ue.Get5gGuti())
 
+	// a registration update is only completed if a new 5G-GUTI was assigned
+	if procedure != report.Registration && message.RegistrationAccept.GUTI5G == nil {
+		return nil
+	}
+
 	// getting NAS registration complete.
 	registrationComplete, err := mm_5gs.RegistrationComplete(ue)
 	if err != nil {
-		log.Fatal("[UE][NAS] Error sending Registration Complete: ", err)
+		return fmt.Errorf("Error sending Registration Complete: %w", err)
 	}
 
 	// sending to GNB
 	sender.SendToGnb(ue, registrationComplete)
+	return nil
 }
 
-func HandlerDlNasTransportPduaccept(ue *context.UEContext, message *nas.Message) {
+func HandlerDlNasTransportPduaccept(ue *context.UEContext, message *nas.Message) error {
 
 	// check the mandatory fields
 	if reflect.ValueOf(message.DLNASTransport.ExtendedProtocolDiscriminator).IsZero() {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Extended Protocol is missing")
+		return missingIe("Error in DL NAS Transport, Extended Protocol is missing")
 	}
 
 	if message.DLNASTransport.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Extended Protocol not expected value")
+		return invalidIe("Error in DL NAS Transport, Extended Protocol not expected value")
 	}
 
 	if message.DLNASTransport.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Spare Half not expected value")
+		return invalidIe("Error in DL NAS Transport, Spare Half not expected value")
 	}
 
 	if message.DLNASTransport.SpareHalfOctetAndSecurityHeaderType.GetSecurityHeaderType() != 0 {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Security Header not expected value")
+		return invalidIe("Error in DL NAS Transport, Security Header not expected value")
 	}
 
 	if message.DLNASTransport.DLNASTRANSPORTMessageIdentity.GetMessageType() != 104 {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Message Type is missing or not expected value")
+		return missingIe("Error in DL NAS Transport, Message Type is missing or not expected value")
 	}
 
 	if reflect.ValueOf(message.DLNASTransport.SpareHalfOctetAndPayloadContainerType).IsZero() {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Payload Container Type is missing")
+		return missingIe("Error in DL NAS Transport, Payload Container Type is missing")
 	}
 
 	if message.DLNASTransport.SpareHalfOctetAndPayloadContainerType.GetPayloadContainerType() != 1 {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Payload Container Type not expected value")
+		return invalidIe("Error in DL NAS Transport, Payload Container Type not expected value")
 	}
 
 	if reflect.ValueOf(message.DLNASTransport.PayloadContainer).IsZero() || message.DLNASTransport.PayloadContainer.GetPayloadContainerContents() == nil {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, Payload Container is missing")
+		return missingIe("Error in DL NAS Transport, Payload Container is missing")
 	}
 
 	if reflect.ValueOf(message.DLNASTransport.PduSessionID2Value).IsZero() {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, PDU Session ID is missing")
+		return missingIe("Error in DL NAS Transport, PDU Session ID is missing")
 	}
 
 	if message.DLNASTransport.PduSessionID2Value.GetIei() != 18 {
-		log.Fatal("[UE][NAS] Error in DL NAS Transport, PDU Session ID not expected value")
+		return invalidIe("Error in DL NAS Transport, PDU Session ID not expected value")
 	}
 
 	//getting PDU Session establishment accept.
@@ -306,64 +349,68 @@ func HandlerDlNasTransportPduaccept(ue *context.UEContext, message *nas.Message)
 	switch payloadContainer.GsmHeader.GetMessageType() {
 	case nas.MsgTypePDUSessionEstablishmentAccept:
 		log.Info("[UE][NAS] Receiving PDU Session Establishment Accept")
+		pduSessionId := message.DLNASTransport.PduSessionID2Value.GetPduSessionID2Value()
 
 		// get UE ip
 		pduSessionEstablishmentAccept := payloadContainer.PDUSessionEstablishmentAccept
 
 		// check the mandatory fields
 		if reflect.ValueOf(pduSessionEstablishmentAccept.ExtendedProtocolDiscriminator).IsZero() {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, Extended Protocol Discriminator is missing")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, Extended Protocol Discriminator is missing"}
 		}
 
 		if pduSessionEstablishmentAccept.GetExtendedProtocolDiscriminator() != 46 {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, Extended Protocol Discriminator not expected value")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, Extended Protocol Discriminator not expected value"}
 		}
 
 		if reflect.ValueOf(pduSessionEstablishmentAccept.PDUSessionID).IsZero() {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, PDU Session ID is missing or not expected value")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, PDU Session ID is missing or not expected value"}
 		}
 
 		if reflect.ValueOf(pduSessionEstablishmentAccept.PTI).IsZero() {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, PTI is missing")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, PTI is missing"}
 		}
 
 		if pduSessionEstablishmentAccept.PTI.GetPTI() != 1 {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, PTI not the expected value")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, PTI not the expected value"}
 		}
 
 		if pduSessionEstablishmentAccept.PDUSESSIONESTABLISHMENTACCEPTMessageIdentity.GetMessageType() != 194 {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, Message Type is missing or not expected value")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, Message Type is missing or not expected value"}
 		}
 
 		if reflect.ValueOf(pduSessionEstablishmentAccept.SelectedSSCModeAndSelectedPDUSessionType).IsZero() {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, SSC Mode or PDU Session Type is missing")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, SSC Mode or PDU Session Type is missing"}
 		}
 
 		if pduSessionEstablishmentAccept.SelectedSSCModeAndSelectedPDUSessionType.GetPDUSessionType() != 1 {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, PDU Session Type not the expected value")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, PDU Session Type not the expected value"}
 		}
 
 		if reflect.ValueOf(pduSessionEstablishmentAccept.AuthorizedQosRules).IsZero() {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, Authorized QoS Rules is missing")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, Authorized QoS Rules is missing"}
 		}
 
 		if reflect.ValueOf(pduSessionEstablishmentAccept.SessionAMBR).IsZero() {
-			log.Fatal("[UE][NAS] Error in PDU Session Establishment Accept, Session AMBR is missing")
+			return &PduSessionError{PduSessionId: pduSessionId, Reason: "Error in PDU Session Establishment Accept, Session AMBR is missing"}
 		}
 
 		// update PDU Session information.
-		pduSessionId := pduSessionEstablishmentAccept.GetPDUSessionID()
+		pduSessionId = pduSessionEstablishmentAccept.GetPDUSessionID()
 		pduSession, err := ue.GetPduSession(pduSessionId)
-		// change the state of ue(SM)(PDU Session Active).
-		pduSession.SetStateSM_PDU_SESSION_ACTIVE()
 		if err != nil {
 			log.Error("[UE][NAS] Receiving PDU Session Establishment Accept about an unknown PDU Session, id: ", pduSessionId)
-			return
+			return nil
 		}
+		// change the state of ue(SM)(PDU Session Active).
+		pduSession.SetStateSM_PDU_SESSION_ACTIVE()
+		ue.RecordPduSessionState(pduSessionId, "SM5G_PDU_SESSION_ACTIVE")
 
 		// get UE IP
 		UeIp := pduSessionEstablishmentAccept.GetPDUAddressInformation()
 		pduSession.SetIp(UeIp)
+		ue.SendPduSessionState(pduSession)
+		report.SucceedPduSession(ue.GetMsin(), report.PduSessionEstablishment, pduSessionId)
 
 		// get QoS Rules
 		QosRule := pduSessionEstablishmentAccept.AuthorizedQosRules.GetQosRule()
@@ -389,6 +436,7 @@ func HandlerDlNasTransportPduaccept(ue *context.UEContext, message *nas.Message)
 			break
 		}
 		ue.DeletePduSession(pduSessionId)
+		report.SucceedPduSession(ue.GetMsin(), report.PduSessionRelease, pduSessionId)
 		log.Info("[UE][NAS] Successfully released PDU Session ", pduSessionId, " from UE Context")
 		trigger.InitPduSessionReleaseComplete(ue, pduSession)
 
@@ -398,7 +446,9 @@ func HandlerDlNasTransportPduaccept(ue *context.UEContext, message *nas.Message)
 		pduSessionEstablishmentReject := payloadContainer.PDUSessionEstablishmentReject
 		pduSessionId := pduSessionEstablishmentReject.GetPDUSessionID()
 
-		log.Error("[UE][NAS] PDU Session Establishment Reject for PDU Session ID ", pduSessionId, ", 5GSM Cause: ", cause5GSMToString(pduSessionEstablishmentReject.GetCauseValue()))
+		cause := cause5GSMToString(pduSessionEstablishmentReject.GetCauseValue())
+		log.Error("[UE][NAS] PDU Session Establishment Reject for PDU Session ID ", pduSessionId, ", 5GSM Cause: ", cause)
+		report.FailPduSession(ue.GetMsin(), report.PduSessionEstablishment, pduSessionId, cause)
 
 		// Per 5GSM state machine in TS 24.501 - 6.1.3.2.1., we re-try the setup until it's successful
 		pduSession, err := ue.GetPduSession(pduSessionId)
@@ -421,79 +471,199 @@ func HandlerDlNasTransportPduaccept(ue *context.UEContext, message *nas.Message)
 	default:
 		log.Error("[UE][NAS] Receiving Unknown Dl NAS Transport message!! ", payloadContainer.GsmHeader.GetMessageType())
 	}
+	return nil
 }
 
-func HandlerIdentityRequest(ue *context.UEContext, message *nas.Message) {
+func HandlerIdentityRequest(ue *context.UEContext, message *nas.Message) error {
 
 	// check the mandatory fields
 	if reflect.ValueOf(message.IdentityRequest.ExtendedProtocolDiscriminator).IsZero() {
-		log.Fatal("[UE][NAS] Error in Identity Request, Extended Protocol is missing")
+		return missingIe("Error in Identity Request, Extended Protocol is missing")
 	}
 
 	if message.IdentityRequest.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
-		log.Fatal("[UE][NAS] Error in Identity Request, Extended Protocol not the expected value")
+		return invalidIe("Error in Identity Request, Extended Protocol not the expected value")
 	}
 
 	if message.IdentityRequest.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Identity Request, Spare Half Octet not the expected value")
+		return invalidIe("Error in Identity Request, Spare Half Octet not the expected value")
 	}
 
 	if message.IdentityRequest.SpareHalfOctetAndSecurityHeaderType.GetSecurityHeaderType() != 0 {
-		log.Fatal("[UE][NAS] Error in Identity Request, Security Header Type not the expected value")
+		return invalidIe("Error in Identity Request, Security Header Type not the expected value")
 	}
 
 	if reflect.ValueOf(message.IdentityRequest.IdentityRequestMessageIdentity).IsZero() {
-		log.Fatal("[UE][NAS] Error in Identity Request, Message Type is missing")
+		return missingIe("Error in Identity Request, Message Type is missing")
 	}
 
 	if message.IdentityRequest.IdentityRequestMessageIdentity.GetMessageType() != 91 {
-		log.Fatal("[UE][NAS] Error in Identity Request, Message Type not the expected value")
+		return invalidIe("Error in Identity Request, Message Type not the expected value")
 	}
 
 	if reflect.ValueOf(message.IdentityRequest.SpareHalfOctetAndIdentityType).IsZero() {
-		log.Fatal("[UE][NAS] Error in Identity Request, Spare Half Octet And Identity Type is missing")
-	}
-
-
-	switch message.IdentityRequest.GetTypeOfIdentity() {
-		case 1:
-			log.Info("[UE][NAS] Requested SUCI 5GS type")
-		default:
-			log.Fatal("[UE][NAS] Only SUCI identity is supported for now inside PacketRusher")
+		return missingIe("Error in Identity Request, Spare Half Octet And Identity Type is missing")
+	}
+
+
+	identityType := message.IdentityRequest.GetTypeOfIdentity()
+	switch identityType {
+	case nasMessage.MobileIdentity5GSTypeSuci:
+		log.Info("[UE][NAS] Requested SUCI 5GS type")
+	case nasMessage.MobileIdentity5GSType5gGuti:
+		log.Info("[UE][NAS] Requested 5G-GUTI 5GS type")
+	case nasMessage.MobileIdentity5GSTypeImei:
+		log.Info("[UE][NAS] Requested IMEI 5GS type")
+	case nasMessage.MobileIdentity5GSType5gSTmsi:
+		log.Info("[UE][NAS] Requested 5G-S-TMSI 5GS type")
+	case nasMessage.MobileIdentity5GSTypeImeisv:
+		log.Info("[UE][NAS] Requested IMEISV 5GS type")
+	default:
+		return &MessageError{Cause: nasMessage.Cause5GMMInformationElementNonExistentOrNotImplemented, Reason: fmt.Sprint("Identity type ", identityType, " is not supported for now inside PacketRusher")}
 	}
 
-	trigger.InitIdentifyResponse(ue)
+	// an identity the UE does not have is answered with "no identity"
+	trigger.InitIdentifyResponse(ue, identityType, message.SecurityHeaderType != nas.SecurityHeaderTypePlainNas)
+	return nil
 }
 
-func HandlerConfigurationUpdateCommand(ue *context.UEContext, message *nas.Message) {
+func HandlerConfigurationUpdateCommand(ue *context.UEContext, message *nas.Message) error {
 
 	// check the mandatory fields
 	if reflect.ValueOf(message.ConfigurationUpdateCommand.ExtendedProtocolDiscriminator).IsZero() {
-		log.Fatal("[UE][NAS] Error in Configuration Update Command, Extended Protocol Discriminator is missing")
+		return missingIe("Error in Configuration Update Command, Extended Protocol Discriminator is missing")
 	}
 
 	if message.ConfigurationUpdateCommand.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
-		log.Fatal("[UE][NAS] Error in Configuration Update Command, Extended Protocol Discriminator not the expected value")
+		return invalidIe("Error in Configuration Update Command, Extended Protocol Discriminator not the expected value")
 	}
 
 	if message.ConfigurationUpdateCommand.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
-		log.Fatal("[UE][NAS] Error in Configuration Update Command, Spare Half not the expected value")
+		return invalidIe("Error in Configuration Update Command, Spare Half not the expected value")
 	}
 
 	if message.ConfigurationUpdateCommand.SpareHalfOctetAndSecurityHeaderType.GetSecurityHeaderType() != 0 {
-		log.Fatal("[UE][NAS] Error in Configuration Update Command, Security Header not the expected value")
+		return invalidIe("Error in Configuration Update Command, Security Header not the expected value")
 	}
 
 	if reflect.ValueOf(message.ConfigurationUpdateCommand.ConfigurationUpdateCommandMessageIdentity).IsZero() {
-		log.Fatal("[UE][NAS] Error in Configuration Update Command, Message type not the expected value")
+		return invalidIe("Error in Configuration Update Command, Message type not the expected value")
 	}
 
 	if message.ConfigurationUpdateCommand.ConfigurationUpdateCommandMessageIdentity.GetMessageType() != 84 {
-		log.Fatal("[UE][NAS] Error in Configuration Update Command, Message Type not the expected value")
+		return invalidIe("Error in Configuration Update Command, Message Type not the expected value")
 	}
 
 	// return configuration update complete
 	trigger.InitConfigurationUpdateComplete(ue)
+	return nil
+}
+
+func HandlerServiceAccept(ue *context.UEContext, message *nas.Message) error {
+
+	// check the mandatory fields
+	if reflect.ValueOf(message.ServiceAccept.ExtendedProtocolDiscriminator).IsZero() {
+		return missingIe("Error in Service Accept, Extended Protocol Discriminator is missing")
+	}
+
+	if message.ServiceAccept.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
+		return invalidIe("Error in Service Accept, Extended Protocol Discriminator not the expected value")
+	}
+
+	if message.ServiceAccept.SpareHalfOctetAndSecurityHeaderType.GetSpareHalfOctet() != 0 {
+		return invalidIe("Error in Service Accept, Spare Half not the expected value")
+	}
+
+	if message.ServiceAccept.ServiceAcceptMessageIdentity.GetMessageType() != nas.MsgTypeServiceAccept {
+		return invalidIe("Error in Service Accept, Message Type not the expected value")
+	}
+
+	if ue.GetStateMM() != context.MM5G_SERVICE_REQ_INIT {
+		return &MessageError{Cause: nasMessage.Cause5GMMMessageNotCompatibleWithTheProtocolState, Reason: "Service Accept received without any Service Request"}
+	}
+
+	if message.ServiceAccept.PDUSessionReactivationResult != nil {
+		// a PSI set to 1 is a PDU Session whose user-plane resources could not be re-established
+		log.Warn("[UE][NAS] PDU Session Reactivation Result: ", message.ServiceAccept.PDUSessionReactivationResult.Buffer)
+	}
+
+	// the UE is back to CM-CONNECTED
+	ue.SetStateMM_REGISTERED()
+	report.Succeed(ue.GetMsin(), report.ServiceRequest)
+	return nil
+}
+
+// HandlerServiceReject leaves the UE registered, unless the network could not identify it anymore, TS 24.501 5.6.1.5.
+func HandlerServiceReject(ue *context.UEContext, message *nas.Message) {
+	switch message.ServiceReject.Cause5GMM.GetCauseValue() {
+	case nasMessage.Cause5GMMIllegalUE, nasMessage.Cause5GMMIllegalME, nasMessage.Cause5GMM5GSServicesNotAllowed,
+		nasMessage.Cause5GMMUEIdentityCannotBeDerivedByTheNetwork, nasMessage.Cause5GMMImplicitlyDeregistered:
+		ue.SetStateMM_DEREGISTERED()
+	default:
+		ue.SetStateMM_REGISTERED()
+	}
+}
+
+// HandlerDeregistrationAccept completes the deregistration initiated by the UE, TS 24.501 5.5.2.2.2.
+func HandlerDeregistrationAccept(ue *context.UEContext, message *nas.Message) error {
+
+	// check the mandatory fields
+	if reflect.ValueOf(message.DeregistrationAcceptUEOriginatingDeregistration.ExtendedProtocolDiscriminator).IsZero() {
+		return missingIe("Error in Deregistration Accept, Extended Protocol Discriminator is missing")
+	}
+
+	if message.DeregistrationAcceptUEOriginatingDeregistration.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
+		return invalidIe("Error in Deregistration Accept, Extended Protocol Discriminator not the expected value")
+	}
+
+	if ue.GetStateMM() != context.MM5G_DEREGISTERED_INIT {
+		return &MessageError{Cause: nasMessage.Cause5GMMMessageNotCompatibleWithTheProtocolState, Reason: "Deregistration Accept received without any Deregistration Request"}
+	}
+
+	ue.ReleasePduSessions()
+	ue.SetStateMM_DEREGISTERED()
+	report.Succeed(ue.GetMsin(), report.Deregistration)
+	return nil
+}
+
+// HandlerDeregistrationRequest accepts the deregistration of the UE by the network, the UE registers again once its
+// connection is released if required, TS 24.501 5.5.2.3.
+func HandlerDeregistrationRequest(ue *context.UEContext, message *nas.Message) error {
+
+	deregistrationRequest := message.DeregistrationRequestUETerminatedDeregistration
+
+	// check the mandatory fields
+	if reflect.ValueOf(deregistrationRequest.ExtendedProtocolDiscriminator).IsZero() {
+		return missingIe("Error in Deregistration Request, Extended Protocol Discriminator is missing")
+	}
+
+	if deregistrationRequest.ExtendedProtocolDiscriminator.GetExtendedProtocolDiscriminator() != 126 {
+		return invalidIe("Error in Deregistration Request, Extended Protocol Discriminator not the expected value")
+	}
+
+	report.Start(ue.GetMsin(), report.NetworkDeregistration)
+	reRegistrationRequired := deregistrationRequest.GetReRegistrationRequired() == 1
+	if reRegistrationRequired {
+		// the 5GMM cause is then ignored
+		log.Info("[UE][NAS] Deregistered by the network, re-registration required")
+	} else if deregistrationRequest.Cause5GMM != nil {
+		switch deregistrationRequest.Cause5GMM.GetCauseValue() {
+		case nasMessage.Cause5GMMIllegalUE, nasMessage.Cause5GMMIllegalME, nasMessage.Cause5GMM5GSServicesNotAllowed:
+			log.Error("[UE][NAS] Deregistered by the network, the USIM is now invalid for 5GS services")
+			ue.DeleteRegistration()
+			ue.SetUsimInvalid()
+		case nasMessage.Cause5GMMPLMNNotAllowed:
+			// the 5G-GUTI of the UE is no longer valid
+			ue.DeleteRegistration()
+		}
+	}
+
+	ue.ReleasePduSessions()
+	trigger.InitDeregistrationAccept(ue)
+	ue.SetStateMM_DEREGISTERED()
+	ue.SetReRegistrationRequired(reRegistrationRequired)
+	report.Succeed(ue.GetMsin(), report.NetworkDeregistration)
+	return nil
 }
 
 func cause5GSMToString(causeValue uint8) string {
@@ -570,3 +740,69 @@ func cause5GSMToString(causeValue uint8) string {
 		return "Service option temporarily out of order."
 	}
 }
+
+// decodeTaiList returns the TAIs, in octets, of the partial tracking area identity lists of a TAI list, TS 24.501
+// 9.11.3.9.
+func decodeTaiList(buffer []uint8) [][]byte {
+	var tais [][]byte
+	for len(buffer) > 0 {
+		listType := (buffer[0] >> 5) & 0x03
+		elements := int(buffer[0]&0x1f) + 1
+		buffer = buffer[1:]
+
+		switch listType {
+		case 0x00:
+			// TACs of one PLMN
+			if len(buffer) < 3+3*elements {
+				return tais
+			}
+			for i := 0; i < elements; i++ {
+				tais = append(tais, append(append([]byte{}, buffer[:3]...), buffer[3+3*i:6+3*i]...))
+			}
+			buffer = buffer[3+3*elements:]
+		case 0x01:
+			// consecutive TACs of one PLMN, starting with the TAC of the list
+			if len(buffer) < 6 {
+				return tais
+			}
+			tac := uint32(buffer[3])<<16 | uint32(buffer[4])<<8 | uint32(buffer[5])
+			for i := uint32(0); i < uint32(elements); i++ {
+				tais = append(tais, append(append([]byte{}, buffer[:3]...), byte((tac+i)>>16), byte((tac+i)>>8), byte(tac+i)))
+			}
+			buffer = buffer[6:]
+		case 0x02:
+			// TAIs of different PLMNs
+			if len(buffer) < 6*elements {
+				return tais
+			}
+			for i := 0; i < elements; i++ {
+				tais = append(tais, append([]byte{}, buffer[6*i:6*i+6]...))
+			}
+			buffer = buffer[6*elements:]
+		default:
+			return tais
+		}
+	}
+	return tais
+}
+
+// decodeGprsTimer3 returns the duration of a GPRS timer 3, or 0 if the timer is deactivated, TS 24.008 10.5.7.4a.
+func decodeGprsTimer3(unit uint8, value uint8) time.Duration {
+	switch unit {
+	case 0x00:
+		return time.Duration(value) * 10 * time.Minute
+	case 0x01:
+		return time.Duration(value) * time.Hour
+	case 0x02:
+		return time.Duration(value) * 10 * time.Hour
+	case 0x03:
+		return time.Duration(value) * 2 * time.Second
+	case 0x04:
+		return time.Duration(value) * 30 * time.Second
+	case 0x05:
+		return time.Duration(value) * time.Minute
+	case 0x06:
+		return time.Duration(value) * 320 * time.Hour
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTaiList(t *testing.T) {
+	plmn := []byte{0x02, 0xf8, 0x39}
+	otherPlmn := []byte{0x13, 0x00, 0x14}
+	tai := func(plmn []byte, tac ...byte) []byte {
+		return append(append([]byte{}, plmn...), tac...)
+	}
+
+	tests := []struct {
+		name   string
+		buffer []uint8
+		tais   [][]byte
+	}{
+		{"type 00, one TAC",
+			[]uint8{0x00, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01},
+			[][]byte{tai(plmn, 0x00, 0x00, 0x01)}},
+		{"type 00, non-consecutive TACs of one PLMN",
+			[]uint8{0x02, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01, 0x00, 0x00, 0x07, 0x01, 0x00, 0x00},
+			[][]byte{tai(plmn, 0x00, 0x00, 0x01), tai(plmn, 0x00, 0x00, 0x07), tai(plmn, 0x01, 0x00, 0x00)}},
+		{"type 01, consecutive TACs of one PLMN",
+			[]uint8{0x22, 0x02, 0xf8, 0x39, 0x00, 0x00, 0xff},
+			[][]byte{tai(plmn, 0x00, 0x00, 0xff), tai(plmn, 0x00, 0x01, 0x00), tai(plmn, 0x00, 0x01, 0x01)}},
+		{"type 10, TAIs of different PLMNs",
+			[]uint8{0x41, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01, 0x13, 0x00, 0x14, 0x00, 0x00, 0x02},
+			[][]byte{tai(plmn, 0x00, 0x00, 0x01), tai(otherPlmn, 0x00, 0x00, 0x02)}},
+		{"several partial lists",
+			[]uint8{0x00, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01, 0x20, 0x13, 0x00, 0x14, 0x00, 0x00, 0x02},
+			[][]byte{tai(plmn, 0x00, 0x00, 0x01), tai(otherPlmn, 0x00, 0x00, 0x02)}},
+		{"empty", []uint8{}, nil},
+		{"type 00, truncated TAC",
+			[]uint8{0x01, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01, 0x00, 0x00},
+			nil},
+		{"type 01, truncated TAC",
+			[]uint8{0x21, 0x02, 0xf8, 0x39, 0x00},
+			nil},
+		{"type 10, truncated TAI",
+			[]uint8{0x41, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01, 0x13, 0x00, 0x14},
+			nil},
+		{"truncated list after a complete one",
+			[]uint8{0x00, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01, 0x40, 0x13},
+			[][]byte{tai(plmn, 0x00, 0x00, 0x01)}},
+		{"reserved type 11",
+			[]uint8{0x60, 0x02, 0xf8, 0x39, 0x00, 0x00, 0x01},
+			nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.tais, decodeTaiList(test.buffer), test.name)
+	}
+}
+
+func TestDecodeGprsTimer3(t *testing.T) {
+	tests := []struct {
+		unit     uint8
+		value    uint8
+		duration time.Duration
+	}{
+		{0x00, 3, 30 * time.Minute},
+		{0x01, 3, 3 * time.Hour},
+		{0x02, 3, 30 * time.Hour},
+		{0x03, 3, 6 * time.Second},
+		{0x04, 3, 90 * time.Second},
+		{0x05, 3, 3 * time.Minute},
+		{0x06, 3, 960 * time.Hour},
+		{0x07, 3, 0},
+		{0x05, 0, 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.duration, decodeGprsTimer3(test.unit, test.value), "unit %03b, value %d", test.unit, test.value)
+	}
+}
@@ -7,6 +7,7 @@ package nas_control
 import (
 	"fmt"
 	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/events"
 
 	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasMessage"
@@ -23,6 +24,7 @@ func EncodeNasPduWithSecurity(ue *context.UEContext, pdu []byte, securityHeaderT
 		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
 		SecurityHeaderType:    securityHeaderType,
 	}
+	ue.RecordNasMessage(events.Uplink, m.GmmHeader.GetMessageType(), securityHeaderType)
 	return NASEncode(ue, m, securityContextAvailable, newSecurityContext)
 }
 
@@ -52,10 +54,14 @@ func NASEncode(ue *context.UEContext, msg *nas.Message, securityContextAvailable
 		}
 
 		// TODO: Support for ue has nas connection in both accessType
-		// make ciphering of NAS message.
-		if err = security.NASEncrypt(ue.UeSecurity.CipheringAlg, ue.UeSecurity.KnasEnc, ue.UeSecurity.ULCount.Get(), security.Bearer3GPP,
-			security.DirectionUplink, payload); err != nil {
-			return
+		// make ciphering of NAS message, unless it is only integrity protected.
+		switch msg.SecurityHeader.SecurityHeaderType {
+		case nas.SecurityHeaderTypeIntegrityProtected, nas.SecurityHeaderTypeIntegrityProtectedWithNew5gNasSecurityContext:
+		default:
+			if err = security.NASEncrypt(ue.UeSecurity.CipheringAlg, ue.UeSecurity.KnasEnc, ue.UeSecurity.ULCount.Get(), security.Bearer3GPP,
+				security.DirectionUplink, payload); err != nil {
+				return
+			}
 		}
 
 		// add sequence number
@@ -78,3 +84,14 @@ func NASEncode(ue *context.UEContext, msg *nas.Message, securityContextAvailable
 	}
 	return
 }
+
+// CipherNasMessageContainer ciphers an initial NAS message sent in the NAS message container of the integrity protected
+// message carrying its cleartext IEs, with the uplink NAS count of that message, TS 24.501 4.4.6.
+func CipherNasMessageContainer(ue *context.UEContext, pdu []byte) ([]byte, error) {
+	contents := append([]byte{}, pdu...)
+	if err := security.NASEncrypt(ue.UeSecurity.CipheringAlg, ue.UeSecurity.KnasEnc, ue.UeSecurity.ULCount.Get(), security.Bearer3GPP,
+		security.DirectionUplink, contents); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
@@ -0,0 +1,52 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package mm_5gs
+
+import (
+	"bytes"
+	"fmt"
+	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+// DeregistrationAccept returns the Deregistration Accept answering a network initiated deregistration, TS 24.501
+// 8.2.15.
+func DeregistrationAccept(ue *context.UEContext) ([]byte, error) {
+
+	pdu := getDeregistrationAccept()
+	pdu, err := nas_control.EncodeNasPduWithSecurity(ue, pdu, nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding %s IMSI UE NAS Deregistration Accept Msg", ue.UeSecurity.Supi)
+	}
+
+	return pdu, nil
+}
+
+func getDeregistrationAccept() (nasPdu []byte) {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration)
+
+	deregistrationAccept := nasMessage.NewDeregistrationAcceptUETerminatedDeregistration(0)
+	deregistrationAccept.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	deregistrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	deregistrationAccept.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	deregistrationAccept.SetMessageType(nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration)
+
+	m.GmmMessage.DeregistrationAcceptUETerminatedDeregistration = deregistrationAccept
+
+	data := new(bytes.Buffer)
+	err := m.GmmMessageEncode(data)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+
+	nasPdu = data.Bytes()
+	return
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/free5gc/nas/nasMessage"
 )
 
-func GetDeregistrationRequest(ue *context.UEContext) (nasPdu []byte) {
+// GetDeregistrationRequest returns a UE originating Deregistration Request, the AMF answers with a Deregistration
+// Accept unless switchOff is set.
+func GetDeregistrationRequest(ue *context.UEContext, switchOff bool) (nasPdu []byte) {
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
 	m.GmmHeader.SetMessageType(nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration)
@@ -23,12 +25,16 @@ func GetDeregistrationRequest(ue *context.UEContext) (nasPdu []byte) {
 	deregistrationRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
 	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
 	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0x00)
-	deregistrationRequest.SetSwitchOff(1)
+	if switchOff {
+		deregistrationRequest.SetSwitchOff(1)
+	} else {
+		deregistrationRequest.SetSwitchOff(0)
+	}
 	deregistrationRequest.SetReRegistrationRequired(0)
 	deregistrationRequest.SetAccessType(1)
 	deregistrationRequest.DeregistrationRequestMessageIdentity.SetMessageType(nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration)
 	deregistrationRequest.NgksiAndDeregistrationType.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
-	deregistrationRequest.NgksiAndDeregistrationType.SetNasKeySetIdentifiler(ue.GetUeId())
+	deregistrationRequest.NgksiAndDeregistrationType.SetNasKeySetIdentifiler(ue.GetNgKsi())
 	deregistrationRequest.MobileIdentity5GS = ue.GetSuci()
 
 	m.GmmMessage.DeregistrationRequestUEOriginatingDeregistration = deregistrationRequest
@@ -7,13 +7,31 @@ package mm_5gs
 import (
 	"bytes"
 	"fmt"
-	"github.com/free5gc/nas/nasType"
 	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control"
+
 	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
 )
 
-func IdentityResponse(ue *context.UEContext) (nasPdu []byte) {
+// IdentityResponse returns an Identity Response with the identity of identityType of the UE, integrity protected and
+// ciphered if the Identity Request was received with a NAS security context, TS 24.501 5.4.3.3.
+func IdentityResponse(ue *context.UEContext, identityType uint8, securityContextAvailable bool) ([]byte, error) {
+
+	pdu := getIdentityResponse(ue, identityType)
+	if !securityContextAvailable {
+		return pdu, nil
+	}
+	pdu, err := nas_control.EncodeNasPduWithSecurity(ue, pdu, nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding %s IMSI UE NAS Identity Response Msg", ue.UeSecurity.Supi)
+	}
+
+	return pdu, nil
+}
+
+func getIdentityResponse(ue *context.UEContext, identityType uint8) (nasPdu []byte) {
 
 	m := nas.NewMessage()
 	m.GmmMessage = nas.NewGmmMessage()
@@ -24,7 +42,7 @@ func IdentityResponse(ue *context.UEContext) (nasPdu []byte) {
 	identityResponse.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
 	identityResponse.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0x00)
 	identityResponse.IdentityResponseMessageIdentity.SetMessageType(nas.MsgTypeIdentityResponse)
-	identityResponse.MobileIdentity = nasType.MobileIdentity(ue.GetSuci())
+	identityResponse.MobileIdentity = nasType.MobileIdentity(ue.GetMobileIdentity(identityType))
 
 	m.GmmMessage.IdentityResponse = identityResponse
 
@@ -36,4 +54,4 @@ func IdentityResponse(ue *context.UEContext) (nasPdu []byte) {
 
 	nasPdu = data.Bytes()
 	return
-}
\ No newline at end of file
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control"
 
 	"github.com/free5gc/nas"
 	"github.com/free5gc/nas/nasMessage"
@@ -28,9 +29,9 @@ func GetRegistrationRequest(registrationType uint8, requestedNSSAI *nasType.Requ
 	registrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0x00)
 	registrationRequest.RegistrationRequestMessageIdentity.SetMessageType(nas.MsgTypeRegistrationRequest)
 	registrationRequest.NgksiAndRegistrationType5GS.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
-	registrationRequest.NgksiAndRegistrationType5GS.SetNasKeySetIdentifiler(ue.GetUeId())
+	registrationRequest.NgksiAndRegistrationType5GS.SetNasKeySetIdentifiler(ue.GetNgKsi())
 	registrationRequest.NgksiAndRegistrationType5GS.SetRegistrationType5GS(registrationType)
-	registrationRequest.MobileIdentity5GS = ue.GetSuci()
+	registrationRequest.MobileIdentity5GS = ue.GetRegistrationMobileIdentity()
 	if capability {
 		registrationRequest.Capability5GMM = &nasType.Capability5GMM{
 			Iei:   nasMessage.RegistrationRequestCapability5GMMType,
@@ -57,3 +58,69 @@ func GetRegistrationRequest(registrationType uint8, requestedNSSAI *nasType.Requ
 	nasPdu = data.Bytes()
 	return
 }
+
+// RegistrationUpdateRequest returns an integrity protected Registration Request for a mobility or periodic
+// registration update, identifying the UE with its 5G-GUTI, TS 24.501 5.5.1.3. Only the cleartext IEs are sent as is,
+// the whole Registration Request is ciphered in its NAS message container, TS 24.501 4.4.6.
+func RegistrationUpdateRequest(registrationType uint8, ue *context.UEContext) ([]byte, error) {
+
+	nasMessageContainer, err := nas_control.CipherNasMessageContainer(ue, getRegistrationUpdateRequest(registrationType, ue, nil))
+	if err != nil {
+		return nil, fmt.Errorf("Error ciphering %s IMSI UE NAS Registration Request Msg", ue.UeSecurity.Supi)
+	}
+	pdu := getRegistrationUpdateRequest(registrationType, ue, nasMessageContainer)
+	pdu, err = nas_control.EncodeNasPduWithSecurity(ue, pdu, nas.SecurityHeaderTypeIntegrityProtected, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding %s IMSI UE NAS Registration Request Msg", ue.UeSecurity.Supi)
+	}
+
+	return pdu, nil
+}
+
+// getRegistrationUpdateRequest returns the cleartext IEs of the Registration Request and nasMessageContainer, or the
+// whole Registration Request if nasMessageContainer is nil.
+func getRegistrationUpdateRequest(registrationType uint8, ue *context.UEContext, nasMessageContainer []byte) (nasPdu []byte) {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeRegistrationRequest)
+
+	registrationRequest := nasMessage.NewRegistrationRequest(0)
+	registrationRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	registrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	registrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0x00)
+	registrationRequest.RegistrationRequestMessageIdentity.SetMessageType(nas.MsgTypeRegistrationRequest)
+	registrationRequest.NgksiAndRegistrationType5GS.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
+	registrationRequest.NgksiAndRegistrationType5GS.SetNasKeySetIdentifiler(ue.GetNgKsi())
+	registrationRequest.NgksiAndRegistrationType5GS.SetRegistrationType5GS(registrationType)
+	registrationRequest.MobileIdentity5GS = ue.Get5gGutiMobileIdentity()
+	registrationRequest.UESecurityCapability = ue.GetUeSecurityCapability()
+
+	if nasMessageContainer != nil {
+		registrationRequest.NASMessageContainer = nasType.NewNASMessageContainer(nasMessage.RegistrationRequestNASMessageContainerType)
+		registrationRequest.NASMessageContainer.SetLen(uint16(len(nasMessageContainer)))
+		registrationRequest.NASMessageContainer.SetNASMessageContainerContents(nasMessageContainer)
+	} else {
+		// the established PDU Sessions, kept by the AMF
+		pduSessionStatus := ue.GetPduSessionStatus()
+		registrationRequest.PDUSessionStatus = nasType.NewPDUSessionStatus(nasMessage.RegistrationRequestPDUSessionStatusType)
+		registrationRequest.PDUSessionStatus.SetLen(2)
+		copy(registrationRequest.PDUSessionStatus.Buffer, pduSessionStatus[:])
+	}
+
+	// a UE moving in CM-CONNECTED keeps its connection, a periodic registration update has nothing to follow
+	if registrationType == nasMessage.RegistrationType5GSMobilityRegistrationUpdating {
+		registrationRequest.SetFOR(1)
+	}
+
+	m.GmmMessage.RegistrationRequest = registrationRequest
+
+	data := new(bytes.Buffer)
+	err := m.GmmMessageEncode(data)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+
+	nasPdu = data.Bytes()
+	return
+}
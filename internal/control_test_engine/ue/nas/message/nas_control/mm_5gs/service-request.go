@@ -0,0 +1,87 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package mm_5gs
+
+import (
+	"bytes"
+	"fmt"
+	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+)
+
+// ServiceRequest returns an integrity protected Service Request of serviceType, identifying the UE with its 5G-S-TMSI
+// and listing its PDU Sessions, TS 24.501 8.2.16. Only the cleartext IEs are sent as is, the whole Service Request is
+// ciphered in its NAS message container, TS 24.501 4.4.6.
+func ServiceRequest(ue *context.UEContext, serviceType uint8) ([]byte, error) {
+
+	nasMessageContainer, err := nas_control.CipherNasMessageContainer(ue, getServiceRequest(ue, serviceType, nil))
+	if err != nil {
+		return nil, fmt.Errorf("Error ciphering %s IMSI UE NAS Service Request Msg", ue.UeSecurity.Supi)
+	}
+	pdu := getServiceRequest(ue, serviceType, nasMessageContainer)
+	pdu, err = nas_control.EncodeNasPduWithSecurity(ue, pdu, nas.SecurityHeaderTypeIntegrityProtected, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding %s IMSI UE NAS Service Request Msg", ue.UeSecurity.Supi)
+	}
+
+	return pdu, nil
+}
+
+// getServiceRequest returns the cleartext IEs of the Service Request and nasMessageContainer, or the whole Service
+// Request if nasMessageContainer is nil.
+func getServiceRequest(ue *context.UEContext, serviceType uint8, nasMessageContainer []byte) (nasPdu []byte) {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeServiceRequest)
+
+	serviceRequest := nasMessage.NewServiceRequest(0)
+	serviceRequest.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	serviceRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	serviceRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	serviceRequest.ServiceRequestMessageIdentity.SetMessageType(nas.MsgTypeServiceRequest)
+	serviceRequest.ServiceTypeAndNgksi.SetServiceTypeValue(serviceType)
+	serviceRequest.ServiceTypeAndNgksi.SetTSC(nasMessage.TypeOfSecurityContextFlagNative)
+	serviceRequest.ServiceTypeAndNgksi.SetNasKeySetIdentifiler(ue.GetNgKsi())
+
+	// 5G-S-TMSI, the spare bits are set to 1
+	serviceRequest.TMSI5GS.SetLen(7)
+	serviceRequest.TMSI5GS.Octet[0] = 0xf0 | nasMessage.MobileIdentity5GSType5gSTmsi
+	serviceRequest.TMSI5GS.SetAMFSetID(ue.GetAmfSetId())
+	serviceRequest.TMSI5GS.SetAMFPointer(ue.GetAmfPointer())
+	serviceRequest.TMSI5GS.SetTMSI5G(ue.Get5gGuti())
+
+	if nasMessageContainer != nil {
+		serviceRequest.NASMessageContainer = nasType.NewNASMessageContainer(nasMessage.ServiceRequestNASMessageContainerType)
+		serviceRequest.NASMessageContainer.SetLen(uint16(len(nasMessageContainer)))
+		serviceRequest.NASMessageContainer.SetNASMessageContainerContents(nasMessageContainer)
+	} else {
+		// the established PDU Sessions, all of which have uplink data pending when the UE resumes for data
+		pduSessionStatus := ue.GetPduSessionStatus()
+		serviceRequest.PDUSessionStatus = nasType.NewPDUSessionStatus(nasMessage.ServiceRequestPDUSessionStatusType)
+		serviceRequest.PDUSessionStatus.SetLen(2)
+		copy(serviceRequest.PDUSessionStatus.Buffer, pduSessionStatus[:])
+		if serviceType == nasMessage.ServiceTypeData {
+			serviceRequest.UplinkDataStatus = nasType.NewUplinkDataStatus(nasMessage.ServiceRequestUplinkDataStatusType)
+			serviceRequest.UplinkDataStatus.SetLen(2)
+			copy(serviceRequest.UplinkDataStatus.Buffer, pduSessionStatus[:])
+		}
+	}
+
+	m.GmmMessage.ServiceRequest = serviceRequest
+
+	data := new(bytes.Buffer)
+	err := m.GmmMessageEncode(data)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+
+	nasPdu = data.Bytes()
+	return
+}
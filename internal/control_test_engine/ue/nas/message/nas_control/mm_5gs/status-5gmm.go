@@ -0,0 +1,55 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package mm_5gs
+
+import (
+	"bytes"
+	"fmt"
+	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+// Status5GMM returns a 5GMM Status reporting cause, integrity protected and ciphered when protected is set.
+func Status5GMM(ue *context.UEContext, cause uint8, protected bool) ([]byte, error) {
+
+	pdu := getStatus5GMM(cause)
+	if !protected {
+		return pdu, nil
+	}
+	pdu, err := nas_control.EncodeNasPduWithSecurity(ue, pdu, nas.SecurityHeaderTypeIntegrityProtectedAndCiphered, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding %s IMSI UE NAS 5GMM Status Msg", ue.UeSecurity.Supi)
+	}
+
+	return pdu, nil
+}
+
+func getStatus5GMM(cause uint8) (nasPdu []byte) {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeStatus5GMM)
+
+	status5GMM := nasMessage.NewStatus5GMM(0)
+	status5GMM.ExtendedProtocolDiscriminator.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	status5GMM.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	status5GMM.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	status5GMM.STATUSMessageIdentity5GMM.SetMessageType(nas.MsgTypeStatus5GMM)
+	status5GMM.Cause5GMM.SetCauseValue(cause)
+
+	m.GmmMessage.Status5GMM = status5GMM
+
+	data := new(bytes.Buffer)
+	err := m.GmmMessageEncode(data)
+	if err != nil {
+		fmt.Println(err.Error())
+	}
+
+	nasPdu = data.Bytes()
+	return
+}
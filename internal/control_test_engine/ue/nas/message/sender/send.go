@@ -8,9 +8,17 @@ import (
 	log "github.com/sirupsen/logrus"
 	context2 "my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/events"
+
+	"github.com/free5gc/nas"
 )
 
 func SendToGnb(ue *context.UEContext, message []byte) {
+	// messages with a security header are recorded before being ciphered
+	if len(message) > 2 && message[1]&0x0f == nas.SecurityHeaderTypePlainNas {
+		ue.RecordNasMessage(events.Uplink, message[2], nas.SecurityHeaderTypePlainNas)
+	}
+
 	ue.Lock()
 	gnbRx := ue.GetGnbRx()
 	if gnbRx == nil {
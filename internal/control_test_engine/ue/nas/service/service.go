@@ -12,10 +12,41 @@ import (
 )
 
 func InitConn(ue *context.UEContext, gnb *gnbContext.GNBContext) {
-	inboundChannel := gnb.GetInboundChannel()
+	ue.SetServingGnb(gnb.GetInboundChannel())
+	connect(ue)
+}
+
+// Reconnect opens a new connection between a CM-IDLE UE and the gNodeB it is camping on.
+func Reconnect(ue *context.UEContext) {
+	ue.Lock()
+	ue.SetGnbRx(make(chan gnbContext.UEMessage, 1))
+	ue.SetGnbTx(make(chan gnbContext.UEMessage, 1))
+	ue.Unlock()
+	connect(ue)
+}
+
+// Idle releases the connection of the UE whose context was released, the UE goes CM-IDLE and keeps camping on its
+// gNodeB, which pages it through a new GNBTx channel.
+func Idle(ue *context.UEContext) {
+	ue.ReleaseConnection()
+	pagingChannel := make(chan gnbContext.UEMessage, 1)
+	ue.SetGnbTx(pagingChannel)
+	ue.GetServingGnb() <- gnbContext.UEMessage{Idle: true, GNBTx: pagingChannel, Msin: ue.GetMsin(), FiveGSTmsi: ue.Get5gSTmsi()}
+}
+
+// Leave tells the gNodeB a CM-IDLE UE is camping on that the UE is terminated, so that it is no longer paged.
+func Leave(ue *context.UEContext) {
+	if ue.GetStateCM() != context.CM5G_IDLE || ue.Get5gSTmsi() == "" {
+		return
+	}
+	ue.GetServingGnb() <- gnbContext.UEMessage{Terminated: true, Msin: ue.GetMsin(), FiveGSTmsi: ue.Get5gSTmsi()}
+}
 
+func connect(ue *context.UEContext) {
 	// Send channels to gNB
-	inboundChannel <- gnbContext.UEMessage{GNBTx: ue.GetGnbTx(), GNBRx: ue.GetGnbRx(), Msin: ue.GetMsin()}
+	ue.GetServingGnb() <- gnbContext.UEMessage{GNBTx: ue.GetGnbTx(), GNBRx: ue.GetGnbRx(), Msin: ue.GetMsin(), Guami: ue.GetGuami(), FiveGSTmsi: ue.Get5gSTmsi()}
 	msg := <-ue.GetGnbTx()
 	ue.SetAmfMccAndMnc(msg.Mcc, msg.Mnc)
+	ue.SetServingTai(msg.Tai)
+	ue.SetStateCM_CONNECTED()
 }
@@ -14,14 +14,28 @@ import (
 	"my5G-RANTester/internal/control_test_engine/ue/context"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/message/nas_control/mm_5gs"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/message/sender"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/service"
+	"my5G-RANTester/internal/report"
 
 	"github.com/free5gc/nas/nasMessage"
 	log "github.com/sirupsen/logrus"
 )
 
 func InitRegistration(ue *context.UEContext) {
+	if ue.IsUsimInvalid() {
+		// the network rejected or deregistered the UE for good, TS 24.501 5.5.1.2.5
+		log.Error("[UE] Not registering as the USIM is invalid for 5GS services")
+		report.Start(ue.GetMsin(), report.Registration)
+		report.Fail(ue.GetMsin(), report.Registration, "USIM invalid for 5GS services")
+		return
+	}
+
 	log.Info("[UE] Initiating Registration")
 
+	if ue.GetStateCM() == context.CM5G_IDLE {
+		service.Reconnect(ue)
+	}
+
 	// registration procedure started.
 	registrationRequest := mm_5gs.GetRegistrationRequest(
 		nasMessage.RegistrationType5GSInitialRegistration,
@@ -31,18 +45,43 @@ func InitRegistration(ue *context.UEContext) {
 		ue)
 
 	// send to GNB.
+	ue.SetRegistrationType(nasMessage.RegistrationType5GSInitialRegistration)
+	report.Start(ue.GetMsin(), report.Registration)
 	sender.SendToGnb(ue, registrationRequest)
 
 	// change the state of ue for deregistered
 	ue.SetStateMM_DEREGISTERED()
 }
 
+// InitRegistrationUpdate runs a mobility or periodic registration update of a registered UE, with its 5G-GUTI,
+// TS 24.501 5.5.1.3.
+func InitRegistrationUpdate(ue *context.UEContext, registrationType uint8) {
+	log.Info("[UE] Initiating Registration Update")
+
+	registrationRequest, err := mm_5gs.RegistrationUpdateRequest(registrationType, ue)
+	if err != nil {
+		log.Error("[UE][NAS] Error sending Registration Request: ", err)
+		return
+	}
+
+	if ue.GetStateCM() == context.CM5G_IDLE {
+		service.Reconnect(ue)
+	}
+
+	// send to GNB.
+	ue.SetRegistrationType(registrationType)
+	report.Start(ue.GetMsin(), ue.GetRegistrationProcedure())
+	sender.SendToGnb(ue, registrationRequest)
+
+	ue.SetStateMM_REGISTERED_INITIATED()
+}
+
 func InitPduSessionRequest(ue *context.UEContext) {
 	log.Info("[UE] Initiating New PDU Session")
 
 	pduSession, err := ue.CreatePDUSession()
 	if err != nil {
-		log.Fatal("[UE][NAS] ", err)
+		log.Error("[UE][NAS] ", err)
 		return
 	}
 
@@ -54,13 +93,16 @@ func InitPduSessionRequestInner(ue *context.UEContext, pduSession *context.UEPDU
 
 	ulNasTransport, err := mm_5gs.Request_UlNasTransport(pduSession, ue)
 	if err != nil {
-		log.Fatal("[UE][NAS] Error sending ul nas transport and pdu session establishment request: ", err)
+		log.Error("[UE][NAS] Error sending ul nas transport and pdu session establishment request: ", err)
+		return
 	}
 
 	// change the state of ue(SM).
 	pduSession.SetStateSM_PDU_SESSION_PENDING()
+	ue.RecordPduSessionState(pduSession.Id, "SM5G_PDU_SESSION_ACTIVE_PENDING")
 
 	// sending to GNB
+	report.StartPduSession(ue.GetMsin(), report.PduSessionEstablishment, pduSession.Id)
 	sender.SendToGnb(ue, ulNasTransport)
 }
 
@@ -74,13 +116,16 @@ func InitPduSessionRelease(ue *context.UEContext, pduSession *context.UEPDUSessi
 
 	ulNasTransport, err := mm_5gs.Release_UlNasTransport(pduSession, ue)
 	if err != nil {
-		log.Fatal("[UE][NAS] Error sending ul nas transport and pdu session establishment request: ", err)
+		log.Error("[UE][NAS] Error sending ul nas transport and pdu session establishment request: ", err)
+		return
 	}
 
 	// change the state of ue(SM).
 	pduSession.SetStateSM_PDU_SESSION_INACTIVE()
+	ue.RecordPduSessionState(pduSession.Id, "SM5G_PDU_SESSION_INACTIVE")
 
 	// sending to GNB
+	report.StartPduSession(ue.GetMsin(), report.PduSessionRelease, pduSession.Id)
 	sender.SendToGnb(ue, ulNasTransport)
 }
 
@@ -94,26 +139,74 @@ func InitPduSessionReleaseComplete(ue *context.UEContext, pduSession *context.UE
 
 	ulNasTransport, err := mm_5gs.ReleasComplete_UlNasTransport(pduSession, ue)
 	if err != nil {
-		log.Fatal("[UE][NAS] Error sending ul nas transport and pdu session establishment request: ", err)
+		log.Error("[UE][NAS] Error sending ul nas transport and pdu session establishment request: ", err)
+		return
 	}
 
 	// sending to GNB
 	sender.SendToGnb(ue, ulNasTransport)
 }
 
-func InitDeregistration(ue *context.UEContext) {
+// InitDeregistration deregisters the UE, a switched off UE is deregistered right away, any other UE waits for the
+// Deregistration Accept, TS 24.501 5.5.2.2.
+func InitDeregistration(ue *context.UEContext, switchOff bool) {
 	log.Info("[UE] Initiating Deregistration")
 
+	if ue.GetStateCM() == context.CM5G_IDLE {
+		service.Reconnect(ue)
+	}
+
 	// registration procedure started.
-	deregistrationRequest := mm_5gs.GetDeregistrationRequest(ue)
+	deregistrationRequest := mm_5gs.GetDeregistrationRequest(ue, switchOff)
 
 	// send to GNB.
+	report.Start(ue.GetMsin(), report.Deregistration)
 	sender.SendToGnb(ue, deregistrationRequest)
 
+	if !switchOff {
+		ue.SetStateMM_DEREGISTERED_INITIATED()
+		return
+	}
+
+	// switch off deregistration, no Deregistration Accept is expected
+	report.Succeed(ue.GetMsin(), report.Deregistration)
+
 	// change the state of ue for deregistered
 	ue.SetStateMM_DEREGISTERED()
 }
 
+// RetransmitDeregistration retransmits the Deregistration Request of a UE still waiting for the Deregistration Accept
+// once T3521 expires.
+func RetransmitDeregistration(ue *context.UEContext) {
+	log.Warn("[UE] T3521 expired: Retransmitting Deregistration Request")
+
+	deregistrationRequest := mm_5gs.GetDeregistrationRequest(ue, false)
+	sender.SendToGnb(ue, deregistrationRequest)
+}
+
+// AbortDeregistration deregisters the UE locally once T3521 expired for the fifth time, TS 24.501 5.5.2.2.6.
+func AbortDeregistration(ue *context.UEContext) {
+	log.Error("[UE] T3521 expired 5 times: Aborting Deregistration")
+
+	report.Fail(ue.GetMsin(), report.Deregistration, "no Deregistration Accept received")
+	ue.ReleasePduSessions()
+	ue.SetStateMM_DEREGISTERED()
+}
+
+// InitDeregistrationAccept accepts the deregistration of the UE by the network.
+func InitDeregistrationAccept(ue *context.UEContext) {
+	log.Info("[UE] Initiating Deregistration Accept")
+
+	deregistrationAccept, err := mm_5gs.DeregistrationAccept(ue)
+	if err != nil {
+		log.Error("[UE][NAS] Error sending Deregistration Accept: ", err)
+		return
+	}
+
+	// send to GNB.
+	sender.SendToGnb(ue, deregistrationAccept)
+}
+
 func InitHandover(ue *context.UEContext, gnbChan chan gnbContext.UEMessage) {
 	log.Info("[UE] Initiating Handover")
 
@@ -123,11 +216,13 @@ func InitHandover(ue *context.UEContext, gnbChan chan gnbContext.UEMessage) {
 	newGnbTx := make(chan gnbContext.UEMessage, 1)
 	ue.SetGnbRx(newGnbRx)
 	ue.SetGnbTx(newGnbTx)
+	ue.SetServingGnb(gnbChan)
 
 	// Connect to new gNb
-	gnbChan <- gnbContext.UEMessage{GNBPduSessions: ue.GetPduSessions(), GNBRx: newGnbRx, GNBTx: newGnbTx, Msin: ue.GetMsin()}
+	gnbChan <- gnbContext.UEMessage{GNBPduSessions: ue.GetPduSessions(), GNBRx: newGnbRx, GNBTx: newGnbTx, Msin: ue.GetMsin(), Guami: ue.GetGuami()}
 
 	// Trigger Handover
+	report.Start(ue.GetMsin(), report.Handover)
 	ue.GetGnbRx() <- gnbContext.UEMessage{AmfId: ue.GetAmfUeId()}
 
 	// Clear UEContext in previous gNb
@@ -135,11 +230,63 @@ func InitHandover(ue *context.UEContext, gnbChan chan gnbContext.UEMessage) {
 	close(previousGnbRx)
 }
 
-func InitIdentifyResponse(ue *context.UEContext) {
+// InitConnectionRelease signals the inactivity of the UE to its gNodeB, which requests the release of the UE context.
+// The UE then goes CM-IDLE.
+func InitConnectionRelease(ue *context.UEContext) {
+	log.Info("[UE] Initiating Connection Release")
+
+	ue.Lock()
+	gnbRx := ue.GetGnbRx()
+	if gnbRx != nil {
+		gnbRx <- gnbContext.UEMessage{Inactive: true}
+	}
+	ue.Unlock()
+}
+
+// InitServiceRequest brings a CM-IDLE UE back to CM-CONNECTED through the gNodeB it is camping on, TS 24.501 5.6.1.
+func InitServiceRequest(ue *context.UEContext, serviceType uint8) {
+	log.Info("[UE] Initiating Service Request")
+
+	serviceRequest, err := mm_5gs.ServiceRequest(ue, serviceType)
+	if err != nil {
+		log.Error("[UE][NAS] Error sending Service Request: ", err)
+		return
+	}
+
+	service.Reconnect(ue)
+
+	// send to GNB.
+	report.Start(ue.GetMsin(), report.ServiceRequest)
+	sender.SendToGnb(ue, serviceRequest)
+
+	ue.SetStateMM_MM5G_SERVICE_REQ_INIT()
+}
+
+// InitPagingResponse answers the paging of a CM-IDLE UE: a registered UE runs a Service Request for mobile terminated
+// services, any other UE registers, TS 24.501 5.6.2.
+func InitPagingResponse(ue *context.UEContext) {
+	log.Info("[UE] Paged by the network")
+
+	if ue.GetStateCM() != context.CM5G_IDLE {
+		log.Warn("[UE] Ignoring Paging as the UE is not CM-IDLE")
+		return
+	}
+	if ue.GetStateMM() == context.MM5G_REGISTERED {
+		InitServiceRequest(ue, nasMessage.ServiceTypeMobileTerminatedServices)
+		return
+	}
+	InitRegistration(ue)
+}
+
+func InitIdentifyResponse(ue *context.UEContext, identityType uint8, securityContextAvailable bool) {
 	log.Info("[UE] Initiating Identify Response")
 
 	// trigger identity response.
-	identityResponse := mm_5gs.IdentityResponse(ue)
+	identityResponse, err := mm_5gs.IdentityResponse(ue, identityType, securityContextAvailable)
+	if err != nil {
+		log.Error("[UE][NAS] Error sending Identity Response: ", err)
+		return
+	}
 
 	// send to GNB.
 	sender.SendToGnb(ue, identityResponse)
@@ -153,4 +300,18 @@ func InitConfigurationUpdateComplete(ue *context.UEContext) {
 
 	// send to GNB.
 	sender.SendToGnb(ue, identityResponse)
-}
\ No newline at end of file
+}
+
+// InitStatus5GMM reports to the AMF that one of its messages could not be handled, TS 24.501 5.4.6.
+func InitStatus5GMM(ue *context.UEContext, cause uint8, protected bool) {
+	log.Info("[UE] Initiating 5GMM Status")
+
+	status5GMM, err := mm_5gs.Status5GMM(ue, cause, protected)
+	if err != nil {
+		log.Error("[UE][NAS] Error sending 5GMM Status: ", err)
+		return
+	}
+
+	// send to GNB.
+	sender.SendToGnb(ue, status5GMM)
+}
@@ -6,4 +6,9 @@ package scenario
 
 type ScenarioMessage struct {
 	StateChange int
+
+	// Set when the message notifies a change of a PDU Session, StateChange then holds the current 5GMM state
+	PduSessionId uint8
+	StateSM      int
+	Ip           string
 }
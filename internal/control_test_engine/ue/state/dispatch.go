@@ -9,6 +9,6 @@ import (
 	"my5G-RANTester/internal/control_test_engine/ue/nas"
 )
 
-func DispatchState(ue *context.UEContext, message []byte) {
-	nas.DispatchNas(ue, message)
+func DispatchState(ue *context.UEContext, message []byte) error {
+	return nas.DispatchNas(ue, message)
 }
@@ -5,34 +5,50 @@
 package ue
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"my5G-RANTester/config"
 	context2 "my5G-RANTester/internal/control_test_engine/gnb/context"
 	"my5G-RANTester/internal/control_test_engine/procedures"
 	"my5G-RANTester/internal/control_test_engine/ue/context"
 	serviceGtp "my5G-RANTester/internal/control_test_engine/ue/gtp/service"
+	"my5G-RANTester/internal/control_test_engine/ue/nas/handler"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/service"
 	"my5G-RANTester/internal/control_test_engine/ue/nas/trigger"
 	"my5G-RANTester/internal/control_test_engine/ue/scenario"
 	"my5G-RANTester/internal/control_test_engine/ue/state"
-	"os"
-	"os/signal"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/report"
 	"sync"
 	"time"
+
+	"github.com/free5gc/nas/nasMessage"
 )
 
 func NewUE(conf config.Config, id uint8, ueMgrChannel chan procedures.UeTesterMessage, gnb *context2.GNBContext, wg *sync.WaitGroup) chan scenario.ScenarioMessage {
 	// new UE instance.
 	ue := &context.UEContext{}
-	scenarioChan := make(chan scenario.ScenarioMessage)
+	// buffered, so that the UE is not blocked while its scenario is sending it a new procedure
+	scenarioChan := make(chan scenario.ScenarioMessage, 16)
+
+	opc, err := conf.Ue.GetOpc()
+	if err != nil {
+		log.Fatal("[UE][", conf.Ue.Msin, "] ", err)
+	}
+	op := conf.Ue.Op
+	if op == "" {
+		op = "c9e8763286b5b9ffbdf56e1297d0887b"
+	}
 
 	// new UE context
 	ue.NewRanUeContext(
 		conf.Ue.Msin,
 		conf.GetUESecurityCapability(),
 		conf.Ue.Key,
-		conf.Ue.Opc,
-		"c9e8763286b5b9ffbdf56e1297d0887b",
+		opc,
+		op,
 		conf.Ue.Amf,
 		conf.Ue.Sqn,
 		conf.Ue.Hplmn.Mcc,
@@ -45,32 +61,97 @@ func NewUE(conf config.Config, id uint8, ueMgrChannel chan procedures.UeTesterMe
 		scenarioChan,
 		id)
 
+	ue.SetPei(conf.Ue.Imei, conf.Ue.Imeisv)
+
+	protectionScheme := uint8(conf.Ue.Suci.ProtectionScheme)
+	homeNetworkPublicKeyId, homeNetworkPublicKey, err := conf.Ue.Suci.GetHomeNetworkPublicKey()
+	if err == nil {
+		err = ue.SetSuciProtection(protectionScheme, homeNetworkPublicKeyId, homeNetworkPublicKey)
+	}
+	if err != nil {
+		log.Fatal("[UE][", conf.Ue.Msin, "] Unable to conceal the SUCI: ", err)
+	}
+
 	go func() {
 		// starting communication with GNB and listen.
 		service.InitConn(ue, gnb)
-		sigStop := make(chan os.Signal, 1)
-		signal.Notify(sigStop, os.Interrupt)
 
-		// Block until a signal is received.
+		// the UE detaches once the run is stopped, see lifecycle
+		stopped := lifecycle.Context().Done()
+		terminator := &ueTerminator{}
+		watcher := &uplinkDataWatcher{}
+		t3512 := &periodicRegistrationTimer{}
+		t3521 := &deregistrationTimer{}
 		loop := true
 		for loop {
 			select {
 			case msg, open := <-ue.GetGnbTx():
 				if !open {
+					if ue.GetStateMM() == context.MM5G_REGISTERED && !terminator.terminating {
+						log.Info("[UE][", ue.GetMsin(), "] UE Context released by gNB: UE is now CM-IDLE")
+						service.Idle(ue)
+						watcher.start(ue)
+						t3512.start(ue)
+						break
+					}
+					if ue.GetStateMM() == context.MM5G_DEREGISTERED && !terminator.terminating {
+						log.Info("[UE][", ue.GetMsin(), "] UE Context released by gNB after deregistration: UE is now CM-IDLE")
+						ue.ReleaseConnection()
+						if ue.IsReRegistrationRequired() {
+							ue.SetReRegistrationRequired(false)
+							trigger.InitRegistration(ue)
+						}
+						break
+					}
 					log.Error("[UE][", ue.GetMsin(), "] Stopping UE as communication with gNB was closed")
 					ue.SetGnbTx(nil)
 					break
 				}
 				gnbMsgHandler(msg, ue)
+				if terminator.terminating {
+					loop = terminator.deregisterOnceReleased(ue)
+				}
 			case msg, open := <-ueMgrChannel:
 				if !open {
 					log.Warn("[UE][", ue.GetMsin(), "] Stopping UE as communication with scenario was closed")
 					loop = false
 					break
 				}
-				loop = ueMgrHandler(msg, ue)
+				loop = ueMgrHandler(msg, ue, terminator)
+			case <-stopped:
+				stopped = nil
+				loop = terminator.start(ue)
+			case <-terminator.timeout:
+				terminator.deregister(ue)
+				loop = false
+			case <-watcher.uplinkData:
+				log.Info("[UE][", ue.GetMsin(), "] Uplink data while CM-IDLE")
+				watcher.stop()
+				trigger.InitServiceRequest(ue, nasMessage.ServiceTypeData)
+			case <-t3512.expired:
+				log.Info("[UE][", ue.GetMsin(), "] T3512 expired")
+				t3512.stop()
+				trigger.InitRegistrationUpdate(ue, nasMessage.RegistrationType5GSPeriodicRegistrationUpdating)
+			case <-t3521.expired:
+				t3521.retransmitOrAbort(ue)
+				if terminator.terminating {
+					loop = terminator.deregisterOnceReleased(ue)
+				}
+			}
+			if ue.GetStateCM() != context.CM5G_IDLE {
+				watcher.stop()
+				t3512.stop()
+			}
+			if ue.GetStateMM() == context.MM5G_DEREGISTERED_INIT {
+				t3521.start()
+			} else {
+				t3521.stop()
 			}
 		}
+		watcher.stop()
+		t3512.stop()
+		t3521.stop()
+		service.Leave(ue)
 		ue.Terminate()
 		wg.Done()
 	}()
@@ -82,7 +163,18 @@ func gnbMsgHandler(msg context2.UEMessage, ue *context.UEContext) {
 	if msg.IsNas {
 		// handling NAS message.
 		ue.SetAmfUeId(msg.AmfId)
-		state.DispatchState(ue, msg.Nas)
+		if err := state.DispatchState(ue, msg.Nas); err != nil {
+			failUe(ue, err)
+		}
+	} else if msg.Paging {
+		trigger.InitPagingResponse(ue)
+	} else if msg.Tai != nil {
+		// the UE moved to a new gNodeB, outside of its registration area it runs a mobility registration update
+		ue.SetServingTai(msg.Tai)
+		if ue.GetStateMM() == context.MM5G_REGISTERED && !ue.IsInTaiList(msg.Tai) {
+			log.Info("[UE][", ue.GetMsin(), "] TAI ", hex.EncodeToString(msg.Tai), " is outside of the registration area of the UE")
+			trigger.InitRegistrationUpdate(ue, nasMessage.RegistrationType5GSMobilityRegistrationUpdating)
+		}
 	} else if msg.GNBPduSessions[0] != nil {
 		// Setup PDU Session
 		serviceGtp.SetupGtpInterface(ue, msg)
@@ -91,18 +183,55 @@ func gnbMsgHandler(msg context2.UEMessage, ue *context.UEContext) {
 	}
 }
 
-func ueMgrHandler(msg procedures.UeTesterMessage, ue *context.UEContext) bool {
+// failUe isolates the failure of a NAS message to the UE: the UE, or only the PDU Session, is reported as failed, and
+// an invalid 5GMM message is answered with a 5GMM Status. The UE, and the rest of the run, go on.
+func failUe(ue *context.UEContext, err error) {
+	var pduSessionErr *handler.PduSessionError
+	if errors.As(err, &pduSessionErr) {
+		log.Error("[UE][", ue.GetMsin(), "][NAS] PDU Session ", pduSessionErr.PduSessionId, " failed: ", err)
+		report.FailPduSessionOnError(ue.GetMsin(), report.PduSessionEstablishment, pduSessionErr.PduSessionId, err)
+		return
+	}
+
+	log.Error("[UE][", ue.GetMsin(), "][NAS] UE failed: ", err)
+	report.FailUe(ue.GetMsin(), err.Error())
+	var messageErr *handler.MessageError
+	if errors.As(err, &messageErr) {
+		trigger.InitStatus5GMM(ue, messageErr.Cause, messageErr.Protected)
+	}
+	if ue.GetStateMM() != context.MM5G_REGISTERED {
+		// the registration failed
+		ue.SetStateMM_DEREGISTERED()
+	}
+}
+
+func ueMgrHandler(msg procedures.UeTesterMessage, ue *context.UEContext, terminator *ueTerminator) bool {
 	loop := true
+	if terminator.terminating && msg.Type != procedures.Kill {
+		log.Warn("[UE][", ue.GetMsin(), "] Ignoring procedure ", msg.Type, " as the UE is terminating")
+		return loop
+	}
+	if ue.GetStateCM() == context.CM5G_IDLE {
+		switch msg.Type {
+		case procedures.NewPDUSession, procedures.DestroyPDUSession, procedures.Handover, procedures.ConnectionRelease:
+			log.Warn("[UE][", ue.GetMsin(), "] Ignoring procedure ", msg.Type, " as the UE is CM-IDLE")
+			return loop
+		}
+	}
 	switch msg.Type {
 	case procedures.Registration:
 		trigger.InitRegistration(ue)
 	case procedures.Deregistration:
-		trigger.InitDeregistration(ue)
+		if state := ue.GetStateMM(); state == context.MM5G_DEREGISTERED || state == context.MM5G_DEREGISTERED_INIT {
+			log.Warn("[UE][", ue.GetMsin(), "] Ignoring Deregistration as the UE is not registered")
+			break
+		}
+		trigger.InitDeregistration(ue, false)
 	case procedures.NewPDUSession:
 		trigger.InitPduSessionRequest(ue)
 	case procedures.DestroyPDUSession:
 		pdu, err := ue.GetPduSession(msg.Param)
-		if err == nil {
+		if err != nil {
 			log.Error("[UE] Cannot release unknown PDU Session ID ", msg.Param)
 			return loop
 		}
@@ -120,29 +249,180 @@ func ueMgrHandler(msg procedures.UeTesterMessage, ue *context.UEContext) bool {
 			break
 		}
 		trigger.InitHandover(ue, msg.GnbChan)
+	case procedures.ConnectionRelease:
+		trigger.InitConnectionRelease(ue)
+	case procedures.ServiceRequest:
+		if ue.GetStateCM() != context.CM5G_IDLE || ue.GetStateMM() != context.MM5G_REGISTERED {
+			log.Warn("[UE][", ue.GetMsin(), "] Ignoring Service Request as the UE is not registered and CM-IDLE")
+			break
+		}
+		// the PDU Sessions of the UE are reactivated, if any
+		serviceType := nasMessage.ServiceTypeSignalling
+		if ue.GetPduSessionStatus() != [2]uint8{} {
+			serviceType = nasMessage.ServiceTypeData
+		}
+		trigger.InitServiceRequest(ue, serviceType)
 	case procedures.Terminate:
 		log.Info("[UE] Terminating UE as requested")
-		// If UE is registered
-		if ue.GetStateMM() == context.MM5G_REGISTERED {
-			// Release PDU Sessions
-			for i := uint8(1); i <= 16; i++ {
-				pduSession, _ := ue.GetPduSession(i)
-				if pduSession != nil {
-					trigger.InitPduSessionRelease(ue, pduSession)
-					select {
-					case <-pduSession.Wait:
-					case <-time.After(5 * time.Millisecond):
-						// If still unregistered after 5 ms, continue
-					}
-				}
-			}
-			// Initiate Deregistration
-			trigger.InitDeregistration(ue)
-		}
-		// Else, nothing to do
-		loop = false
+		loop = terminator.start(ue)
 	case procedures.Kill:
 		loop = false
 	}
 	return loop
-}
\ No newline at end of file
+}
+
+// ueTerminator releases the PDU Sessions of a registered UE, then deregisters it once they are released, or once the
+// drain timeout is over.
+type ueTerminator struct {
+	terminating bool
+	timeout     <-chan time.Time
+}
+
+// start starts the termination, it returns false if the UE can stop right away.
+func (terminator *ueTerminator) start(ue *context.UEContext) bool {
+	if terminator.terminating {
+		return true
+	}
+	if ue.GetStateMM() == context.MM5G_DEREGISTERED_INIT {
+		// the UE waits for the Deregistration Accept
+		terminator.terminating = true
+		terminator.timeout = time.After(lifecycle.DrainTimeout())
+		return true
+	}
+	if ue.GetStateMM() != context.MM5G_REGISTERED {
+		// nothing to detach
+		return false
+	}
+
+	terminator.terminating = true
+	if ue.GetStateCM() == context.CM5G_IDLE {
+		// the switch off deregistration also releases the PDU Sessions of a CM-IDLE UE
+		trigger.InitDeregistration(ue, true)
+		return false
+	}
+	for i := uint8(1); i <= 16; i++ {
+		pduSession, _ := ue.GetPduSession(i)
+		if pduSession != nil {
+			trigger.InitPduSessionRelease(ue, pduSession)
+		}
+	}
+	terminator.timeout = time.After(lifecycle.DrainTimeout())
+	return terminator.deregisterOnceReleased(ue)
+}
+
+// deregisterOnceReleased deregisters the UE once every PDU Session is released, it returns false once deregistered.
+func (terminator *ueTerminator) deregisterOnceReleased(ue *context.UEContext) bool {
+	if ue.GetStateMM() == context.MM5G_DEREGISTERED_INIT || len(activePduSessions(ue)) > 0 {
+		return true
+	}
+	terminator.deregister(ue)
+	return false
+}
+
+func (terminator *ueTerminator) deregister(ue *context.UEContext) {
+	if pduSessionIds := activePduSessions(ue); len(pduSessionIds) > 0 {
+		log.Warn("[UE][", ue.GetMsin(), "] PDU Sessions ", pduSessionIds, " not released before the drain timeout")
+		report.DetachFailed(ue.GetMsin(), fmt.Sprint("PDU Sessions ", pduSessionIds, " not released"))
+	}
+	if ue.GetStateMM() == context.MM5G_DEREGISTERED_INIT {
+		log.Warn("[UE][", ue.GetMsin(), "] Deregistration Accept not received before the drain timeout")
+		report.DetachFailed(ue.GetMsin(), "Deregistration Accept not received")
+	}
+	if ue.GetStateMM() == context.MM5G_REGISTERED {
+		trigger.InitDeregistration(ue, true)
+	}
+}
+
+// activePduSessions returns the IDs of the PDU Sessions which are established or being released.
+func activePduSessions(ue *context.UEContext) []uint8 {
+	var pduSessionIds []uint8
+	for i := uint8(1); i <= 16; i++ {
+		if pduSession, _ := ue.GetPduSession(i); pduSession != nil {
+			pduSessionIds = append(pduSessionIds, i)
+		}
+	}
+	return pduSessionIds
+}
+
+// uplinkDataWatcher watches the uplink data of a CM-IDLE UE, which then runs a Service Request.
+type uplinkDataWatcher struct {
+	uplinkData <-chan struct{}
+	done       chan struct{}
+}
+
+func (watcher *uplinkDataWatcher) start(ue *context.UEContext) {
+	if !ue.IsTunnelEnabled() {
+		return
+	}
+	watcher.done = make(chan struct{})
+	watcher.uplinkData = serviceGtp.WatchUplinkData(ue, watcher.done)
+}
+
+func (watcher *uplinkDataWatcher) stop() {
+	if watcher.done != nil {
+		close(watcher.done)
+		watcher.done = nil
+	}
+	watcher.uplinkData = nil
+}
+
+// periodicRegistrationTimer is T3512, started once the UE goes CM-IDLE, the UE runs a periodic registration update
+// when it expires, TS 24.501 5.3.7.
+type periodicRegistrationTimer struct {
+	timer   *time.Timer
+	expired <-chan time.Time
+}
+
+func (t3512 *periodicRegistrationTimer) start(ue *context.UEContext) {
+	t3512.stop()
+	if ue.GetT3512() <= 0 {
+		return
+	}
+	t3512.timer = time.NewTimer(ue.GetT3512())
+	t3512.expired = t3512.timer.C
+}
+
+func (t3512 *periodicRegistrationTimer) stop() {
+	if t3512.timer != nil {
+		t3512.timer.Stop()
+		t3512.timer = nil
+	}
+	t3512.expired = nil
+}
+
+// deregistrationTimer is T3521, started once the UE sends a Deregistration Request, the request is retransmitted on
+// the first four expiries, and the deregistration aborted on the fifth, TS 24.501 5.5.2.2.6.
+type deregistrationTimer struct {
+	timer    *time.Timer
+	expired  <-chan time.Time
+	expiries int
+}
+
+const t3521Duration = 15 * time.Second
+
+func (t3521 *deregistrationTimer) start() {
+	if t3521.timer != nil {
+		return
+	}
+	t3521.expiries = 0
+	t3521.timer = time.NewTimer(t3521Duration)
+	t3521.expired = t3521.timer.C
+}
+
+func (t3521 *deregistrationTimer) retransmitOrAbort(ue *context.UEContext) {
+	t3521.expiries++
+	if t3521.expiries < 5 {
+		trigger.RetransmitDeregistration(ue)
+		t3521.timer.Reset(t3521Duration)
+		return
+	}
+	trigger.AbortDeregistration(ue)
+}
+
+func (t3521 *deregistrationTimer) stop() {
+	if t3521.timer != nil {
+		t3521.timer.Stop()
+		t3521.timer = nil
+	}
+	t3521.expired = nil
+}
@@ -0,0 +1,166 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+
+// Package events
+// Events are JSON lines describing what each UE and gNodeB did during a run, eg: state transitions, NAS and NGAP messages
+// and errors. They are only written when a stream was opened with Open.
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of events.
+const (
+	UeState         = "ue-state"
+	PduSessionState = "pdu-session-state"
+	UeContext       = "ue-context" // a gNodeB allocated a RAN UE NGAP ID to a UE
+	Nas             = "nas"
+	Ngap            = "ngap"
+	Error           = "error"
+)
+
+// Directions of messages.
+const (
+	Uplink   = "uplink"
+	Downlink = "downlink"
+)
+
+type Event struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	Msin         string    `json:"msin,omitempty"`
+	Supi         string    `json:"supi,omitempty"`
+	Gnb          string    `json:"gnb,omitempty"`
+	StateMM      string    `json:"stateMM,omitempty"`
+	StateCM      string    `json:"stateCM,omitempty"`
+	PduSessionId uint8     `json:"pduSessionId,omitempty"`
+	StateSM      string    `json:"stateSM,omitempty"`
+	Nas          *NasInfo  `json:"nas,omitempty"`
+	Ngap         *NgapInfo `json:"ngap,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type NasInfo struct {
+	Direction          string `json:"direction"`
+	MessageType        string `json:"messageType"`
+	SecurityHeaderType uint8  `json:"securityHeaderType"`
+	Count              uint32 `json:"count"` // UL or DL NAS COUNT of the UE
+}
+
+type NgapInfo struct {
+	Direction   string `json:"direction,omitempty"`
+	Procedure   string `json:"procedure,omitempty"`
+	MessageType string `json:"messageType,omitempty"`
+	RanUeNgapId int64  `json:"ranUeNgapId,omitempty"`
+	AmfUeNgapId int64  `json:"amfUeNgapId,omitempty"`
+}
+
+var (
+	mu       sync.RWMutex
+	stream   chan Event
+	written  chan struct{}
+	writeErr error
+)
+
+// Open starts writing the events to the file path, until Close.
+func Open(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create event stream %s: %w", path, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	stream = make(chan Event, 4096)
+	written = make(chan struct{})
+	go write(file, stream, written)
+	log.AddHook(errorHook{})
+
+	log.Info("[TESTER] Writing events to ", path)
+	return nil
+}
+
+// write must not log, as the errors logged are written as events.
+func write(file *os.File, stream chan Event, written chan struct{}) {
+	var err error
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for event := range stream {
+		if encodeErr := encoder.Encode(event); encodeErr != nil && err == nil {
+			err = encodeErr
+		}
+		// flush when the stream is idle, so that the file can be followed
+		if len(stream) == 0 {
+			writer.Flush()
+		}
+	}
+	if flushErr := writer.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	file.Close()
+	writeErr = err
+	close(written)
+}
+
+// Close writes the pending events and closes the stream, it returns the first error met while writing.
+func Close() error {
+	mu.Lock()
+	if stream == nil {
+		mu.Unlock()
+		return nil
+	}
+	close(stream)
+	stream = nil
+	mu.Unlock()
+	<-written
+	if writeErr != nil {
+		return fmt.Errorf("unable to write events: %w", writeErr)
+	}
+	return nil
+}
+
+// Enabled returns whether events are written, to skip the costly ones otherwise.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return stream != nil
+}
+
+// Emit writes the event, the time of the event is set if missing.
+func Emit(event Event) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if stream == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	stream <- event
+}
+
+// errorHook turns the errors logged by the tester into events.
+type errorHook struct{}
+
+func (errorHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+func (errorHook) Fire(entry *log.Entry) error {
+	Emit(Event{Time: entry.Time, Type: Error, Error: entry.Message})
+	if entry.Level != log.ErrorLevel {
+		// the tester is about to exit
+		_ = Close()
+	}
+	return nil
+}
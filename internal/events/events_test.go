@@ -0,0 +1,75 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"my5G-RANTester/lib/ngap/ngapType"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/free5gc/nas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	Emit(Event{Type: UeState, Msin: "0000000000"}) // not written, no stream opened
+
+	assert.NoError(t, Open(path))
+	assert.True(t, Enabled())
+	Emit(Event{Type: UeState, Msin: "0000000001", StateMM: "MM5G_REGISTERED"})
+	Emit(Event{Type: Nas, Msin: "0000000001", Nas: &NasInfo{Direction: Uplink, MessageType: NasMessageType(nas.MsgTypeRegistrationRequest)}})
+	assert.NoError(t, Close())
+	assert.False(t, Enabled())
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var read []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := Event{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		read = append(read, event)
+	}
+	assert.Len(t, read, 2)
+	assert.Equal(t, "MM5G_REGISTERED", read[0].StateMM)
+	assert.False(t, read[0].Time.IsZero())
+	assert.Equal(t, "RegistrationRequest", read[1].Nas.MessageType)
+}
+
+func TestNgapUeIds(t *testing.T) {
+	pdu := &ngapType.NGAPPDU{
+		Present: ngapType.NGAPPDUPresentInitiatingMessage,
+		InitiatingMessage: &ngapType.InitiatingMessage{
+			ProcedureCode: ngapType.ProcedureCode{Value: ngapType.ProcedureCodeUplinkNASTransport},
+			Value: ngapType.InitiatingMessageValue{
+				Present: ngapType.InitiatingMessagePresentUplinkNASTransport,
+				UplinkNASTransport: &ngapType.UplinkNASTransport{
+					ProtocolIEs: ngapType.ProtocolIEContainerUplinkNASTransportIEs{
+						List: []ngapType.UplinkNASTransportIEs{
+							{
+								Id:    ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDAMFUENGAPID},
+								Value: ngapType.UplinkNASTransportIEsValue{AMFUENGAPID: &ngapType.AMFUENGAPID{Value: 7}},
+							},
+							{
+								Id:    ngapType.ProtocolIEID{Value: ngapType.ProtocolIEIDRANUENGAPID},
+								Value: ngapType.UplinkNASTransportIEsValue{RANUENGAPID: &ngapType.RANUENGAPID{Value: 3}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ranUeNgapId, amfUeNgapId := ngapUeIds(pdu)
+	assert.Equal(t, int64(3), ranUeNgapId)
+	assert.Equal(t, int64(7), amfUeNgapId)
+}
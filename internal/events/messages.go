@@ -0,0 +1,116 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package events
+
+import (
+	"my5G-RANTester/internal/monitoring"
+	"my5G-RANTester/lib/ngap"
+	"my5G-RANTester/lib/ngap/ngapType"
+	"reflect"
+	"strconv"
+
+	nas "github.com/free5gc/nas"
+)
+
+var nasMessageTypes = map[uint8]string{
+	nas.MsgTypeRegistrationRequest:                              "RegistrationRequest",
+	nas.MsgTypeRegistrationAccept:                               "RegistrationAccept",
+	nas.MsgTypeRegistrationComplete:                             "RegistrationComplete",
+	nas.MsgTypeRegistrationReject:                               "RegistrationReject",
+	nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration: "DeregistrationRequestUEOriginating",
+	nas.MsgTypeDeregistrationAcceptUEOriginatingDeregistration:  "DeregistrationAcceptUEOriginating",
+	nas.MsgTypeDeregistrationRequestUETerminatedDeregistration:  "DeregistrationRequestUETerminated",
+	nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:   "DeregistrationAcceptUETerminated",
+	nas.MsgTypeServiceRequest:                                   "ServiceRequest",
+	nas.MsgTypeServiceReject:                                    "ServiceReject",
+	nas.MsgTypeServiceAccept:                                    "ServiceAccept",
+	nas.MsgTypeConfigurationUpdateCommand:                       "ConfigurationUpdateCommand",
+	nas.MsgTypeConfigurationUpdateComplete:                      "ConfigurationUpdateComplete",
+	nas.MsgTypeAuthenticationRequest:                            "AuthenticationRequest",
+	nas.MsgTypeAuthenticationResponse:                           "AuthenticationResponse",
+	nas.MsgTypeAuthenticationReject:                             "AuthenticationReject",
+	nas.MsgTypeAuthenticationFailure:                            "AuthenticationFailure",
+	nas.MsgTypeAuthenticationResult:                             "AuthenticationResult",
+	nas.MsgTypeIdentityRequest:                                  "IdentityRequest",
+	nas.MsgTypeIdentityResponse:                                 "IdentityResponse",
+	nas.MsgTypeSecurityModeCommand:                              "SecurityModeCommand",
+	nas.MsgTypeSecurityModeComplete:                             "SecurityModeComplete",
+	nas.MsgTypeSecurityModeReject:                               "SecurityModeReject",
+	nas.MsgTypeStatus5GMM:                                       "Status5GMM",
+	nas.MsgTypeNotification:                                     "Notification",
+	nas.MsgTypeNotificationResponse:                             "NotificationResponse",
+	nas.MsgTypeULNASTransport:                                   "ULNASTransport",
+	nas.MsgTypeDLNASTransport:                                   "DLNASTransport",
+}
+
+// NasMessageType returns the name of a 5GMM message type.
+func NasMessageType(messageType uint8) string {
+	if name, ok := nasMessageTypes[messageType]; ok {
+		return name
+	}
+	return strconv.Itoa(int(messageType))
+}
+
+// NgapMessage emits an NGAP message sent or received by the gNodeB gnb, along with the UE NGAP IDs it carries.
+func NgapMessage(gnb string, direction string, message []byte) {
+	if !Enabled() {
+		return
+	}
+
+	procedure, messageType := monitoring.NgapProcedure(message)
+	info := &NgapInfo{Direction: direction, Procedure: procedure, MessageType: messageType}
+	if pdu, err := ngap.Decoder(message); err == nil {
+		info.RanUeNgapId, info.AmfUeNgapId = ngapUeIds(pdu)
+	}
+	Emit(Event{Type: Ngap, Gnb: gnb, Ngap: info})
+}
+
+// ngapUeIds returns the RAN and AMF UE NGAP IDs of a UE associated NGAP message.
+func ngapUeIds(pdu *ngapType.NGAPPDU) (ranUeNgapId int64, amfUeNgapId int64) {
+	var value reflect.Value
+	switch pdu.Present {
+	case ngapType.NGAPPDUPresentInitiatingMessage:
+		value = reflect.ValueOf(pdu.InitiatingMessage.Value)
+	case ngapType.NGAPPDUPresentSuccessfulOutcome:
+		value = reflect.ValueOf(pdu.SuccessfulOutcome.Value)
+	case ngapType.NGAPPDUPresentUnsuccessfulOutcome:
+		value = reflect.ValueOf(pdu.UnsuccessfulOutcome.Value)
+	default:
+		return
+	}
+
+	// the message is the only pointer set in the value, eg: Value.InitialUEMessage
+	for i := 0; i < value.NumField(); i++ {
+		message := value.Field(i)
+		if message.Kind() != reflect.Pointer || message.IsNil() {
+			continue
+		}
+		ies := message.Elem().FieldByName("ProtocolIEs")
+		if !ies.IsValid() {
+			return
+		}
+		list := ies.FieldByName("List")
+		for j := 0; j < list.Len(); j++ {
+			ie := list.Index(j).FieldByName("Value")
+			if id := ie.FieldByName("RANUENGAPID"); id.IsValid() && !id.IsNil() {
+				ranUeNgapId = id.Interface().(*ngapType.RANUENGAPID).Value
+			}
+			if id := ie.FieldByName("AMFUENGAPID"); id.IsValid() && !id.IsNil() {
+				amfUeNgapId = id.Interface().(*ngapType.AMFUENGAPID).Value
+			}
+			// UE Context Release Command
+			if ids := ie.FieldByName("UENGAPIDs"); ids.IsValid() && !ids.IsNil() {
+				if pair := ids.Interface().(*ngapType.UENGAPIDs).UENGAPIDPair; pair != nil {
+					ranUeNgapId = pair.RANUENGAPID.Value
+					amfUeNgapId = pair.AMFUENGAPID.Value
+				} else if id := ids.Interface().(*ngapType.UENGAPIDs).AMFUENGAPID; id != nil {
+					amfUeNgapId = id.Value
+				}
+			}
+		}
+		return
+	}
+	return
+}
@@ -0,0 +1,64 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+
+// Package lifecycle
+// A run is stopped once, on interrupt or when its test is over. The stop is propagated to every UE, which releases
+// its PDU Sessions and deregisters, then to every gNodeB, which releases the remaining UE contexts and shuts its SCTP
+// associations down, all within the drain timeout.
+package lifecycle
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	mu           sync.Mutex
+	ctx, stop    = context.WithCancel(context.Background())
+	drainTimeout = 10 * time.Second
+)
+
+// Context returns the context of the run, done once the run is stopped.
+func Context() context.Context {
+	return ctx
+}
+
+// Stop stops the run, it can be called several times.
+func Stop() {
+	stop()
+}
+
+// HandleSignals stops the run on the first SIGINT or SIGTERM, and exits on the second one without waiting for the
+// UEs and gNodeBs to detach.
+func HandleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Warn("[TESTER] Stopping, the UEs and gNodeBs are detaching within ", DrainTimeout(), ". Interrupt again to exit immediately")
+		Stop()
+		<-signals
+		log.Fatal("[TESTER] Exiting without waiting for the UEs and gNodeBs to detach")
+	}()
+}
+
+func SetDrainTimeout(timeout time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	drainTimeout = timeout
+}
+
+// DrainTimeout returns how long UEs and gNodeBs are given to detach once the run is stopped.
+func DrainTimeout() time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	return drainTimeout
+}
@@ -0,0 +1,265 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package monitoring
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// Metrics of the tester, exposed for Prometheus by StartMetricsServer.
+var (
+	registry = prometheus.NewRegistry()
+
+	uesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "packetrusher_ues",
+		Help: "Number of UEs per 5GMM state.",
+	}, []string{"state"})
+
+	pduSessionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "packetrusher_pdu_sessions",
+		Help: "Number of PDU Sessions per 5GSM state.",
+	}, []string{"state"})
+
+	ngapMessagesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "packetrusher_ngap_messages_total",
+		Help: "NGAP messages exchanged by each gNodeB, identified by its N2 address, with the AMFs.",
+	}, []string{"gnb", "direction", "procedure", "type"})
+
+	proceduresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "packetrusher_procedures_total",
+		Help: "UE procedures per outcome.",
+	}, []string{"procedure", "outcome"})
+
+	rejectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "packetrusher_rejects_total",
+		Help: "Failed UE procedures per cause, the name of a 5GMM or 5GSM cause, or \"error\" on an error of the tester.",
+	}, []string{"procedure", "cause"})
+
+	procedureDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "packetrusher_procedure_duration_seconds",
+		Help:    "Duration of the successful UE procedures, per gNodeB and AMF serving the UE.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1ms to 16s
+	}, []string{"procedure", "gnb", "amf"})
+)
+
+func init() {
+	registry.MustRegister(
+		uesGauge,
+		pduSessionsGauge,
+		ngapMessagesCounter,
+		proceduresCounter,
+		rejectsCounter,
+		procedureDurationHistogram,
+		tunnelCollector{},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// StartMetricsServer serves the metrics on http://addr/metrics.
+func StartMetricsServer(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to start metrics endpoint on %s: %w", addr, err)
+	}
+	log.Info("[TESTER][METRICS] Metrics available on http://", listener.Addr(), "/metrics")
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Error("[TESTER][METRICS] Metrics endpoint stopped: ", err)
+		}
+	}()
+	return nil
+}
+
+type ueStates struct {
+	stateMM     string
+	pduSessions map[uint8]string
+}
+
+var (
+	statesMu sync.Mutex
+	states   = map[string]*ueStates{} // msin as key
+)
+
+// SetUeState records the new 5GMM state of the UE msin.
+func SetUeState(msin string, stateMM string) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	ue, ok := states[msin]
+	if !ok {
+		ue = &ueStates{pduSessions: map[uint8]string{}}
+		states[msin] = ue
+	} else {
+		uesGauge.WithLabelValues(ue.stateMM).Dec()
+	}
+	ue.stateMM = stateMM
+	uesGauge.WithLabelValues(stateMM).Inc()
+}
+
+// SetPduSessionState records the new 5GSM state of a PDU Session of the UE msin.
+func SetPduSessionState(msin string, pduSessionId uint8, stateSM string) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	ue, ok := states[msin]
+	if !ok {
+		return
+	}
+	if previous, ok := ue.pduSessions[pduSessionId]; ok {
+		pduSessionsGauge.WithLabelValues(previous).Dec()
+	}
+	ue.pduSessions[pduSessionId] = stateSM
+	pduSessionsGauge.WithLabelValues(stateSM).Inc()
+}
+
+// RemovePduSession forgets a PDU Session of the UE msin.
+func RemovePduSession(msin string, pduSessionId uint8) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	ue, ok := states[msin]
+	if !ok {
+		return
+	}
+	if previous, ok := ue.pduSessions[pduSessionId]; ok {
+		pduSessionsGauge.WithLabelValues(previous).Dec()
+		delete(ue.pduSessions, pduSessionId)
+	}
+}
+
+// RemoveUe forgets the UE msin and its PDU Sessions, once the UE is terminated.
+func RemoveUe(msin string) {
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	ue, ok := states[msin]
+	if !ok {
+		return
+	}
+	uesGauge.WithLabelValues(ue.stateMM).Dec()
+	for _, stateSM := range ue.pduSessions {
+		pduSessionsGauge.WithLabelValues(stateSM).Dec()
+	}
+	delete(states, msin)
+}
+
+// IncProcedure counts the outcome of a UE procedure, and its cause on failure.
+func IncProcedure(procedure string, outcome string, cause string) {
+	proceduresCounter.WithLabelValues(procedure, outcome).Inc()
+	if cause != "" {
+		rejectsCounter.WithLabelValues(procedure, cause).Inc()
+	}
+}
+
+// ObserveProcedureDuration records the duration of a successful UE procedure.
+func ObserveProcedureDuration(procedure string, gnb string, amf string, duration time.Duration) {
+	procedureDurationHistogram.WithLabelValues(procedure, gnb, amf).Observe(duration.Seconds())
+}
+
+// gnbAddrs caches the local address of the N2 associations, as reading it is a system call.
+var gnbAddrs sync.Map
+
+// N2Addr returns the local address of the N2 association conn, which identifies a gNodeB.
+func N2Addr(conn interface{ LocalAddr() net.Addr }) string {
+	gnb, ok := gnbAddrs.Load(conn)
+	if !ok {
+		gnb = "unknown"
+		if addr := conn.LocalAddr(); addr != nil {
+			gnb = addr.String()
+		}
+		gnbAddrs.Store(conn, gnb)
+	}
+	return gnb.(string)
+}
+
+// IncNgapMessage counts an NGAP message sent ("tx") or received ("rx") by the gNodeB gnb.
+func IncNgapMessage(gnb string, direction string, message []byte) {
+	procedure, messageType := NgapProcedure(message)
+	ngapMessagesCounter.WithLabelValues(gnb, direction, procedure, messageType).Inc()
+}
+
+// tunnelCollector reports the traffic of the GTP-U interfaces of the UEs, read from the kernel on each scrape.
+type tunnelCollector struct{}
+
+var (
+	tunnelBytesDesc = prometheus.NewDesc("packetrusher_tunnel_bytes_total",
+		"Bytes received (rx) and sent (tx) by the UEs on their GTP-U interface.", []string{"msin", "direction"}, nil)
+	tunnelPacketsDesc = prometheus.NewDesc("packetrusher_tunnel_packets_total",
+		"Packets received (rx) and sent (tx) by the UEs on their GTP-U interface.", []string{"msin", "direction"}, nil)
+)
+
+func (tunnelCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tunnelBytesDesc
+	ch <- tunnelPacketsDesc
+}
+
+func (tunnelCollector) Collect(ch chan<- prometheus.Metric) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		log.Debug("[TESTER][METRICS] Unable to list the GTP-U interfaces: ", err)
+		return
+	}
+	for _, link := range links {
+		attrs := link.Attrs()
+		// the GTP-U interface of a UE is named val<msin>
+		if !strings.HasPrefix(attrs.Name, "val") || attrs.Statistics == nil {
+			continue
+		}
+		msin := strings.TrimPrefix(attrs.Name, "val")
+		stats := attrs.Statistics
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue, float64(stats.RxBytes), msin, "rx")
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue, float64(stats.TxBytes), msin, "tx")
+		ch <- prometheus.MustNewConstMetric(tunnelPacketsDesc, prometheus.CounterValue, float64(stats.RxPackets), msin, "rx")
+		ch <- prometheus.MustNewConstMetric(tunnelPacketsDesc, prometheus.CounterValue, float64(stats.TxPackets), msin, "tx")
+	}
+}
+
+var ngapMessageTypes = []string{"initiatingMessage", "successfulOutcome", "unsuccessfulOutcome"}
+
+var ngapProcedures = []string{
+	"AMFConfigurationUpdate", "AMFStatusIndication", "CellTrafficTrace", "DeactivateTrace", "DownlinkNASTransport",
+	"DownlinkNonUEAssociatedNRPPaTransport", "DownlinkRANConfigurationTransfer", "DownlinkRANStatusTransfer",
+	"DownlinkUEAssociatedNRPPaTransport", "ErrorIndication", "HandoverCancel", "HandoverNotification",
+	"HandoverPreparation", "HandoverResourceAllocation", "InitialContextSetup", "InitialUEMessage",
+	"LocationReportingControl", "LocationReportingFailureIndication", "LocationReport", "NASNonDeliveryIndication",
+	"NGReset", "NGSetup", "OverloadStart", "OverloadStop", "Paging", "PathSwitchRequest", "PDUSessionResourceModify",
+	"PDUSessionResourceModifyIndication", "PDUSessionResourceRelease", "PDUSessionResourceSetup",
+	"PDUSessionResourceNotify", "PrivateMessage", "PWSCancel", "PWSFailureIndication", "PWSRestartIndication",
+	"RANConfigurationUpdate", "RerouteNASRequest", "RRCInactiveTransitionReport", "TraceFailureIndication",
+	"TraceStart", "UEContextModification", "UEContextRelease", "UEContextReleaseRequest", "UERadioCapabilityCheck",
+	"UERadioCapabilityInfoIndication", "UETNLABindingRelease", "UplinkNASTransport",
+	"UplinkNonUEAssociatedNRPPaTransport", "UplinkRANConfigurationTransfer", "UplinkRANStatusTransfer",
+	"UplinkUEAssociatedNRPPaTransport", "WriteReplaceWarning",
+}
+
+// NgapProcedure reads the procedure code and the type of an APER encoded NGAP PDU without decoding it:
+// the first octet holds the choice of the NGAP-PDU, and the second one the procedure code.
+func NgapProcedure(message []byte) (string, string) {
+	if len(message) < 2 {
+		return "unknown", "unknown"
+	}
+
+	messageType := "unknown"
+	if choice := int(message[0] >> 5); choice < len(ngapMessageTypes) {
+		messageType = ngapMessageTypes[choice]
+	}
+	procedure := strconv.Itoa(int(message[1]))
+	if int(message[1]) < len(ngapProcedures) {
+		procedure = ngapProcedures[message[1]]
+	}
+	return procedure, messageType
+}
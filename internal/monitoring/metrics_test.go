@@ -0,0 +1,48 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUeStates(t *testing.T) {
+	SetUeState("0000000001", "MM5G_DEREGISTERED")
+	SetUeState("0000000002", "MM5G_DEREGISTERED")
+	SetUeState("0000000001", "MM5G_REGISTERED")
+	SetPduSessionState("0000000001", 1, "SM5G_PDU_SESSION_ACTIVE_PENDING")
+	SetPduSessionState("0000000001", 1, "SM5G_PDU_SESSION_ACTIVE")
+	SetPduSessionState("0000000001", 2, "SM5G_PDU_SESSION_ACTIVE")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(uesGauge.WithLabelValues("MM5G_REGISTERED")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(uesGauge.WithLabelValues("MM5G_DEREGISTERED")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(pduSessionsGauge.WithLabelValues("SM5G_PDU_SESSION_ACTIVE_PENDING")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(pduSessionsGauge.WithLabelValues("SM5G_PDU_SESSION_ACTIVE")))
+
+	RemovePduSession("0000000001", 2)
+	assert.Equal(t, 1.0, testutil.ToFloat64(pduSessionsGauge.WithLabelValues("SM5G_PDU_SESSION_ACTIVE")))
+
+	RemoveUe("0000000001")
+	assert.Equal(t, 0.0, testutil.ToFloat64(uesGauge.WithLabelValues("MM5G_REGISTERED")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(pduSessionsGauge.WithLabelValues("SM5G_PDU_SESSION_ACTIVE")))
+}
+
+func TestNgapProcedure(t *testing.T) {
+	// Initial UE Message
+	procedure, messageType := NgapProcedure([]byte{0x00, 0x0f, 0x40, 0x48})
+	assert.Equal(t, "InitialUEMessage", procedure)
+	assert.Equal(t, "initiatingMessage", messageType)
+
+	// NG Setup Failure
+	procedure, messageType = NgapProcedure([]byte{0x40, 0x15, 0x00, 0x0f})
+	assert.Equal(t, "NGSetup", procedure)
+	assert.Equal(t, "unsuccessfulOutcome", messageType)
+
+	procedure, _ = NgapProcedure([]byte{0x00})
+	assert.Equal(t, "unknown", procedure)
+}
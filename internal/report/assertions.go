@@ -0,0 +1,136 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package report
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Assertions are the pass/fail criteria of a run, the zero value of a criterion disables it.
+type Assertions struct {
+	MinRegistrationSuccessRatio float64
+	MaxPduSessionP95Latency     time.Duration
+	NoErrorIndication           bool // no Error Indication received from the AMF
+	AllDeregistered             bool // every registered UE deregistered cleanly before the end of the run
+}
+
+// Violation is an assertion not met by the run.
+type Violation struct {
+	Assertion string `json:"assertion"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+}
+
+func (violation Violation) String() string {
+	return fmt.Sprintf("%s: expected %s, got %s", violation.Assertion, violation.Expected, violation.Actual)
+}
+
+// SetAssertions sets the assertions evaluated when the report is built.
+func SetAssertions(runAssertions Assertions) {
+	mu.Lock()
+	defer mu.Unlock()
+	assertions = runAssertions
+}
+
+// ErrorIndicationReceived records an Error Indication received from the AMF.
+func ErrorIndicationReceived() {
+	mu.Lock()
+	defer mu.Unlock()
+	errorIndications++
+}
+
+// assert returns the assertions the report does not meet.
+func (report *Report) assert(assertions Assertions) []Violation {
+	violations := []Violation{}
+	summaries := map[Procedure]Summary{}
+	for _, summary := range report.Summary {
+		summaries[summary.Procedure] = summary
+	}
+
+	if assertions.MinRegistrationSuccessRatio > 0 {
+		registrations := summaries[Registration]
+		ratio := 0.0
+		if registrations.Attempts > 0 {
+			ratio = float64(registrations.Successes) / float64(registrations.Attempts)
+		}
+		if ratio < assertions.MinRegistrationSuccessRatio {
+			violations = append(violations, Violation{
+				Assertion: "registration success ratio",
+				Expected:  fmt.Sprintf(">= %.4f", assertions.MinRegistrationSuccessRatio),
+				Actual:    fmt.Sprintf("%.4f (%d/%d)", ratio, registrations.Successes, registrations.Attempts),
+			})
+		}
+	}
+
+	if assertions.MaxPduSessionP95Latency > 0 {
+		p95 := summaries[PduSessionEstablishment].P95Ms
+		if p95 > float64(assertions.MaxPduSessionP95Latency.Microseconds())/1000 {
+			violations = append(violations, Violation{
+				Assertion: "PDU Session establishment p95 latency",
+				Expected:  fmt.Sprint("<= ", assertions.MaxPduSessionP95Latency),
+				Actual:    fmt.Sprintf("%.1fms", p95),
+			})
+		}
+	}
+
+	if assertions.NoErrorIndication && report.ErrorIndications > 0 {
+		violations = append(violations, Violation{
+			Assertion: "Error Indications received",
+			Expected:  "0",
+			Actual:    fmt.Sprint(report.ErrorIndications),
+		})
+	}
+
+	if assertions.AllDeregistered {
+		notDeregistered := report.registered()
+		for _, failure := range report.Detach {
+			if !contains(notDeregistered, failure.Msin) {
+				notDeregistered = append(notDeregistered, failure.Msin)
+			}
+		}
+		if len(notDeregistered) > 0 {
+			violations = append(violations, Violation{
+				Assertion: "UEs deregistered",
+				Expected:  "all",
+				Actual:    fmt.Sprint(len(notDeregistered), " UE(s) not deregistered: ", strings.Join(notDeregistered, ", ")),
+			})
+		}
+	}
+	return violations
+}
+
+// registered returns the UEs whose last successful registration was not followed by a successful deregistration.
+func (report *Report) registered() []string {
+	var msins []string
+	for _, ue := range report.Ues {
+		registered := false
+		for _, attempt := range ue.Attempts {
+			if attempt.Outcome != Success {
+				continue
+			}
+			switch attempt.Procedure {
+			case Registration:
+				registered = true
+			case Deregistration, NetworkDeregistration:
+				registered = false
+			}
+		}
+		if registered {
+			msins = append(msins, ue.Msin)
+		}
+	}
+	return msins
+}
+
+func contains(msins []string, msin string) bool {
+	for _, other := range msins {
+		if other == msin {
+			return true
+		}
+	}
+	return false
+}
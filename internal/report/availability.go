@@ -0,0 +1,155 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checks of the AMF health monitor.
+const (
+	SctpAssociation    = "sctp-association"
+	NgSetup            = "ng-setup"
+	CanaryRegistration = "canary-registration"
+)
+
+// Check is the outcome of a check of the AMF, eg: a probe or an SCTP association event.
+type Check struct {
+	Time      time.Time `json:"time"`
+	Check     string    `json:"check"`
+	Success   bool      `json:"success"`
+	LatencyMs float64   `json:"latencyMs,omitempty"`
+	Cause     string    `json:"cause,omitempty"`
+}
+
+// Outage is a period during which at least one check of the AMF failed.
+type Outage struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs float64   `json:"durationMs"`
+	Cause      string    `json:"cause"` // first failed check
+	Ongoing    bool      `json:"ongoing,omitempty"`
+}
+
+// Timeline is the availability of the AMF during a health monitoring.
+type Timeline struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Availability float64   `json:"availability"` // ratio of the time without outage
+	MttrMs       float64   `json:"mttrMs"`       // mean duration of the ended outages
+	Outages      []Outage  `json:"outages"`
+	Changes      []Check   `json:"changes"` // checks whose outcome changed, ie: the transitions of the timeline
+	Checks       []Check   `json:"checks"`
+}
+
+// AvailabilityMonitor builds the availability timeline of an AMF from its checks.
+type AvailabilityMonitor struct {
+	mu      sync.Mutex
+	start   time.Time
+	last    map[string]bool // last outcome of each check
+	checks  []Check
+	changes []Check
+	outages []Outage
+}
+
+func NewAvailabilityMonitor() *AvailabilityMonitor {
+	return &AvailabilityMonitor{start: time.Now(), last: map[string]bool{}}
+}
+
+// Record records a check, the AMF is unavailable from the first failed check until every check succeeds again.
+// It returns true if the availability of the AMF changed.
+func (monitor *AvailabilityMonitor) Record(check Check) bool {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.checks = append(monitor.checks, check)
+	if last, ok := monitor.last[check.Check]; !ok || last != check.Success {
+		monitor.changes = append(monitor.changes, check)
+	}
+	monitor.last[check.Check] = check.Success
+
+	down := len(monitor.outages) > 0 && monitor.outages[len(monitor.outages)-1].Ongoing
+	if !check.Success && !down {
+		cause := check.Check
+		if check.Cause != "" {
+			cause += ": " + check.Cause
+		}
+		monitor.outages = append(monitor.outages, Outage{Start: check.Time, Cause: cause, Ongoing: true})
+		return true
+	}
+	if check.Success && down {
+		for _, success := range monitor.last {
+			if !success {
+				return false
+			}
+		}
+		outage := &monitor.outages[len(monitor.outages)-1]
+		outage.End = check.Time
+		outage.DurationMs = float64(outage.End.Sub(outage.Start).Microseconds()) / 1000
+		outage.Ongoing = false
+		return true
+	}
+	return false
+}
+
+// Available returns whether the AMF is available, ie: no outage is ongoing.
+func (monitor *AvailabilityMonitor) Available() bool {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	return len(monitor.outages) == 0 || !monitor.outages[len(monitor.outages)-1].Ongoing
+}
+
+// Timeline returns the timeline so far, an ongoing outage lasts until now.
+func (monitor *AvailabilityMonitor) Timeline() Timeline {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	timeline := Timeline{
+		Start:   monitor.start,
+		End:     time.Now(),
+		Outages: append([]Outage{}, monitor.outages...),
+		Changes: append([]Check{}, monitor.changes...),
+		Checks:  append([]Check{}, monitor.checks...),
+	}
+	sort.SliceStable(timeline.Checks, func(i, j int) bool { return timeline.Checks[i].Time.Before(timeline.Checks[j].Time) })
+
+	var downtime, repairs time.Duration
+	ended := 0
+	for i := range timeline.Outages {
+		outage := &timeline.Outages[i]
+		if outage.Ongoing {
+			outage.End = timeline.End
+			outage.DurationMs = float64(outage.End.Sub(outage.Start).Microseconds()) / 1000
+		} else {
+			repairs += outage.End.Sub(outage.Start)
+			ended++
+		}
+		downtime += outage.End.Sub(outage.Start)
+	}
+	if total := timeline.End.Sub(timeline.Start); total > 0 {
+		timeline.Availability = 1 - downtime.Seconds()/total.Seconds()
+	}
+	if ended > 0 {
+		timeline.MttrMs = float64((repairs / time.Duration(ended)).Microseconds()) / 1000
+	}
+	return timeline
+}
+
+// WriteJSON writes the timeline in JSON to path.
+func (timeline *Timeline) WriteJSON(path string) error {
+	content, err := json.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("unable to write timeline %s: %w", path, err)
+	}
+	return nil
+}
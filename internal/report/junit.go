@@ -0,0 +1,95 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the attempts of a procedure
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"` // incomplete attempts
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the report in JUnit XML to path, with a test suite per procedure and a test case per attempt.
+// Failed attempts are reported as failures, and incomplete attempts as errors.
+func (report *Report) WriteJUnit(path string) error {
+	suites := map[Procedure]*junitTestSuite{}
+	for _, procedure := range Procedures {
+		suites[procedure] = &junitTestSuite{Name: string(procedure), Timestamp: report.Start.Format("2006-01-02T15:04:05")}
+	}
+
+	for _, ue := range report.Ues {
+		for i, attempt := range ue.Attempts {
+			suite := suites[attempt.Procedure]
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("UE %s %s #%d", ue.Msin, attempt.Procedure, i),
+				Classname: "ue." + ue.Msin,
+				Time:      attempt.DurationMs / 1000,
+			}
+			if attempt.PduSessionId != 0 {
+				testCase.Name = fmt.Sprintf("UE %s %s %d #%d", ue.Msin, attempt.Procedure, attempt.PduSessionId, i)
+			}
+			switch attempt.Outcome {
+			case Failure:
+				testCase.Failure = &junitProblem{Message: attempt.Cause}
+				suite.Failures++
+			case Incomplete:
+				testCase.Error = &junitProblem{Message: "no answer before the end of the run"}
+				suite.Errors++
+			}
+			suite.Tests++
+			suite.Time += testCase.Time
+			suite.Cases = append(suite.Cases, testCase)
+		}
+	}
+
+	testSuites := junitTestSuites{Time: report.End.Sub(report.Start).Seconds()}
+	for _, procedure := range Procedures {
+		suite := suites[procedure]
+		testSuites.Tests += suite.Tests
+		testSuites.Failures += suite.Failures
+		testSuites.Errors += suite.Errors
+		testSuites.Suites = append(testSuites.Suites, *suite)
+	}
+
+	content, err := xml.MarshalIndent(testSuites, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append([]byte(xml.Header), content...), 0o644); err != nil {
+		return fmt.Errorf("unable to write JUnit report %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package report
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RateSecond is the outcome of the registrations started during one second of a registration rate test.
+type RateSecond struct {
+	Second       int     `json:"second"`
+	Started      int     `json:"started"`
+	Successes    int     `json:"successes"`
+	Completed    int     `json:"completed"` // registrations which succeeded during this second, ie: the achieved rate
+	SuccessRatio float64 `json:"successRatio"`
+	AvgMs        float64 `json:"avgMs"` // latencies of the successful registrations
+	P95Ms        float64 `json:"p95Ms"`
+}
+
+// RateTest is the outcome of a registration rate test.
+type RateTest struct {
+	TargetRate       int          `json:"targetRate"`
+	AchievedRate     float64      `json:"achievedRate"` // successful registrations per second, until the last one
+	SuccessRatio     float64      `json:"successRatio"`
+	AvgMs            float64      `json:"avgMs"` // latencies of the successful registrations
+	P95Ms            float64      `json:"p95Ms"`
+	P99Ms            float64      `json:"p99Ms"`
+	Saturated        bool         `json:"saturated"`
+	SaturationSecond int          `json:"saturationSecond,omitempty"` // first second where the AMF was saturated
+	SaturationCause  string       `json:"saturationCause,omitempty"`
+	Seconds          []RateSecond `json:"seconds"`
+}
+
+type rateSample struct {
+	latency time.Duration
+	success bool
+}
+
+// RateMeter measures the registrations of a registration rate test, per second since its creation.
+type RateMeter struct {
+	mu             sync.Mutex
+	start          time.Time
+	targetRate     int
+	started        [][]rateSample // by second of the start of the registration
+	completed      []int          // by second of the end of the successful registrations
+	lastCompletion time.Time
+}
+
+func NewRateMeter(targetRate int) *RateMeter {
+	return &RateMeter{start: time.Now(), targetRate: targetRate}
+}
+
+// Record records a registration started at start and ended at end.
+func (meter *RateMeter) Record(start time.Time, end time.Time, success bool) {
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+
+	second := meter.second(start)
+	for len(meter.started) <= second {
+		meter.started = append(meter.started, nil)
+	}
+	meter.started[second] = append(meter.started[second], rateSample{latency: end.Sub(start), success: success})
+
+	if success {
+		second = meter.second(end)
+		for len(meter.completed) <= second {
+			meter.completed = append(meter.completed, 0)
+		}
+		meter.completed[second]++
+		if end.After(meter.lastCompletion) {
+			meter.lastCompletion = end
+		}
+	}
+}
+
+func (meter *RateMeter) second(at time.Time) int {
+	second := int(at.Sub(meter.start) / time.Second)
+	if second < 0 {
+		return 0
+	}
+	return second
+}
+
+// Second returns the outcome of the registrations recorded so far for the second i, starting at 0.
+func (meter *RateMeter) Second(i int) RateSecond {
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+
+	second := RateSecond{Second: i + 1}
+	if i < len(meter.completed) {
+		second.Completed = meter.completed[i]
+	}
+	if i >= len(meter.started) {
+		return second
+	}
+
+	var latencies []float64
+	total := 0.0
+	for _, sample := range meter.started[i] {
+		second.Started++
+		if sample.success {
+			second.Successes++
+			latency := float64(sample.latency.Microseconds()) / 1000
+			latencies = append(latencies, latency)
+			total += latency
+		}
+	}
+	if second.Started > 0 {
+		second.SuccessRatio = float64(second.Successes) / float64(second.Started)
+	}
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		second.AvgMs = total / float64(len(latencies))
+		second.P95Ms = percentile(latencies, 95)
+	}
+	return second
+}
+
+// Result returns the outcome of the test, the AMF is saturated from the first second whose success ratio is below
+// minSuccessRatio, or whose p95 latency is above maxLatency (unless 0).
+func (meter *RateMeter) Result(minSuccessRatio float64, maxLatency time.Duration) RateTest {
+	meter.mu.Lock()
+	startedSeconds := len(meter.started)
+	seconds := max(startedSeconds, len(meter.completed))
+	lastCompletion := meter.lastCompletion
+	var latencies []float64
+	total := 0.0
+	for _, samples := range meter.started {
+		for _, sample := range samples {
+			if sample.success {
+				latency := float64(sample.latency.Microseconds()) / 1000
+				latencies = append(latencies, latency)
+				total += latency
+			}
+		}
+	}
+	meter.mu.Unlock()
+
+	result := RateTest{TargetRate: meter.targetRate, Seconds: []RateSecond{}}
+	started, successes := 0, 0
+	for i := 0; i < seconds; i++ {
+		second := meter.Second(i)
+		result.Seconds = append(result.Seconds, second)
+		started += second.Started
+		successes += second.Successes
+
+		if result.Saturated || second.Started == 0 {
+			continue
+		}
+		if second.SuccessRatio < minSuccessRatio {
+			result.Saturated = true
+			result.SaturationCause = fmt.Sprintf("success ratio %.2f is below %.2f", second.SuccessRatio, minSuccessRatio)
+		} else if maxLatency > 0 && second.P95Ms > float64(maxLatency.Milliseconds()) {
+			result.Saturated = true
+			result.SaturationCause = fmt.Sprintf("p95 latency %.1fms is above %dms", second.P95Ms, maxLatency.Milliseconds())
+		}
+		if result.Saturated {
+			result.SaturationSecond = second.Second
+		}
+	}
+
+	if started > 0 {
+		result.SuccessRatio = float64(successes) / float64(started)
+	}
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		result.AvgMs = total / float64(len(latencies))
+		result.P95Ms = percentile(latencies, 95)
+		result.P99Ms = percentile(latencies, 99)
+	}
+	// registrations are started during whole seconds, so the rate is not overestimated when they all complete early
+	if elapsed := max(lastCompletion.Sub(meter.start).Seconds(), float64(startedSeconds)); successes > 0 {
+		result.AchievedRate = float64(successes) / elapsed
+	}
+	return result
+}
+
+// CapacityStep is a load step of a capacity search, at a fixed registration rate.
+type CapacityStep struct {
+	RateTest
+	Passed bool `json:"passed"` // whether the step met the SLOs
+}
+
+// CapacitySearch is the outcome of a capacity search, ie: the highest registration rate meeting the SLOs.
+type CapacitySearch struct {
+	Capacity int            `json:"capacity"`
+	Steps    []CapacityStep `json:"steps"` // by increasing rate
+}
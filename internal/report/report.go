@@ -0,0 +1,421 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"my5G-RANTester/internal/monitoring"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Procedure is a procedure attempted by a UE.
+type Procedure string
+
+const (
+	Registration               Procedure = "registration"
+	Authentication             Procedure = "authentication"
+	SecurityMode               Procedure = "security-mode"
+	PduSessionEstablishment    Procedure = "pdu-session-establishment"
+	PduSessionRelease          Procedure = "pdu-session-release"
+	Handover                   Procedure = "handover"
+	MobilityRegistrationUpdate Procedure = "mobility-registration-update"
+	PeriodicRegistrationUpdate Procedure = "periodic-registration-update"
+	ServiceRequest             Procedure = "service-request"
+	Deregistration             Procedure = "deregistration"
+	NetworkDeregistration      Procedure = "network-deregistration"
+)
+
+// Procedures lists every procedure, in the order of the report.
+var Procedures = []Procedure{Registration, Authentication, SecurityMode, PduSessionEstablishment, PduSessionRelease, Handover, MobilityRegistrationUpdate, PeriodicRegistrationUpdate, ServiceRequest, Deregistration, NetworkDeregistration}
+
+type Outcome string
+
+const (
+	Success    Outcome = "success"
+	Failure    Outcome = "failure"
+	Incomplete Outcome = "incomplete" // no answer was received before the end of the run
+)
+
+// Attempt is one attempt of a procedure by a UE.
+type Attempt struct {
+	Procedure    Procedure `json:"procedure"`
+	PduSessionId uint8     `json:"pduSessionId,omitempty"`
+	Outcome      Outcome   `json:"outcome"`
+	Cause        string    `json:"cause,omitempty"`
+	Gnb          string    `json:"gnb,omitempty"` // gNodeB and AMF serving the UE at the end of the attempt
+	Amf          string    `json:"amf,omitempty"`
+	Start        time.Time `json:"start"`
+	DurationMs   float64   `json:"durationMs"`
+}
+
+type UeReport struct {
+	Msin     string    `json:"msin"`
+	Attempts []Attempt `json:"attempts"`
+	Failure  string    `json:"failure,omitempty"` // last failure of the UE, eg: an unexpected message
+}
+
+// Summary aggregates the attempts of a procedure by every UE.
+type Summary struct {
+	Procedure  Procedure      `json:"procedure"`
+	Attempts   int            `json:"attempts"`
+	Successes  int            `json:"successes"`
+	Failures   int            `json:"failures"`
+	Incomplete int            `json:"incomplete"`
+	Causes     map[string]int `json:"causes,omitempty"`
+	MinMs      float64        `json:"minMs"` // durations of the successful attempts
+	AvgMs      float64        `json:"avgMs"`
+	P50Ms      float64        `json:"p50Ms"`
+	P95Ms      float64        `json:"p95Ms"`
+	P99Ms      float64        `json:"p99Ms"`
+	MaxMs      float64        `json:"maxMs"`
+}
+
+// NodeSummary aggregates the attempts of the UEs served by a gNodeB or an AMF.
+type NodeSummary struct {
+	Node    string    `json:"node"`
+	Summary []Summary `json:"summary"`
+}
+
+// DetachFailure is a UE which did not detach cleanly once the run was stopped.
+type DetachFailure struct {
+	Msin   string `json:"msin"`
+	Reason string `json:"reason"`
+}
+
+type Report struct {
+	Start            time.Time       `json:"start"`
+	End              time.Time       `json:"end"`
+	Summary          []Summary       `json:"summary"`
+	ByGnb            []NodeSummary   `json:"byGnb"`
+	ByAmf            []NodeSummary   `json:"byAmf"`
+	Ues              []UeReport      `json:"ues"`
+	Rate             *RateTest       `json:"rate,omitempty"`
+	Capacity         *CapacitySearch `json:"capacity,omitempty"`
+	Availability     *Timeline       `json:"availability,omitempty"`
+	Detach           []DetachFailure `json:"detachFailures,omitempty"`
+	ErrorIndications int             `json:"errorIndications"`     // received from the AMF
+	Violations       []Violation     `json:"violations,omitempty"` // assertions not met by the run
+}
+
+type pendingKey struct {
+	procedure    Procedure
+	pduSessionId uint8
+}
+
+type ueRecord struct {
+	attempts []Attempt
+	pending  map[pendingKey]int // index of the pending attempts
+	gnb      string
+	amf      string
+	failure  string
+}
+
+var (
+	mu       sync.Mutex
+	start    = time.Now()
+	ues      = map[string]*ueRecord{}
+	rateTest *RateTest
+	capacity *CapacitySearch
+	timeline *Timeline
+	detach   []DetachFailure
+
+	assertions       Assertions
+	errorIndications int
+)
+
+// Reset forgets every attempt.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	start = time.Now()
+	ues = map[string]*ueRecord{}
+	rateTest = nil
+	capacity = nil
+	timeline = nil
+	detach = nil
+	assertions = Assertions{}
+	errorIndications = 0
+}
+
+// DetachFailed records that the UE msin did not detach cleanly.
+func DetachFailed(msin string, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+	detach = append(detach, DetachFailure{Msin: msin, Reason: reason})
+}
+
+// DetachFailures returns the UEs which did not detach cleanly so far.
+func DetachFailures() []DetachFailure {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]DetachFailure{}, detach...)
+}
+
+// SetRateTest adds the outcome of a registration rate test to the report.
+func SetRateTest(result RateTest) {
+	mu.Lock()
+	defer mu.Unlock()
+	rateTest = &result
+}
+
+// SetCapacitySearch adds the outcome of a capacity search to the report.
+func SetCapacitySearch(search CapacitySearch) {
+	mu.Lock()
+	defer mu.Unlock()
+	capacity = &search
+}
+
+// SetTimeline adds the availability timeline of an AMF health monitoring to the report.
+func SetTimeline(availability Timeline) {
+	mu.Lock()
+	defer mu.Unlock()
+	timeline = &availability
+}
+
+// SetServingNodes records the gNodeB and the AMF now serving the UE msin.
+func SetServingNodes(msin string, gnb string, amf string) {
+	mu.Lock()
+	defer mu.Unlock()
+	ue := getUe(msin)
+	ue.gnb = gnb
+	ue.amf = amf
+}
+
+func getUe(msin string) *ueRecord {
+	ue, ok := ues[msin]
+	if !ok {
+		ue = &ueRecord{pending: map[pendingKey]int{}}
+		ues[msin] = ue
+	}
+	return ue
+}
+
+// Start records the start of a procedure by the UE msin.
+func Start(msin string, procedure Procedure) {
+	StartPduSession(msin, procedure, 0)
+}
+
+// Succeed records the success of the pending procedure of the UE msin, if any.
+func Succeed(msin string, procedure Procedure) {
+	SucceedPduSession(msin, procedure, 0)
+}
+
+// ErrorCause is the cause of the failures on an error of the tester in the metrics, eg: on an invalid message, as the
+// error itself would make the number of causes unbounded.
+const ErrorCause = "error"
+
+// Fail records the failure of the pending procedure of the UE msin, if any. The cause is one of a fixed set, eg: the
+// name of a 5GMM cause, it is also the cause of the failure in the metrics.
+func Fail(msin string, procedure Procedure, cause string) {
+	FailPduSession(msin, procedure, 0, cause)
+}
+
+func StartPduSession(msin string, procedure Procedure, pduSessionId uint8) {
+	mu.Lock()
+	defer mu.Unlock()
+	ue := getUe(msin)
+	// a new attempt replaces the unanswered one, eg: on retry
+	key := pendingKey{procedure, pduSessionId}
+	if i, ok := ue.pending[key]; ok {
+		ue.end(i, Incomplete, "", "")
+	}
+	ue.pending[key] = len(ue.attempts)
+	ue.attempts = append(ue.attempts, Attempt{Procedure: procedure, PduSessionId: pduSessionId, Start: time.Now()})
+}
+
+func SucceedPduSession(msin string, procedure Procedure, pduSessionId uint8) {
+	endPending(msin, pendingKey{procedure, pduSessionId}, Success, "", "")
+}
+
+func FailPduSession(msin string, procedure Procedure, pduSessionId uint8, cause string) {
+	endPending(msin, pendingKey{procedure, pduSessionId}, Failure, cause, cause)
+}
+
+// FailPduSessionOnError records the failure of a PDU Session procedure of the UE msin on err, counted under ErrorCause in
+// the metrics.
+func FailPduSessionOnError(msin string, procedure Procedure, pduSessionId uint8, err error) {
+	endPending(msin, pendingKey{procedure, pduSessionId}, Failure, err.Error(), ErrorCause)
+}
+
+// FailUe records that the UE msin failed, eg: on an unexpected message, its pending procedures fail with reason, counted
+// under ErrorCause in the metrics.
+func FailUe(msin string, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+	ue := getUe(msin)
+	ue.failure = reason
+	for key, i := range ue.pending {
+		ue.end(i, Failure, reason, ErrorCause)
+		delete(ue.pending, key)
+	}
+}
+
+func endPending(msin string, key pendingKey, outcome Outcome, cause string, metricCause string) {
+	mu.Lock()
+	defer mu.Unlock()
+	ue, ok := ues[msin]
+	if !ok {
+		return
+	}
+	if i, ok := ue.pending[key]; ok {
+		ue.end(i, outcome, cause, metricCause)
+		delete(ue.pending, key)
+	}
+}
+
+// end ends an attempt, cause is reported and metricCause, of a fixed set, is counted in the metrics.
+func (ue *ueRecord) end(i int, outcome Outcome, cause string, metricCause string) {
+	attempt := &ue.attempts[i]
+	attempt.Outcome = outcome
+	attempt.Cause = cause
+	attempt.Gnb = ue.gnb
+	attempt.Amf = ue.amf
+	duration := time.Since(attempt.Start)
+	attempt.DurationMs = float64(duration.Microseconds()) / 1000
+	monitoring.IncProcedure(string(attempt.Procedure), string(outcome), metricCause)
+	if outcome == Success {
+		monitoring.ObserveProcedureDuration(string(attempt.Procedure), ue.gnb, ue.amf, duration)
+	}
+}
+
+// Build returns the report of every attempt so far, attempts still pending are reported as incomplete.
+func Build() Report {
+	mu.Lock()
+	defer mu.Unlock()
+
+	report := Report{Start: start, End: time.Now(), Ues: []UeReport{}, Rate: rateTest, Capacity: capacity, Availability: timeline,
+		Detach: append([]DetachFailure(nil), detach...), ErrorIndications: errorIndications}
+	var all []Attempt
+	byGnb := map[string][]Attempt{}
+	byAmf := map[string][]Attempt{}
+	for msin, ue := range ues {
+		attempts := make([]Attempt, len(ue.attempts))
+		copy(attempts, ue.attempts)
+		for i := range attempts {
+			attempt := &attempts[i]
+			if attempt.Outcome == "" {
+				attempt.Outcome = Incomplete
+				attempt.Gnb = ue.gnb
+				attempt.Amf = ue.amf
+			}
+			byGnb[attempt.Gnb] = append(byGnb[attempt.Gnb], *attempt)
+			byAmf[attempt.Amf] = append(byAmf[attempt.Amf], *attempt)
+		}
+		all = append(all, attempts...)
+		report.Ues = append(report.Ues, UeReport{Msin: msin, Attempts: attempts, Failure: ue.failure})
+	}
+	sort.Slice(report.Ues, func(i, j int) bool { return report.Ues[i].Msin < report.Ues[j].Msin })
+
+	report.Summary = summarize(all)
+	report.ByGnb = summarizeNodes(byGnb)
+	report.ByAmf = summarizeNodes(byAmf)
+	report.Violations = report.assert(assertions)
+	return report
+}
+
+func summarizeNodes(attempts map[string][]Attempt) []NodeSummary {
+	summaries := []NodeSummary{}
+	for node, nodeAttempts := range attempts {
+		if node == "" {
+			node = "unknown"
+		}
+		summaries = append(summaries, NodeSummary{Node: node, Summary: summarize(nodeAttempts)})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Node < summaries[j].Node })
+	return summaries
+}
+
+// summarize aggregates attempts per procedure.
+func summarize(attempts []Attempt) []Summary {
+	summaries := map[Procedure]*Summary{}
+	durations := map[Procedure][]float64{}
+	for _, procedure := range Procedures {
+		summaries[procedure] = &Summary{Procedure: procedure, Causes: map[string]int{}}
+	}
+
+	for _, attempt := range attempts {
+		summary := summaries[attempt.Procedure]
+		summary.Attempts++
+		switch attempt.Outcome {
+		case Success:
+			summary.Successes++
+			durations[attempt.Procedure] = append(durations[attempt.Procedure], attempt.DurationMs)
+		case Failure:
+			summary.Failures++
+			summary.Causes[attempt.Cause]++
+		case Incomplete:
+			summary.Incomplete++
+		}
+	}
+
+	result := []Summary{}
+	for _, procedure := range Procedures {
+		summary := summaries[procedure]
+		if successes := durations[procedure]; len(successes) > 0 {
+			sort.Float64s(successes)
+			total := 0.0
+			for _, duration := range successes {
+				total += duration
+			}
+			summary.MinMs = successes[0]
+			summary.AvgMs = total / float64(len(successes))
+			summary.P50Ms = percentile(successes, 50)
+			summary.P95Ms = percentile(successes, 95)
+			summary.P99Ms = percentile(successes, 99)
+			summary.MaxMs = successes[len(successes)-1]
+		}
+		result = append(result, *summary)
+	}
+	return result
+}
+
+// percentile returns the nearest-rank percentile p of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Failed returns the number of attempts which did not succeed.
+func (report *Report) Failed() int {
+	failed := 0
+	for _, summary := range report.Summary {
+		failed += summary.Failures + summary.Incomplete
+	}
+	return failed
+}
+
+// LogLatencies logs the outcomes and latencies of the procedures attempted during the run.
+func (report *Report) LogLatencies() {
+	for _, summary := range report.Summary {
+		if summary.Attempts == 0 {
+			continue
+		}
+		log.Info(fmt.Sprintf("[TESTER] %s: %d attempts, %d successes, %d failures, %d incomplete, latency (ms) p50 %.1f, p95 %.1f, p99 %.1f, max %.1f",
+			summary.Procedure, summary.Attempts, summary.Successes, summary.Failures, summary.Incomplete,
+			summary.P50Ms, summary.P95Ms, summary.P99Ms, summary.MaxMs))
+	}
+}
+
+// WriteJSON writes the report in JSON to path.
+func (report *Report) WriteJSON(path string) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("unable to write report %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package report
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	Reset()
+
+	Start("0000000001", Registration)
+	Start("0000000001", Authentication)
+	Succeed("0000000001", Authentication)
+	Succeed("0000000001", Registration)
+	StartPduSession("0000000001", PduSessionEstablishment, 1)
+	FailPduSession("0000000001", PduSessionEstablishment, 1, "Insufficient resources")
+	// retried after the reject, without answer
+	StartPduSession("0000000001", PduSessionEstablishment, 1)
+	// no pending handover
+	Succeed("0000000001", Handover)
+
+	SetServingNodes("0000000002", "000002", "127.0.0.1:38412")
+	Start("0000000002", Registration)
+	Start("0000000002", Registration)
+	Fail("0000000002", Registration, "Illegal UE")
+	DetachFailed("0000000001", "UE context not released by the AMF")
+
+	report := Build()
+	assert.Len(t, report.Ues, 2)
+	assert.Equal(t, "0000000001", report.Ues[0].Msin)
+	assert.Len(t, report.Ues[0].Attempts, 4)
+	assert.Equal(t, Incomplete, report.Ues[0].Attempts[3].Outcome)
+	assert.Equal(t, uint8(1), report.Ues[0].Attempts[3].PduSessionId)
+
+	summaries := map[Procedure]Summary{}
+	for _, summary := range report.Summary {
+		summaries[summary.Procedure] = summary
+	}
+	assert.Equal(t, 3, summaries[Registration].Attempts)
+	assert.Equal(t, 1, summaries[Registration].Successes)
+	assert.Equal(t, 1, summaries[Registration].Failures)
+	assert.Equal(t, 1, summaries[Registration].Incomplete)
+	assert.Equal(t, map[string]int{"Illegal UE": 1}, summaries[Registration].Causes)
+	assert.Equal(t, 0, summaries[Handover].Attempts)
+	assert.Equal(t, 4, report.Failed())
+
+	assert.Len(t, report.ByGnb, 2)
+	assert.Equal(t, "000002", report.ByGnb[0].Node)
+	assert.Equal(t, 2, report.ByGnb[0].Summary[0].Attempts)
+	assert.Equal(t, "unknown", report.ByGnb[1].Node)
+	assert.Equal(t, "127.0.0.1:38412", report.ByAmf[0].Node)
+	assert.Equal(t, []DetachFailure{{Msin: "0000000001", Reason: "UE context not released by the AMF"}}, report.Detach)
+
+	dir := t.TempDir()
+	assert.NoError(t, report.WriteJSON(filepath.Join(dir, "report.json")))
+	assert.NoError(t, report.WriteJUnit(filepath.Join(dir, "report.xml")))
+
+	content, err := os.ReadFile(filepath.Join(dir, "report.xml"))
+	assert.NoError(t, err)
+	suites := junitTestSuites{}
+	assert.NoError(t, xml.Unmarshal(content, &suites))
+	assert.Equal(t, 6, suites.Tests)
+	assert.Equal(t, 2, suites.Failures)
+	assert.Equal(t, 2, suites.Errors)
+	assert.Equal(t, "Illegal UE", suites.Suites[0].Cases[2].Failure.Message)
+}
+
+func TestFailUe(t *testing.T) {
+	Reset()
+
+	Start("0000000001", Registration)
+	StartPduSession("0000000001", PduSessionEstablishment, 1)
+	FailUe("0000000001", "Security Mode Command is missing the NAS security algorithms")
+
+	report := Build()
+	assert.Equal(t, "Security Mode Command is missing the NAS security algorithms", report.Ues[0].Failure)
+	for _, attempt := range report.Ues[0].Attempts {
+		assert.Equal(t, Failure, attempt.Outcome)
+		assert.Equal(t, "Security Mode Command is missing the NAS security algorithms", attempt.Cause)
+	}
+	assert.Equal(t, 2, report.Failed())
+}
+
+func TestAssertions(t *testing.T) {
+	Reset()
+
+	Start("0000000001", Registration)
+	Succeed("0000000001", Registration)
+	Start("0000000001", Deregistration)
+	Succeed("0000000001", Deregistration)
+	Start("0000000002", Registration)
+	Succeed("0000000002", Registration)
+	Start("0000000003", Registration)
+	Fail("0000000003", Registration, "Illegal UE")
+	DetachFailed("0000000002", "UE context not released by the AMF")
+	ErrorIndicationReceived()
+
+	report := Build()
+	assert.Empty(t, report.Violations)
+	assert.Equal(t, 1, report.ErrorIndications)
+
+	SetAssertions(Assertions{MinRegistrationSuccessRatio: 0.5, NoErrorIndication: true, AllDeregistered: true})
+	report = Build()
+	assert.Equal(t, []Violation{
+		{Assertion: "Error Indications received", Expected: "0", Actual: "1"},
+		{Assertion: "UEs deregistered", Expected: "all", Actual: "1 UE(s) not deregistered: 0000000002"},
+	}, report.Violations)
+
+	SetAssertions(Assertions{MinRegistrationSuccessRatio: 0.9})
+	report = Build()
+	assert.Len(t, report.Violations, 1)
+	assert.Equal(t, "registration success ratio: expected >= 0.9000, got 0.6667 (2/3)", report.Violations[0].String())
+}
+
+func TestPercentile(t *testing.T) {
+	durations := make([]float64, 100)
+	for i := range durations {
+		durations[i] = float64(i + 1)
+	}
+	assert.Equal(t, 50.0, percentile(durations, 50))
+	assert.Equal(t, 95.0, percentile(durations, 95))
+	assert.Equal(t, 99.0, percentile(durations, 99))
+	assert.Equal(t, 7.0, percentile([]float64{7}, 99))
+}
+
+func TestRateMeter(t *testing.T) {
+	meter := NewRateMeter(2)
+	start := meter.start
+
+	// second 1: both registrations succeed
+	meter.Record(start, start.Add(100*time.Millisecond), true)
+	meter.Record(start.Add(500*time.Millisecond), start.Add(1200*time.Millisecond), true)
+	// second 2: one registration times out
+	meter.Record(start.Add(1*time.Second), start.Add(1300*time.Millisecond), true)
+	meter.Record(start.Add(1500*time.Millisecond), start.Add(11500*time.Millisecond), false)
+
+	second := meter.Second(0)
+	assert.Equal(t, 2, second.Started)
+	assert.Equal(t, 1.0, second.SuccessRatio)
+	assert.Equal(t, 1, second.Completed)
+	assert.Equal(t, 400.0, second.AvgMs)
+	assert.Equal(t, 700.0, second.P95Ms)
+
+	result := meter.Result(0.95, 0)
+	assert.Len(t, result.Seconds, 2)
+	assert.Equal(t, 2, result.Seconds[1].Completed)
+	assert.Equal(t, 0.75, result.SuccessRatio)
+	assert.Equal(t, 1.5, result.AchievedRate)
+	assert.True(t, result.Saturated)
+	assert.Equal(t, 2, result.SaturationSecond)
+
+	result = meter.Result(0.5, 500*time.Millisecond)
+	assert.True(t, result.Saturated)
+	assert.Equal(t, 1, result.SaturationSecond)
+	assert.Equal(t, "p95 latency 700.0ms is above 500ms", result.SaturationCause)
+
+	result = meter.Result(0.5, 0)
+	assert.False(t, result.Saturated)
+}
+
+func TestAvailabilityMonitor(t *testing.T) {
+	monitor := NewAvailabilityMonitor()
+	start := time.Now().Add(-10 * time.Second)
+	monitor.start = start
+
+	assert.False(t, monitor.Record(Check{Time: start, Check: SctpAssociation, Success: true}))
+	assert.False(t, monitor.Record(Check{Time: start, Check: NgSetup, Success: true}))
+	// the association is lost, then re-established before the AMF answers to NG Setups
+	assert.True(t, monitor.Record(Check{Time: start.Add(1 * time.Second), Check: SctpAssociation, Cause: "association lost"}))
+	assert.False(t, monitor.Available())
+	assert.False(t, monitor.Record(Check{Time: start.Add(2 * time.Second), Check: NgSetup, Cause: "no answer within 1s"}))
+	assert.False(t, monitor.Record(Check{Time: start.Add(3 * time.Second), Check: SctpAssociation, Success: true}))
+	assert.True(t, monitor.Record(Check{Time: start.Add(3 * time.Second), Check: NgSetup, Success: true}))
+	assert.True(t, monitor.Available())
+	// ongoing outage
+	assert.True(t, monitor.Record(Check{Time: start.Add(5 * time.Second), Check: CanaryRegistration, Cause: "UE not registered within 1s"}))
+
+	timeline := monitor.Timeline()
+	assert.Len(t, timeline.Outages, 2)
+	assert.Equal(t, 2000.0, timeline.Outages[0].DurationMs)
+	assert.Equal(t, "sctp-association: association lost", timeline.Outages[0].Cause)
+	assert.True(t, timeline.Outages[1].Ongoing)
+	assert.Equal(t, 2000.0, timeline.MttrMs)
+	assert.Len(t, timeline.Checks, 7)
+	assert.Len(t, timeline.Changes, 7)
+	// 2s and 5s of outages over 10s
+	assert.InDelta(t, 0.3, timeline.Availability, 0.01)
+}
@@ -0,0 +1,264 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package script
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Actions of a declarative scenario step.
+const (
+	ActionRegister       = "register"
+	ActionWaitForState   = "wait-for-state"
+	ActionPduSession     = "pdu-session"
+	ActionRelease        = "release"
+	ActionHandover       = "handover"
+	ActionIdle           = "idle"
+	ActionServiceRequest = "service-request"
+	ActionDeregister     = "deregister"
+	ActionThink          = "think"
+)
+
+// Distributions of the think time.
+const (
+	DistributionFixed       = "fixed"
+	DistributionUniform     = "uniform"
+	DistributionExponential = "exponential"
+	DistributionNormal      = "normal"
+)
+
+const defaultWaitTimeout = 10 * time.Second
+
+// Scenario is a declarative scenario, written in YAML or JSON, eg:
+//
+//	gnodebs: 2
+//	groups:
+//	  - name: attach
+//	    count: 10
+//	    start: 1s
+//	    interval: 100ms
+//	    steps:
+//	      - action: register
+//	      - action: wait-for-state
+//	        state: MM5G_REGISTERED
+//	        timeout: 5s
+//	      - action: pdu-session
+//	      - action: think
+//	        distribution: exponential
+//	        mean: 2s
+//	      - action: handover
+//	      - action: idle
+//	      - action: think
+//	        duration: 10s
+//	      - action: service-request
+//	      - action: release
+//	        id: 1
+//	      - action: deregister
+type Scenario struct {
+	GNodeBs int     `yaml:"gnodebs"` // number of gNodeBs, defaults to 1
+	Groups  []Group `yaml:"groups"`
+}
+
+// Group is a set of UEs running the same steps.
+type Group struct {
+	Name     string        `yaml:"name"`
+	Count    int           `yaml:"count"`    // number of UEs, defaults to 1
+	Start    time.Duration `yaml:"start"`    // offset of the first UE from the beginning of the scenario
+	Interval time.Duration `yaml:"interval"` // time between the start of two UEs of the group
+	GNodeB   *int          `yaml:"gnodeb"`   // index of the gNodeB of the UEs, UEs are spread over every gNodeB by default
+	Steps    []Step        `yaml:"steps"`
+}
+
+// Step is an action performed by a UE, steps of a group are run in order.
+type Step struct {
+	Action string `yaml:"action"`
+
+	// wait-for-state
+	State   string        `yaml:"state"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// release
+	Id uint8 `yaml:"id"`
+
+	// handover, index of the target gNodeB, defaults to the next gNodeB
+	GNodeB *int `yaml:"gnodeb"`
+
+	// think
+	Duration     time.Duration `yaml:"duration"`
+	Distribution string        `yaml:"distribution"`
+	Min          time.Duration `yaml:"min"`
+	Max          time.Duration `yaml:"max"`
+	Mean         time.Duration `yaml:"mean"`
+	StdDev       time.Duration `yaml:"stddev"`
+}
+
+var states = map[string]int{
+	"MM5G_NULL":                 ueCtx.MM5G_NULL,
+	"MM5G_DEREGISTERED":         ueCtx.MM5G_DEREGISTERED,
+	"MM5G_REGISTERED_INITIATED": ueCtx.MM5G_REGISTERED_INITIATED,
+	"MM5G_REGISTERED":           ueCtx.MM5G_REGISTERED,
+	"MM5G_SERVICE_REQ_INIT":     ueCtx.MM5G_SERVICE_REQ_INIT,
+	"MM5G_DEREGISTERED_INIT":    ueCtx.MM5G_DEREGISTERED_INIT,
+}
+
+// LoadScenario reads and validates a declarative scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read scenario %s: %w", path, err)
+	}
+
+	scenario := &Scenario{}
+	if err := yaml.UnmarshalStrict(file, scenario); err != nil {
+		return nil, fmt.Errorf("could not parse scenario %s: %w", path, err)
+	}
+
+	if err := scenario.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s:\n%w", path, err)
+	}
+
+	return scenario, nil
+}
+
+// NumUes returns the number of UEs of every group.
+func (scenario *Scenario) NumUes() int {
+	count := 0
+	for _, group := range scenario.Groups {
+		count += group.Count
+	}
+	return count
+}
+
+func (scenario *Scenario) validate() error {
+	var errs []error
+
+	if scenario.GNodeBs == 0 {
+		scenario.GNodeBs = 1
+	}
+	if scenario.GNodeBs < 0 {
+		errs = append(errs, fmt.Errorf("gnodebs: %d must be positive", scenario.GNodeBs))
+	}
+	if len(scenario.Groups) == 0 {
+		errs = append(errs, errors.New("groups: at least one group is required"))
+	}
+
+	for i := range scenario.Groups {
+		group := &scenario.Groups[i]
+		prefix := fmt.Sprintf("groups[%d]", i)
+		if group.Count == 0 {
+			group.Count = 1
+		}
+		if group.Count < 0 {
+			errs = append(errs, fmt.Errorf("%s.count: %d must be positive", prefix, group.Count))
+		}
+		if group.Start < 0 || group.Interval < 0 {
+			errs = append(errs, fmt.Errorf("%s: start and interval must be positive", prefix))
+		}
+		if group.GNodeB != nil && (*group.GNodeB < 0 || *group.GNodeB >= scenario.GNodeBs) {
+			errs = append(errs, fmt.Errorf("%s.gnodeb: %d must lie between 0 and %d", prefix, *group.GNodeB, scenario.GNodeBs-1))
+		}
+		for j := range group.Steps {
+			if err := group.Steps[j].validate(scenario.GNodeBs); err != nil {
+				errs = append(errs, fmt.Errorf("%s.steps[%d]: %w", prefix, j, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (step *Step) validate(numGnbs int) error {
+	switch step.Action {
+	case ActionRegister, ActionPduSession, ActionIdle, ActionServiceRequest, ActionDeregister:
+
+	case ActionWaitForState:
+		if _, err := StateFromName(step.State); err != nil {
+			return err
+		}
+		if step.Timeout == 0 {
+			step.Timeout = defaultWaitTimeout
+		}
+
+	case ActionRelease:
+		if step.Id == 0 {
+			step.Id = 1
+		}
+		if step.Id > 16 {
+			return fmt.Errorf("PDU Session id %d must lie between 1 and 16", step.Id)
+		}
+
+	case ActionHandover:
+		if numGnbs < 2 {
+			return errors.New("handover requires at least two gnodebs")
+		}
+		if step.GNodeB != nil && (*step.GNodeB < 0 || *step.GNodeB >= numGnbs) {
+			return fmt.Errorf("gnodeb %d must lie between 0 and %d", *step.GNodeB, numGnbs-1)
+		}
+
+	case ActionThink:
+		if step.Distribution == "" {
+			step.Distribution = DistributionFixed
+		}
+		switch step.Distribution {
+		case DistributionFixed:
+		case DistributionUniform:
+			if step.Max < step.Min {
+				return errors.New("max of uniform distribution must be greater than min")
+			}
+		case DistributionExponential, DistributionNormal:
+			if step.Mean <= 0 {
+				return fmt.Errorf("mean of %s distribution must be positive", step.Distribution)
+			}
+		default:
+			return fmt.Errorf("unknown distribution %q", step.Distribution)
+		}
+
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+
+	return nil
+}
+
+// ThinkTime returns the time to wait for a think step, drawn from its distribution.
+func (step *Step) ThinkTime() time.Duration {
+	var duration time.Duration
+	switch step.Distribution {
+	case DistributionUniform:
+		duration = step.Min + time.Duration(rand.Int63n(int64(step.Max-step.Min)+1))
+	case DistributionExponential:
+		duration = time.Duration(rand.ExpFloat64() * float64(step.Mean))
+	case DistributionNormal:
+		duration = time.Duration(math.Round(rand.NormFloat64()*float64(step.StdDev) + float64(step.Mean)))
+	default:
+		duration = step.Duration
+	}
+	if duration < 0 {
+		return 0
+	}
+	return duration
+}
+
+// StateFromName returns the UE state matching name, eg: MM5G_REGISTERED or registered.
+func StateFromName(name string) (int, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "MM5G_") {
+		name = "MM5G_" + name
+	}
+	state, ok := states[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown state %q", name)
+	}
+	return state, nil
+}
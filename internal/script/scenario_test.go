@@ -0,0 +1,46 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package script
+
+import (
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSampleScenario(t *testing.T) {
+	scenario, err := LoadScenario("../../scenarios/sample.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, scenario.GNodeBs)
+	assert.Equal(t, 15, scenario.NumUes())
+	assert.Equal(t, 5*time.Second, scenario.Groups[0].Steps[1].Timeout)
+	assert.Equal(t, defaultWaitTimeout, scenario.Groups[1].Steps[1].Timeout)
+}
+
+func TestLoadInvalidScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.json")
+	err := os.WriteFile(path, []byte(`{"groups": [{"steps": [
+		{"action": "handover"},
+		{"action": "wait-for-state", "state": "flying"},
+		{"action": "think", "distribution": "normal"}
+	]}]}`), 0o600)
+	assert.NoError(t, err)
+
+	_, err = LoadScenario(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "groups[0].steps[0]: handover requires at least two gnodebs")
+	assert.Contains(t, err.Error(), `groups[0].steps[1]: unknown state "MM5G_FLYING"`)
+	assert.Contains(t, err.Error(), "groups[0].steps[2]: mean of normal distribution must be positive")
+}
+
+func TestStateFromName(t *testing.T) {
+	state, err := StateFromName("registered")
+	assert.NoError(t, err)
+	assert.Equal(t, ueCtx.MM5G_REGISTERED, state)
+}
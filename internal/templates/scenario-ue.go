@@ -0,0 +1,143 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package templates
+
+import (
+	"my5G-RANTester/config"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	"my5G-RANTester/internal/control_test_engine/ue"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/control_test_engine/ue/scenario"
+	"sync"
+	"time"
+)
+
+// scenarioUe is a UE driven by a custom scenario.
+type scenarioUe struct {
+	*ueStateTracker
+	id int
+	rx chan procedures.UeTesterMessage
+}
+
+func newScenarioUe(ueId int, ueCfg config.Config, gnb *gnbCxt.GNBContext, wg *sync.WaitGroup) *scenarioUe {
+	rx := make(chan procedures.UeTesterMessage)
+	ueTx := ue.NewUE(ueCfg, uint8(ueId), rx, gnb, wg)
+	return &scenarioUe{ueStateTracker: newUeStateTracker(ueTx), id: ueId, rx: rx}
+}
+
+// send sends msg to the UE, it returns false if the UE was already terminated, eg: after a registration reject.
+func (scenarioUe *scenarioUe) send(msg procedures.UeTesterMessage) bool {
+	select {
+	case scenarioUe.rx <- msg:
+		return true
+	case <-scenarioUe.done:
+		return false
+	}
+}
+
+// ueStateTracker follows the state changes of a UE and of its PDU Sessions, so that scenarios can wait for a given state.
+type ueStateTracker struct {
+	mu          sync.Mutex
+	state       int
+	pduSessions map[uint8]scenario.ScenarioMessage // last change of each PDU Session
+	terminated  bool
+	changed     chan struct{} // closed on every state change
+	done        chan struct{} // closed once the UE is terminated
+}
+
+func newUeStateTracker(ueTx chan scenario.ScenarioMessage) *ueStateTracker {
+	tracker := &ueStateTracker{
+		state:       ueCtx.MM5G_NULL,
+		pduSessions: map[uint8]scenario.ScenarioMessage{},
+		changed:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go func() {
+		for msg := range ueTx {
+			tracker.update(func() {
+				tracker.state = msg.StateChange
+				if msg.PduSessionId != 0 {
+					tracker.pduSessions[msg.PduSessionId] = msg
+				}
+			})
+		}
+		tracker.update(func() {
+			tracker.state = ueCtx.MM5G_NULL
+			tracker.terminated = true
+		})
+		close(tracker.done)
+	}()
+	return tracker
+}
+
+func (tracker *ueStateTracker) update(change func()) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	change()
+	close(tracker.changed)
+	tracker.changed = make(chan struct{})
+}
+
+func (tracker *ueStateTracker) getState() int {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.state
+}
+
+func (tracker *ueStateTracker) isTerminated() bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.terminated
+}
+
+// pduSessionIp returns the IP of an active PDU Session, or an empty string.
+func (tracker *ueStateTracker) pduSessionIp(pduSessionId uint8) string {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	pduSession := tracker.pduSessions[pduSessionId]
+	if pduSession.StateSM != ueCtx.SM5G_PDU_SESSION_ACTIVE {
+		return ""
+	}
+	return pduSession.Ip
+}
+
+// waitFor waits for the UE to reach a 5GMM state, it returns false on timeout or if the UE is terminated.
+func (tracker *ueStateTracker) waitFor(state int, timeout time.Duration) bool {
+	return tracker.waitUntil(func() bool { return tracker.state == state }, timeout)
+}
+
+// waitForPduSession waits for a PDU Session to reach a 5GSM state, it returns false on timeout or if the UE is terminated.
+func (tracker *ueStateTracker) waitForPduSession(pduSessionId uint8, state int, timeout time.Duration) bool {
+	return tracker.waitUntil(func() bool {
+		pduSession, ok := tracker.pduSessions[pduSessionId]
+		if !ok {
+			return state == ueCtx.SM5G_PDU_SESSION_INACTIVE
+		}
+		return pduSession.StateSM == state
+	}, timeout)
+}
+
+// waitUntil waits for reached to be true, reached is called with the lock held.
+func (tracker *ueStateTracker) waitUntil(reached func() bool, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		tracker.mu.Lock()
+		ok, terminated, changed := reached(), tracker.terminated, tracker.changed
+		tracker.mu.Unlock()
+
+		if ok {
+			return true
+		}
+		if terminated {
+			return false
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package templates
+
+import (
+	"fmt"
+	"my5G-RANTester/config"
+	"my5G-RANTester/internal/control_test_engine/gnb"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	serviceNgap "my5G-RANTester/internal/control_test_engine/gnb/ngap/service"
+	"my5G-RANTester/internal/control_test_engine/gnb/ngap/trigger"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/report"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TestAmfHealth monitors the availability of the AMF during duration, or until interrupted if 0. It keeps an SCTP
+// association with the AMF, re-established once lost, and probes the AMF every interval with an NG Setup, and every
+// canaryInterval (unless 0) with the registration of a canary UE, the UE of the configuration. The AMF is unavailable
+// from the first failed check until every check succeeds again.
+func TestAmfHealth(duration time.Duration, interval time.Duration, canaryInterval time.Duration, timeout time.Duration) report.Timeline {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Fatal("[TESTER][CONFIG] Unable to read configuration")
+	}
+
+	gnbCtx, amf := gnb.InitGnbForMonitor(cfg)
+	monitor := report.NewAvailabilityMonitor()
+	record := func(check report.Check) {
+		if check.Success {
+			log.Debug("[TESTER][HEALTH] ", check.Check, " succeeded in ", check.LatencyMs, "ms")
+		} else {
+			log.Warn("[TESTER][HEALTH] ", check.Check, " failed: ", check.Cause)
+		}
+		if !monitor.Record(check) {
+			return
+		}
+		if monitor.Available() {
+			timeline := monitor.Timeline()
+			outage := timeline.Outages[len(timeline.Outages)-1]
+			log.Warn("[TESTER][HEALTH] AMF available again, after an outage of ", outage.DurationMs, "ms")
+		} else {
+			log.Error("[TESTER][HEALTH] AMF unavailable: ", check.Check, " failed")
+		}
+	}
+
+	connect := func() bool {
+		start := time.Now()
+		if err := serviceNgap.InitConn(amf, gnbCtx); err != nil {
+			record(report.Check{Time: start, Check: report.SctpAssociation, Cause: err.Error()})
+			return false
+		}
+		log.Info("[TESTER][HEALTH] SCTP association established with AMF ", amf.GetAmfIp(), ":", amf.GetAmfPort())
+		record(report.Check{Time: start, Check: report.SctpAssociation, Success: true, LatencyMs: elapsedMs(start)})
+		return true
+	}
+
+	var end <-chan time.Time
+	if duration > 0 {
+		end = time.After(duration)
+	}
+
+	probeTicker := time.NewTicker(interval)
+	defer probeTicker.Stop()
+	var canaryTick <-chan time.Time
+	if canaryInterval > 0 {
+		canaryTicker := time.NewTicker(canaryInterval)
+		defer canaryTicker.Stop()
+		canaryTick = canaryTicker.C
+	}
+	canaryWg := sync.WaitGroup{}
+	canaryRunning := false
+	canaryDone := make(chan report.Check)
+
+	connected := connect()
+	if connected {
+		record(probeNgSetup(gnbCtx, amf, timeout))
+	}
+monitoring:
+	for {
+		var lost <-chan struct{}
+		if connected {
+			lost = amf.AssociationLost()
+		}
+
+		select {
+		case <-lost:
+			record(report.Check{Time: time.Now(), Check: report.SctpAssociation, Cause: "association lost"})
+			if conn := amf.GetSCTPConn(); conn != nil {
+				conn.Close()
+			}
+			connected = false
+		case <-probeTicker.C:
+			if !connected {
+				connected = connect()
+			}
+			if connected {
+				record(probeNgSetup(gnbCtx, amf, timeout))
+			}
+		case <-canaryTick:
+			// the canary is only registered through an established association, and one at a time
+			if connected && amf.GetState() == gnbCxt.Active && !canaryRunning {
+				canaryRunning = true
+				canaryWg.Add(1)
+				go func() {
+					defer canaryWg.Done()
+					canaryDone <- registerCanary(cfg, gnbCtx, timeout)
+				}()
+			}
+		case check := <-canaryDone:
+			canaryRunning = false
+			record(check)
+		case <-end:
+			break monitoring
+		case <-lifecycle.Context().Done():
+			log.Warn("[TESTER][HEALTH] Interrupted")
+			break monitoring
+		}
+	}
+
+	if canaryRunning {
+		record(<-canaryDone)
+	}
+	canaryWg.Wait()
+	gnb.Shutdown(gnbCtx, time.Now().Add(lifecycle.DrainTimeout()))
+
+	timeline := monitor.Timeline()
+	log.Info(fmt.Sprintf("[TESTER][HEALTH] AMF availability %.4f%% over %s, %d outage(s), MTTR %.1fms",
+		100*timeline.Availability, timeline.End.Sub(timeline.Start).Round(time.Second), len(timeline.Outages), timeline.MttrMs))
+	for _, outage := range timeline.Outages {
+		log.Info(fmt.Sprintf("[TESTER][HEALTH] Outage from %s to %s (%.1fms): %s",
+			outage.Start.Format(time.RFC3339Nano), outage.End.Format(time.RFC3339Nano), outage.DurationMs, outage.Cause))
+	}
+	report.SetTimeline(timeline)
+	return timeline
+}
+
+// probeNgSetup sends an NG Setup Request over the established association, and waits for the answer of the AMF.
+func probeNgSetup(gnbCtx *gnbCxt.GNBContext, amf *gnbCxt.GNBAmf, timeout time.Duration) report.Check {
+	check := report.Check{Time: time.Now(), Check: report.NgSetup}
+	responses, failures := amf.GetNgSetupOutcomes()
+	lost := amf.AssociationLost()
+	trigger.SendNgSetupRequest(gnbCtx, amf)
+
+	deadline := time.After(timeout)
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+	for {
+		select {
+		case <-poll.C:
+			newResponses, newFailures := amf.GetNgSetupOutcomes()
+			if newResponses > responses {
+				check.Success = true
+				check.LatencyMs = elapsedMs(check.Time)
+				return check
+			}
+			if newFailures > failures {
+				check.Cause = "NG Setup Failure"
+				check.LatencyMs = elapsedMs(check.Time)
+				return check
+			}
+		case <-lost:
+			check.Cause = "association lost"
+			return check
+		case <-deadline:
+			check.Cause = fmt.Sprint("no answer within ", timeout)
+			return check
+		}
+	}
+}
+
+// registerCanary registers the UE of the configuration, and deregisters it.
+func registerCanary(cfg config.Config, gnbCtx *gnbCxt.GNBContext, timeout time.Duration) report.Check {
+	check := report.Check{Time: time.Now(), Check: report.CanaryRegistration}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	ue := newScenarioUe(1, cfg, gnbCtx, &wg)
+	ue.send(procedures.UeTesterMessage{Type: procedures.Registration})
+
+	if ue.waitFor(ueCtx.MM5G_REGISTERED, timeout) {
+		check.Success = true
+		check.LatencyMs = elapsedMs(check.Time)
+	} else if ue.isTerminated() {
+		check.Cause = "UE terminated before being registered"
+	} else {
+		check.Cause = fmt.Sprint("UE not registered within ", timeout)
+	}
+
+	ue.send(procedures.UeTesterMessage{Type: procedures.Terminate})
+	wg.Wait()
+	return check
+}
+
+func elapsedMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
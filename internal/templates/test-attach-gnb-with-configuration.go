@@ -7,7 +7,10 @@ package templates
 import (
 	log "github.com/sirupsen/logrus"
 	"my5G-RANTester/config"
+	"my5G-RANTester/internal/common/tools"
 	"my5G-RANTester/internal/control_test_engine/gnb"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/lifecycle"
 	"sync"
 )
 
@@ -28,9 +31,11 @@ func TestAttachGnbWithConfiguration() {
 	// cfg.GNodeB.SliceSupportList.St = "10"
 	// cfg.GNodeB.SliceSupportList.Sst = "010239"
 
-	go gnb.InitGnb(cfg, &wg)
+	gnbCtx := gnb.InitGnb(cfg, &wg)
 
 	wg.Add(1)
 
+	<-lifecycle.Context().Done()
+	tools.Shutdown(nil, []*gnbCxt.GNBContext{gnbCtx})
 	wg.Wait()
 }
@@ -4,6 +4,8 @@
  */
 package templates
 
+import "my5G-RANTester/internal/work_load_model"
+
 func TestAttachUeWithConfiguration(tunnelEnabled bool) {
-	TestMultiUesInQueue(1, tunnelEnabled, true, false, 500, 0, 0, 1)
+	TestMultiUesInQueue(1, tunnelEnabled, true, false, 500, 0, 0, 1, "", work_load_model.Fixed, 0)
 }
@@ -0,0 +1,92 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package templates
+
+import (
+	"fmt"
+	"my5G-RANTester/internal/common/tools"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/report"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TestCapacitySearch binary-searches the highest registration rate between minRate and maxRate whose load steps, of
+// stepDuration seconds each, meet the SLOs: a success ratio of at least minSuccessRatio, and a p99 registration
+// latency of at most maxP99Latency (unless 0). The search stops once the capacity is known within precision
+// registrations per second, the AMF is left to recover for cooldown between steps.
+func TestCapacitySearch(minRate int, maxRate int, stepDuration int, numGnbs int, pduSessions int, timeout time.Duration,
+	minSuccessRatio float64, maxP99Latency time.Duration, precision int, cooldown time.Duration) report.CapacitySearch {
+
+	runner := newRateRunner(maxRate*stepDuration, numGnbs)
+	search := report.CapacitySearch{Steps: []report.CapacityStep{}}
+
+	// step runs a load step, it returns whether the step met the SLOs, and false if the search was interrupted
+	step := func(rate int) (bool, bool) {
+		if len(search.Steps) > 0 {
+			select {
+			case <-time.After(cooldown):
+			case <-lifecycle.Context().Done():
+				return false, false
+			}
+		}
+		log.Info("[TESTER][CAPACITY] Load step at ", rate, " registrations per second during ", stepDuration, " seconds")
+		meter, completed := runner.run(rate, stepDuration, pduSessions, timeout)
+		if !completed {
+			return false, false
+		}
+
+		result := meter.Result(minSuccessRatio, maxP99Latency)
+		passed := result.SuccessRatio >= minSuccessRatio &&
+			(maxP99Latency == 0 || result.P99Ms <= float64(maxP99Latency.Milliseconds()))
+		search.Steps = append(search.Steps, report.CapacityStep{RateTest: result, Passed: passed})
+		logCapacityStep(search.Steps[len(search.Steps)-1])
+		return passed, true
+	}
+
+	// the capacity is between low, which meets the SLOs, and high, which does not
+	low, high := 0, maxRate+1
+	for rate := minRate; high-low > precision; rate = low + (high-low)/2 {
+		passed, completed := step(rate)
+		if !completed {
+			log.Warn("[TESTER][CAPACITY] Capacity search interrupted")
+			break
+		}
+		if passed {
+			low = rate
+		} else {
+			high = rate
+			if rate == minRate {
+				break
+			}
+		}
+	}
+	search.Capacity = low
+	tools.Shutdown(nil, runner.gnbs)
+
+	sort.Slice(search.Steps, func(i, j int) bool { return search.Steps[i].TargetRate < search.Steps[j].TargetRate })
+	log.Info("[TESTER][CAPACITY] Registration rate curve:")
+	for _, capacityStep := range search.Steps {
+		logCapacityStep(capacityStep)
+	}
+	if search.Capacity == 0 {
+		log.Warn("[TESTER][CAPACITY] The SLOs are not met at the minimum rate of ", minRate, " registrations per second")
+	} else {
+		log.Info("[TESTER][CAPACITY] Maximum sustainable rate: ", search.Capacity, " registrations per second")
+	}
+	report.SetCapacitySearch(search)
+	return search
+}
+
+func logCapacityStep(capacityStep report.CapacityStep) {
+	outcome := "fail"
+	if capacityStep.Passed {
+		outcome = "pass"
+	}
+	log.Info(fmt.Sprintf("[TESTER][CAPACITY] %d/s: achieved %.1f/s, success ratio %.2f, latency (ms) p95 %.1f, p99 %.1f: %s",
+		capacityStep.TargetRate, capacityStep.AchievedRate, capacityStep.SuccessRatio, capacityStep.P95Ms, capacityStep.P99Ms, outcome))
+}
@@ -5,60 +5,96 @@
 package templates
 
 import (
-	log "github.com/sirupsen/logrus"
-	"github.com/tetratelabs/wazero"
+	"context"
+	"fmt"
 	"my5G-RANTester/config"
-	"my5G-RANTester/internal/control_test_engine/gnb"
+	"my5G-RANTester/internal/common/tools"
 	"my5G-RANTester/internal/control_test_engine/procedures"
-	"my5G-RANTester/internal/control_test_engine/ue"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
 	"my5G-RANTester/internal/script"
 	"os"
 	"sync"
 	"time"
-)
 
-func TestWithCustomScenario(scenarioPath string) {
-	wg := sync.WaitGroup{}
+	log "github.com/sirupsen/logrus"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
 
+// TestWithCustomScenario runs the ueHandler(ueId) function of a WebAssembly scenario concurrently for numUes UEs
+func TestWithCustomScenario(scenarioPath string, numUes int) {
 	cfg, err := config.GetConfig()
 	if err != nil {
-		//return nil
-		log.Fatal("Error in get configuration")
+		log.Fatal("[TESTER][CONFIG] Unable to read configuration")
 	}
 
-	wg.Add(1)
-
-	gnb := gnb.InitGnb(cfg, &wg)
+	var subscribers []config.Ue
+	if cfg.Subscribers != "" {
+		subscribers, err = config.LoadSubscribers(cfg.Subscribers, cfg.Ue)
+		if err != nil {
+			log.Fatal("[TESTER][CONFIG] ", err)
+		}
+		if numUes > len(subscribers) {
+			log.Fatal("[TESTER][CONFIG] ", numUes, " UEs requested, but only ", len(subscribers), " subscribers are defined in ", cfg.Subscribers)
+		}
+	}
 
-	time.Sleep(1 * time.Second)
+	wasm, err := os.ReadFile(scenarioPath)
+	if err != nil {
+		log.Fatal("[TESTER][SCENARIO] ", err)
+	}
 
-	ueChan := make(chan procedures.UeTesterMessage)
+	numGnb := 1
+	if len(cfg.GNodeBs) > 0 {
+		numGnb = len(cfg.GNodeBs)
+	}
+	gnbWg := sync.WaitGroup{}
+	gnbs := tools.CreateGnbs(numGnb, cfg, &gnbWg)
 
-	wg.Add(1)
+	// Wait for gNB to be connected before registering UEs
+	// TODO: We should wait for NGSetupResponse instead
+	time.Sleep(1 * time.Second)
 
-	_ = ue.NewUE(cfg, 1, ueChan, gnb, &wg)
+	ueWg := sync.WaitGroup{}
+	ues := make(map[uint32]*scenarioUe, numUes)
+	for ueId := 1; ueId <= numUes; ueId++ {
+		ueWg.Add(1)
+		ues[uint32(ueId)] = newScenarioUe(ueId, tools.UeConfig(ueId, cfg, subscribers), gnbs[ueId%numGnb], &ueWg)
+	}
+	getUe := func(ueId uint32) *scenarioUe {
+		ue, ok := ues[ueId]
+		if !ok {
+			log.Error("[TESTER][SCENARIO] Unknown UE ", ueId, ", UE ids lie between 1 and ", numUes)
+		}
+		return ue
+	}
+	send := func(ueId uint32, msg procedures.UeTesterMessage) {
+		if ue := getUe(ueId); ue != nil {
+			ue.send(msg)
+		}
+	}
 
 	ctx, runtime := script.NewCustomScenario(scenarioPath)
 
 	_, err = runtime.NewHostModuleBuilder("env").
 		NewFunctionBuilder().
 		WithFunc(func(ueId uint32) {
-			ueChan <- procedures.UeTesterMessage{Type: procedures.Registration}
+			send(ueId, procedures.UeTesterMessage{Type: procedures.Registration})
 		}).
 		Export("attach").
 		NewFunctionBuilder().
 		WithFunc(func(ueId uint32) {
-			ueChan <- procedures.UeTesterMessage{Type: procedures.Deregistration}
+			send(ueId, procedures.UeTesterMessage{Type: procedures.Deregistration})
 		}).
 		Export("detach").
 		NewFunctionBuilder().
-		WithFunc(func(ueId uint32, pduSessionId uint8) {
-			ueChan <- procedures.UeTesterMessage{Type: procedures.NewPDUSession, Param: pduSessionId-1}
+		WithFunc(func(ueId uint32, pduSessionId uint32) {
+			send(ueId, procedures.UeTesterMessage{Type: procedures.NewPDUSession, Param: uint8(pduSessionId - 1)})
 		}).
 		Export("pduSessionRequest").
 		NewFunctionBuilder().
-		WithFunc(func(ueId uint32, pduSessionId uint8) {
-			ueChan <- procedures.UeTesterMessage{Type: procedures.DestroyPDUSession, Param: pduSessionId-1}
+		WithFunc(func(ueId uint32, pduSessionId uint32) {
+			send(ueId, procedures.UeTesterMessage{Type: procedures.DestroyPDUSession, Param: uint8(pduSessionId)})
 		}).
 		Export("pduSessionRelease").
 		NewFunctionBuilder().
@@ -66,35 +102,77 @@ func TestWithCustomScenario(scenarioPath string) {
 			time.Sleep(time.Duration(v) * time.Millisecond)
 		}).
 		Export("think").
+		// waitForState returns 1 once the UE reached the 5GMM state, eg: 3 for MM5G_REGISTERED, or 0 after timeoutMs
+		NewFunctionBuilder().
+		WithFunc(func(ueId uint32, state uint32, timeoutMs uint32) uint32 {
+			ue := getUe(ueId)
+			if ue == nil || !ue.waitFor(int(state), time.Duration(timeoutMs)*time.Millisecond) {
+				return 0
+			}
+			return 1
+		}).
+		Export("waitForState").
+		// waitForPduSession returns 1 once the PDU Session is active, or 0 after timeoutMs
+		NewFunctionBuilder().
+		WithFunc(func(ueId uint32, pduSessionId uint32, timeoutMs uint32) uint32 {
+			ue := getUe(ueId)
+			if ue == nil || !ue.waitForPduSession(uint8(pduSessionId), ueCtx.SM5G_PDU_SESSION_ACTIVE, time.Duration(timeoutMs)*time.Millisecond) {
+				return 0
+			}
+			return 1
+		}).
+		Export("waitForPduSession").
+		// getPduSessionIp writes the IP of an active PDU Session in the buffer of the guest, and returns its length, or 0
+		NewFunctionBuilder().
+		WithFunc(func(_ context.Context, m api.Module, ueId uint32, pduSessionId uint32, buf uint32, bufLen uint32) uint32 {
+			ue := getUe(ueId)
+			if ue == nil {
+				return 0
+			}
+			ip := ue.pduSessionIp(uint8(pduSessionId))
+			if ip == "" || uint32(len(ip)) > bufLen || !m.Memory().Write(buf, []byte(ip)) {
+				return 0
+			}
+			return uint32(len(ip))
+		}).
+		Export("getPduSessionIp").
 		Instantiate(ctx)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("[TESTER][SCENARIO] ", err)
 	}
 
-	// Instantiate the guest Wasm into the same runtime. It exports the `add`
-	// function, implemented in WebAssembly.
-	addWasm, err := os.ReadFile(scenarioPath)
+	compiled, err := runtime.CompileModule(ctx, wasm)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("[TESTER][SCENARIO] Failed to compile ", scenarioPath, ": ", err)
 	}
 
-	config := wazero.NewModuleConfig().
-		WithStdout(os.Stdout).
-		WithStderr(os.Stderr)
-
-	module, err := runtime.InstantiateWithConfig(ctx, addWasm, config)
-	if err != nil {
-		log.Fatal("failed to instantiate module: %v", err)
+	// Each UE has its own instance of the scenario, as an instance cannot be called concurrently
+	for ueId := uint32(1); ueId <= uint32(numUes); ueId++ {
+		go func(ueId uint32) {
+			defer ues[ueId].send(procedures.UeTesterMessage{Type: procedures.Terminate})
+
+			moduleConfig := wazero.NewModuleConfig().
+				WithName(fmt.Sprintf("ue%d", ueId)).
+				WithStdout(os.Stdout).
+				WithStderr(os.Stderr)
+			module, err := runtime.InstantiateModule(ctx, compiled, moduleConfig)
+			if err != nil {
+				log.Error("[TESTER][SCENARIO][UE ", ueId, "] Failed to instantiate ", scenarioPath, ": ", err)
+				return
+			}
+
+			ueHandler := module.ExportedFunction("ueHandler")
+			if ueHandler == nil {
+				log.Error("[TESTER][SCENARIO] ", scenarioPath, " does not export ueHandler")
+				return
+			}
+			if _, err := ueHandler.Call(ctx, uint64(ueId)); err != nil {
+				log.Error("[TESTER][SCENARIO][UE ", ueId, "] ueHandler failed: ", err)
+			}
+		}(ueId)
 	}
 
-	// Call the `add` function and print the results to the console.
-	ueHandler := module.ExportedFunction("ueHandler")
-	results, err := ueHandler.Call(ctx, 1)
-	if err != nil {
-		log.Fatal("failed to call ", err)
-	}
-
-	log.Info(results)
-
-	wg.Wait()
+	ueWg.Wait()
+	log.Info("[TESTER][SCENARIO] Scenario ", scenarioPath, " is over")
+	tools.Shutdown(nil, gnbs)
 }
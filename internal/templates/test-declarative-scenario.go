@@ -0,0 +1,116 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package templates
+
+import (
+	"my5G-RANTester/config"
+	"my5G-RANTester/internal/common/tools"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	"my5G-RANTester/internal/script"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TestWithDeclarativeScenario runs a YAML or JSON scenario, see script.Scenario
+func TestWithDeclarativeScenario(scenarioPath string) {
+	scn, err := script.LoadScenario(scenarioPath)
+	if err != nil {
+		log.Fatal("[TESTER][SCENARIO] ", err)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Fatal("[TESTER][CONFIG] Unable to read configuration")
+	}
+
+	var subscribers []config.Ue
+	if cfg.Subscribers != "" {
+		subscribers, err = config.LoadSubscribers(cfg.Subscribers, cfg.Ue)
+		if err != nil {
+			log.Fatal("[TESTER][CONFIG] ", err)
+		}
+		if scn.NumUes() > len(subscribers) {
+			log.Fatal("[TESTER][CONFIG] ", scn.NumUes(), " UEs in scenario, but only ", len(subscribers), " subscribers are defined in ", cfg.Subscribers)
+		}
+	}
+
+	gnbWg := sync.WaitGroup{}
+	gnbs := tools.CreateGnbs(scn.GNodeBs, cfg, &gnbWg)
+
+	// Wait for gNB to be connected before registering UEs
+	// TODO: We should wait for NGSetupResponse instead
+	time.Sleep(1 * time.Second)
+
+	ueWg := sync.WaitGroup{}
+	ueId := 0
+	for _, group := range scn.Groups {
+		log.Info("[TESTER][SCENARIO] Starting group ", group.Name, " with ", group.Count, " UEs")
+		for i := 0; i < group.Count; i++ {
+			ueId++
+			ueCfg := tools.UeConfig(ueId, cfg, subscribers)
+			gnbIndex := ueId % len(gnbs)
+			if group.GNodeB != nil {
+				gnbIndex = *group.GNodeB
+			}
+			start := group.Start + time.Duration(i)*group.Interval
+
+			ueWg.Add(1)
+			go runScenarioUe(ueId, ueCfg, group.Steps, start, gnbs, gnbIndex, &ueWg)
+		}
+	}
+
+	ueWg.Wait()
+	log.Info("[TESTER][SCENARIO] Scenario ", scenarioPath, " is over")
+	tools.Shutdown(nil, gnbs)
+}
+
+func runScenarioUe(ueId int, ueCfg config.Config, steps []script.Step, start time.Duration, gnbs []*gnbCxt.GNBContext, gnbIndex int, wg *sync.WaitGroup) {
+	time.Sleep(start)
+
+	ue := newScenarioUe(ueId, ueCfg, gnbs[gnbIndex], wg)
+
+	for i, step := range steps {
+		log.Debug("[TESTER][SCENARIO][UE ", ueId, "] Step ", i, ": ", step.Action)
+		switch step.Action {
+		case script.ActionRegister:
+			ue.send(procedures.UeTesterMessage{Type: procedures.Registration})
+		case script.ActionDeregister:
+			ue.send(procedures.UeTesterMessage{Type: procedures.Deregistration})
+		case script.ActionPduSession:
+			ue.send(procedures.UeTesterMessage{Type: procedures.NewPDUSession})
+		case script.ActionRelease:
+			ue.send(procedures.UeTesterMessage{Type: procedures.DestroyPDUSession, Param: step.Id})
+		case script.ActionHandover:
+			target := (gnbIndex + 1) % len(gnbs)
+			if step.GNodeB != nil {
+				target = *step.GNodeB
+			}
+			ue.send(procedures.UeTesterMessage{Type: procedures.Handover, GnbChan: gnbs[target].GetInboundChannel()})
+			gnbIndex = target
+		case script.ActionIdle:
+			ue.send(procedures.UeTesterMessage{Type: procedures.ConnectionRelease})
+		case script.ActionServiceRequest:
+			ue.send(procedures.UeTesterMessage{Type: procedures.ServiceRequest})
+		case script.ActionThink:
+			time.Sleep(step.ThinkTime())
+		case script.ActionWaitForState:
+			wanted, _ := script.StateFromName(step.State)
+			if !ue.waitFor(wanted, step.Timeout) {
+				log.Error("[TESTER][SCENARIO][UE ", ueId, "] Timeout after ", step.Timeout, " while waiting for state ", step.State, ", stopping UE")
+				ue.send(procedures.UeTesterMessage{Type: procedures.Terminate})
+				return
+			}
+		}
+		if ue.isTerminated() {
+			log.Error("[TESTER][SCENARIO][UE ", ueId, "] UE stopped at step ", i, ": ", step.Action)
+			return
+		}
+	}
+
+	ue.send(procedures.UeTesterMessage{Type: procedures.Terminate})
+}
@@ -0,0 +1,195 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package templates
+
+import (
+	"my5G-RANTester/config"
+	"my5G-RANTester/internal/common/tools"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/work_load_model"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const profileTick = 100 * time.Millisecond
+const profileStatusInterval = 10 * time.Second
+
+// TestWithLoadProfile attaches and detaches UEs following the phases of a load profile, see work_load_model.Profile
+func TestWithLoadProfile(profilePath string) {
+	profile, err := work_load_model.LoadProfile(profilePath)
+	if err != nil {
+		log.Fatal("[TESTER][PROFILE] ", err)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Fatal("[TESTER][CONFIG] Unable to read configuration")
+	}
+
+	var subscribers []config.Ue
+	if cfg.Subscribers != "" {
+		subscribers, err = config.LoadSubscribers(cfg.Subscribers, cfg.Ue)
+		if err != nil {
+			log.Fatal("[TESTER][CONFIG] ", err)
+		}
+		if profile.MaxUes() > len(subscribers) {
+			log.Fatal("[TESTER][CONFIG] Up to ", profile.MaxUes(), " UEs are attached during the load profile, but only ", len(subscribers), " subscribers are defined in ", cfg.Subscribers)
+		}
+	}
+
+	gnbWg := sync.WaitGroup{}
+	gnbs := tools.CreateGnbs(profile.GNodeBs, cfg, &gnbWg)
+
+	// Wait for gNB to be connected before registering UEs
+	// TODO: We should wait for NGSetupResponse instead
+	time.Sleep(1 * time.Second)
+
+	ueWg := sync.WaitGroup{}
+	runner := &profileRunner{cfg: cfg, subscribers: subscribers, gnbs: gnbs, pduSessions: profile.PduSessions, wg: &ueWg}
+
+	ticker := time.NewTicker(profileTick)
+	defer ticker.Stop()
+	lastStatus := time.Now()
+
+phases:
+	for _, phase := range profile.Phases {
+		log.Info("[TESTER][PROFILE] Starting phase ", phase.Name, " for ", phase.Duration)
+		from := runner.numUes()
+		start := time.Now()
+		lastTick := start
+		credit := 0.0
+		for {
+			now := time.Now()
+			elapsed := now.Sub(start)
+			if phase.Target != nil {
+				runner.scaleTo(phase.Level(from, elapsed))
+			} else {
+				// registrations of the last tick, the remainder is kept for the next ticks
+				tickEnd := now
+				if end := start.Add(phase.Duration); tickEnd.After(end) {
+					tickEnd = end
+				}
+				credit += phase.Rate * tickEnd.Sub(lastTick).Seconds()
+				for ; credit >= 1; credit-- {
+					runner.startUe()
+				}
+			}
+			lastTick = now
+
+			if now.Sub(lastStatus) >= profileStatusInterval {
+				runner.logStatus(phase.Name)
+				lastStatus = now
+			}
+			if elapsed >= phase.Duration {
+				break
+			}
+
+			select {
+			case <-ticker.C:
+			case <-lifecycle.Context().Done():
+				log.Warn("[TESTER][PROFILE] Interrupted during phase ", phase.Name)
+				break phases
+			}
+		}
+		runner.logStatus(phase.Name)
+	}
+
+	log.Info("[TESTER][PROFILE] Load profile is over, stopping the ", runner.numUes(), " remaining UEs")
+	tools.Shutdown(&ueWg, gnbs)
+}
+
+// profileRunner starts and stops UEs, UEs are stopped in the order they were started.
+type profileRunner struct {
+	cfg         config.Config
+	subscribers []config.Ue
+	gnbs        []*gnbCxt.GNBContext
+	pduSessions int
+	wg          *sync.WaitGroup
+
+	mu      sync.Mutex
+	active  []*scenarioUe
+	freeIds []int // ids of the stopped UEs, reused before new ids
+	nextId  int
+}
+
+func (runner *profileRunner) numUes() int {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	return len(runner.active)
+}
+
+func (runner *profileRunner) scaleTo(target int) {
+	for numUes := runner.numUes(); numUes < target; numUes++ {
+		runner.startUe()
+	}
+	for numUes := runner.numUes(); numUes > target; numUes-- {
+		runner.stopUe()
+	}
+}
+
+func (runner *profileRunner) startUe() {
+	runner.mu.Lock()
+	var ueId int
+	if len(runner.freeIds) > 0 {
+		ueId = runner.freeIds[len(runner.freeIds)-1]
+		runner.freeIds = runner.freeIds[:len(runner.freeIds)-1]
+	} else {
+		runner.nextId++
+		ueId = runner.nextId
+	}
+	runner.wg.Add(1)
+	ue := newScenarioUe(ueId, tools.UeConfig(ueId, runner.cfg, runner.subscribers), runner.gnbs[ueId%len(runner.gnbs)], runner.wg)
+	runner.active = append(runner.active, ue)
+	runner.mu.Unlock()
+
+	go func() {
+		ue.send(procedures.UeTesterMessage{Type: procedures.Registration})
+		if runner.pduSessions > 0 && ue.waitFor(ueCtx.MM5G_REGISTERED, 10*time.Second) {
+			for i := 0; i < runner.pduSessions; i++ {
+				ue.send(procedures.UeTesterMessage{Type: procedures.NewPDUSession})
+			}
+		}
+
+		<-ue.done
+		runner.mu.Lock()
+		defer runner.mu.Unlock()
+		// the UE may have stopped on its own
+		for i, active := range runner.active {
+			if active == ue {
+				runner.active = append(runner.active[:i], runner.active[i+1:]...)
+				break
+			}
+		}
+		runner.freeIds = append(runner.freeIds, ueId)
+	}()
+}
+
+func (runner *profileRunner) stopUe() {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if len(runner.active) == 0 {
+		return
+	}
+	ue := runner.active[0]
+	runner.active = runner.active[1:]
+	go ue.send(procedures.UeTesterMessage{Type: procedures.Terminate})
+}
+
+func (runner *profileRunner) logStatus(phase string) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	registered := 0
+	for _, ue := range runner.active {
+		if ue.getState() == ueCtx.MM5G_REGISTERED {
+			registered++
+		}
+	}
+	log.Info("[TESTER][PROFILE] Phase ", phase, ": ", len(runner.active), " UEs attached, ", registered, " registered")
+}
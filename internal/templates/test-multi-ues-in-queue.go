@@ -6,38 +6,73 @@ package templates
 
 import (
 	"my5G-RANTester/config"
+	"my5G-RANTester/internal/api"
 	"my5G-RANTester/internal/common/tools"
 	"my5G-RANTester/internal/control_test_engine/procedures"
-	"os"
-	"os/signal"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/work_load_model"
 	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func TestMultiUesInQueue(numUes int, tunnelEnabled bool, dedicatedGnb bool, loop bool, timeBetweenRegistration int, timeBeforeDeregistration int, timeBeforeHandover int, numPduSessions int) {
+func TestMultiUesInQueue(numUes int, tunnelEnabled bool, dedicatedGnb bool, loop bool, timeBetweenRegistration int, timeBeforeDeregistration int, timeBeforeHandover int, numPduSessions int, controlAddr string, arrivalModel string, seed int64) {
 	if tunnelEnabled && !dedicatedGnb {
 		log.Fatal("You cannot use the --tunnel option, without using the --dedicatedGnb option")
 	}
 	if tunnelEnabled && timeBetweenRegistration < 500 {
 		log.Fatal("When using the --tunnel option, --timeBetweenRegistration must be equal to at least 500 ms, or else gtp5g kernel module may crash if you create tunnels too rapidly.")
 	}
+	if tunnelEnabled && arrivalModel != work_load_model.Fixed {
+		log.Fatal("When using the --tunnel option, only the fixed --arrival-model can be used, or else gtp5g kernel module may crash if you create tunnels too rapidly.")
+	}
 
 	if numPduSessions > 16 {
 		log.Fatal("You can't have more than 16 PDU Sessions per UE as per spec.")
 	}
 
-	wg := sync.WaitGroup{}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	interArrival, err := work_load_model.NewModel(arrivalModel, time.Duration(timeBetweenRegistration)*time.Millisecond, seed)
+	if err != nil {
+		log.Fatal("[TESTER] ", err)
+	}
+	holdTime, err := work_load_model.NewModel(arrivalModel, time.Duration(timeBeforeDeregistration)*time.Millisecond, seed+1)
+	if err != nil {
+		log.Fatal("[TESTER] ", err)
+	}
+	if arrivalModel != work_load_model.Fixed {
+		log.Info("[TESTER] Using the ", arrivalModel, " arrival model with seed ", seed)
+	}
+
+	gnbWg := sync.WaitGroup{}
+	ueWg := sync.WaitGroup{}
 
 	cfg, err := config.GetConfig()
 	if err != nil {
 		log.Fatal("[TESTER][CONFIG] Unable to read configuration")
 	}
 
+	var subscribers []config.Ue
+	if cfg.Subscribers != "" {
+		subscribers, err = config.LoadSubscribers(cfg.Subscribers, cfg.Ue)
+		if err != nil {
+			log.Fatal("[TESTER][CONFIG] ", err)
+		}
+		if numUes > len(subscribers) {
+			log.Fatal("[TESTER][CONFIG] ", numUes, " UEs requested, but only ", len(subscribers), " subscribers are defined in ", cfg.Subscribers)
+		}
+		log.Info("[TESTER][CONFIG] Using ", len(subscribers), " subscribers from ", cfg.Subscribers)
+	}
+
 	var numGnb int
 	if dedicatedGnb {
 		numGnb = numUes
+	} else if len(cfg.GNodeBs) > 0 {
+		// UEs are spread over every gNodeB of the topology
+		numGnb = len(cfg.GNodeBs)
 	} else {
 		numGnb = 1
 	}
@@ -45,7 +80,7 @@ func TestMultiUesInQueue(numUes int, tunnelEnabled bool, dedicatedGnb bool, loop
 		log.Warn("[TESTER] We are increasing the number of gNodeB to two for handover test cases. Make you sure you fill the requirements for having two gNodeBs.")
 		numGnb++
 	}
-	gnbs := tools.CreateGnbs(numGnb, cfg, &wg)
+	gnbs := tools.CreateGnbs(numGnb, cfg, &gnbWg)
 
 	// Wait for gNB to be connected before registering UEs
 	// TODO: We should wait for NGSetupResponse instead
@@ -55,15 +90,22 @@ func TestMultiUesInQueue(numUes int, tunnelEnabled bool, dedicatedGnb bool, loop
 
 	scenarioChans := make([]chan procedures.UeTesterMessage, numUes+1)
 
-	sigStop := make(chan os.Signal, 1)
-	signal.Notify(sigStop, os.Interrupt)
-
 	ueSimCfg := tools.UESimulationConfig{
 		Gnbs:                     gnbs,
 		Cfg:                      cfg,
 		TimeBeforeDeregistration: timeBeforeDeregistration,
 		TimeBeforeHandover:       timeBeforeHandover,
 		NumPduSessions:           numPduSessions,
+		Subscribers:              subscribers,
+	}
+
+	var controlApi *api.Server
+	if controlAddr != "" {
+		controlApi = api.NewServer(gnbs, numUes)
+		if err := controlApi.Start(controlAddr); err != nil {
+			log.Fatal("[TESTER][API] ", err)
+		}
+		ueSimCfg.OnStateChange = controlApi.UpdateUe
 	}
 
 	stopSignal := true
@@ -75,20 +117,32 @@ func TestMultiUesInQueue(numUes int, tunnelEnabled bool, dedicatedGnb bool, loop
 			// kill it, before creating a new coroutine with same UE
 			// Use case: Registration of N UEs in loop, when loop = true
 			if scenarioChans[ueSimCfg.UeId] != nil {
+				if controlApi != nil {
+					controlApi.RemoveUe(ueSimCfg.UeId)
+				}
 				scenarioChans[ueSimCfg.UeId] <- procedures.UeTesterMessage{Type: procedures.Kill}
 				close(scenarioChans[ueSimCfg.UeId])
 				scenarioChans[ueSimCfg.UeId] = nil
 			}
 			scenarioChans[ueSimCfg.UeId] = make(chan procedures.UeTesterMessage)
 			ueSimCfg.ScenarioChan = scenarioChans[ueSimCfg.UeId]
+			if controlApi != nil {
+				msin := tools.UeConfig(ueSimCfg.UeId, cfg, subscribers).Ue.Msin
+				controlApi.AddUe(ueSimCfg.UeId, msin, ueSimCfg.UeId%len(gnbs), ueSimCfg.ScenarioChan)
+			}
 
-			tools.SimulateSingleUE(ueSimCfg, &wg)
+			if timeBeforeDeregistration != 0 {
+				// at least 1 ms, as 0 disables the deregistration
+				ueSimCfg.TimeBeforeDeregistration = max(int(holdTime.Next().Milliseconds()), 1)
+			}
+
+			tools.SimulateSingleUE(ueSimCfg, &ueWg)
 
-			// Before creating a new UE, we wait for timeBetweenRegistration ms
-			time.Sleep(time.Duration(timeBetweenRegistration) * time.Millisecond)
+			// Before creating a new UE, we wait for timeBetweenRegistration ms, or a time sampled from the arrival model
+			time.Sleep(interArrival.Next())
 
 			select {
-			case <-sigStop:
+			case <-lifecycle.Context().Done():
 				stopSignal = false
 			default:
 			}
@@ -101,13 +155,7 @@ func TestMultiUesInQueue(numUes int, tunnelEnabled bool, dedicatedGnb bool, loop
 	}
 
 	if stopSignal {
-		<-sigStop
+		<-lifecycle.Context().Done()
 	}
-	for _, scenarioChan := range scenarioChans {
-		if scenarioChan != nil {
-			scenarioChan <- procedures.UeTesterMessage{Type: procedures.Terminate}
-		}
-	}
-
-	time.Sleep(time.Second*2)
+	tools.Shutdown(&ueWg, gnbs)
 }
@@ -0,0 +1,156 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package templates
+
+import (
+	"fmt"
+	"my5G-RANTester/config"
+	"my5G-RANTester/internal/common/tools"
+	gnbCxt "my5G-RANTester/internal/control_test_engine/gnb/context"
+	"my5G-RANTester/internal/control_test_engine/procedures"
+	ueCtx "my5G-RANTester/internal/control_test_engine/ue/context"
+	"my5G-RANTester/internal/lifecycle"
+	"my5G-RANTester/internal/report"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const rateTick = 10 * time.Millisecond
+
+// TestRegistrationRate starts rate full UE registrations per second during duration seconds over numGnbs gNodeBs,
+// each followed by pduSessions PDU Session establishments. A registration succeeds once the UE is registered, and
+// its PDU Sessions are active, before timeout. The achieved rate, success ratio and latency are measured per second,
+// and the AMF is reported as saturated from the first second whose success ratio is below minSuccessRatio, or whose
+// p95 latency is above maxLatency (unless 0).
+func TestRegistrationRate(rate int, duration int, numGnbs int, pduSessions int, timeout time.Duration, minSuccessRatio float64, maxLatency time.Duration) report.RateTest {
+	runner := newRateRunner(rate*duration, numGnbs)
+	meter, _ := runner.run(rate, duration, pduSessions, timeout)
+	tools.Shutdown(nil, runner.gnbs)
+	result := meter.Result(minSuccessRatio, maxLatency)
+	report.SetRateTest(result)
+	return result
+}
+
+// rateRunner registers UEs at a given rate over a fixed set of gNodeBs, every UE registers once per run.
+type rateRunner struct {
+	cfg         config.Config
+	subscribers []config.Ue
+	gnbs        []*gnbCxt.GNBContext
+	lastUeId    int
+	poolSize    int // number of subscribers the UEs of the runs are spread over
+}
+
+// newRateRunner starts the gNodeBs for runs of up to numUes registrations.
+func newRateRunner(numUes int, numGnbs int) *rateRunner {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Fatal("[TESTER][CONFIG] Unable to read configuration")
+	}
+
+	var subscribers []config.Ue
+	if cfg.Subscribers != "" {
+		subscribers, err = config.LoadSubscribers(cfg.Subscribers, cfg.Ue)
+		if err != nil {
+			log.Fatal("[TESTER][CONFIG] ", err)
+		}
+		if numUes > len(subscribers) {
+			log.Fatal("[TESTER][CONFIG] Up to ", numUes, " UEs are registered during the test, but only ", len(subscribers), " subscribers are defined in ", cfg.Subscribers)
+		}
+	}
+
+	gnbWg := sync.WaitGroup{}
+	gnbs := tools.CreateGnbs(numGnbs, cfg, &gnbWg)
+
+	// Wait for gNB to be connected before registering UEs
+	// TODO: We should wait for NGSetupResponse instead
+	time.Sleep(1 * time.Second)
+
+	poolSize := numUes
+	if len(subscribers) > 0 {
+		poolSize = len(subscribers)
+	}
+	return &rateRunner{cfg: cfg, subscribers: subscribers, gnbs: gnbs, poolSize: poolSize}
+}
+
+// run registers rate new UEs per second during duration seconds, and stops them once every registration is over.
+// It returns false if the test was interrupted.
+func (runner *rateRunner) run(rate int, duration int, pduSessions int, timeout time.Duration) (*report.RateMeter, bool) {
+	numUes := rate * duration
+	ueWg := sync.WaitGroup{}
+	attemptWg := sync.WaitGroup{}
+	var ues []*scenarioUe
+	meter := report.NewRateMeter(rate)
+	register := func(ueId int) {
+		ueWg.Add(1)
+		// the UEs of the previous runs are deregistered, so that their subscribers can be reused
+		subscriberId := (ueId-1)%runner.poolSize + 1
+		ue := newScenarioUe(ueId, tools.UeConfig(subscriberId, runner.cfg, runner.subscribers), runner.gnbs[ueId%len(runner.gnbs)], &ueWg)
+		ues = append(ues, ue)
+
+		attemptWg.Add(1)
+		go func() {
+			defer attemptWg.Done()
+			start := time.Now()
+			deadline := start.Add(timeout)
+			ue.send(procedures.UeTesterMessage{Type: procedures.Registration})
+			success := ue.waitFor(ueCtx.MM5G_REGISTERED, timeout)
+			for i := 1; success && i <= pduSessions; i++ {
+				success = ue.send(procedures.UeTesterMessage{Type: procedures.NewPDUSession}) &&
+					ue.waitForPduSession(uint8(i), ueCtx.SM5G_PDU_SESSION_ACTIVE, time.Until(deadline))
+			}
+			meter.Record(start, time.Now(), success)
+		}()
+	}
+
+	ticker := time.NewTicker(rateTick)
+	defer ticker.Stop()
+	start := time.Now()
+	lastTick := start
+	credit := 0.0
+	registered := 0
+	logged := 0
+	completed := true
+registrations:
+	for registered < numUes {
+		select {
+		case now := <-ticker.C:
+			// registrations of the last tick, the remainder is kept for the next ticks
+			credit += float64(rate) * now.Sub(lastTick).Seconds()
+			lastTick = now
+			for ; credit >= 1 && registered < numUes; credit-- {
+				registered++
+				runner.lastUeId++
+				register(runner.lastUeId)
+			}
+			// seconds are logged once their registrations had time to complete
+			for ; logged < duration && now.Sub(start) >= time.Duration(logged+1)*time.Second+timeout; logged++ {
+				logRateSecond(meter.Second(logged), rate)
+			}
+		case <-lifecycle.Context().Done():
+			log.Warn("[TESTER][RATE] Interrupted after ", registered, " registrations")
+			completed = false
+			break registrations
+		}
+	}
+
+	attemptWg.Wait()
+	for ; logged < duration; logged++ {
+		logRateSecond(meter.Second(logged), rate)
+	}
+
+	log.Info("[TESTER][RATE] Stopping the ", len(ues), " UEs")
+	for _, ue := range ues {
+		go ue.send(procedures.UeTesterMessage{Type: procedures.Terminate})
+	}
+	ueWg.Wait()
+	return meter, completed
+}
+
+func logRateSecond(second report.RateSecond, rate int) {
+	log.Info(fmt.Sprintf("[TESTER][RATE] Second %d: %d/%d registrations started, %d succeeded (ratio %.2f), %d completed during the second, latency (ms) avg %.1f, p95 %.1f",
+		second.Second, second.Started, rate, second.Successes, second.SuccessRatio, second.Completed, second.AvgMs, second.P95Ms))
+}
@@ -1,38 +1,27 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
 package work_load_model
 
-/*
-#cgo CFLAGS: -I /usr/local/include
-#cgo LDFLAGS: -L /usr/local/lib -lgsl -lgslcblas -lm
-#include<gsl/gsl_rng.h>
-#include<gsl/gsl_randist.h>
+import "math/rand"
 
-unsigned int randomNumberFromGaussian(double mu, long seed){
-	const gsl_rng_type* T;
-    gsl_rng* r;
-    unsigned int dist;
-
-	gsl_rng_env_setup();
-	T = gsl_rng_default;
-	r = gsl_rng_alloc(T);
-
-    gsl_rng_set(r,seed);
-    dist = gsl_ran_gaussian (r, mu);
-
-	gsl_rng_free (r);
-
-	return dist;
-}
-*/
-import "C"
-
-// calculate some random numbers from the Gaussian distribution
-func gaussianlDistribution(sigma float64, length int, const_seed int) (distGaussian []uint) {
+// calculate some random numbers from the Gaussian distribution, truncated at 0
+func GaussianDistribution(mean float64, sigma float64, length int, const_seed int) (distGaussian []uint) {
+	rng := rand.New(rand.NewSource(int64(const_seed)))
 	distGaussian = make([]uint, length)
 
-	for i := 1; i <= length; i++ {
-		seed := const_seed + i
-		aux := C.randomNumberFromGaussian(C.double(sigma), C.long(seed))
-		distGaussian[i-1] = uint(aux)
+	for i := range distGaussian {
+		distGaussian[i] = uint(gaussian(rng, mean, sigma))
 	}
 	return
 }
+
+// gaussian draws a number from the Gaussian distribution, negative numbers are replaced by 0
+func gaussian(rng *rand.Rand, mean float64, sigma float64) float64 {
+	value := rng.NormFloat64()*sigma + mean
+	if value < 0 {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,53 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package work_load_model
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Distributions of a Model.
+const (
+	Fixed       = "fixed"
+	Poisson     = "poisson"     // Poisson process, ie: exponential times between events
+	Exponential = "exponential" // same as Poisson
+	Gaussian    = "gaussian"    // standard deviation is a quarter of the mean
+)
+
+// Model samples durations, eg: the time between two UE registrations, or how long a UE stays registered.
+// A Model is not safe for concurrent use.
+type Model struct {
+	distribution string
+	mean         time.Duration
+	rng          *rand.Rand
+}
+
+// NewModel returns a Model of the given distribution and mean, samples only depend on the seed.
+func NewModel(distribution string, mean time.Duration, seed int64) (*Model, error) {
+	switch distribution {
+	case Fixed, Poisson, Exponential, Gaussian:
+	default:
+		return nil, fmt.Errorf("unknown arrival model %q, expected %s, %s, %s or %s", distribution, Fixed, Poisson, Exponential, Gaussian)
+	}
+	if mean < 0 {
+		return nil, fmt.Errorf("mean of the %s arrival model must be positive", distribution)
+	}
+	return &Model{distribution: distribution, mean: mean, rng: rand.New(rand.NewSource(seed))}, nil
+}
+
+// Next samples the next duration.
+func (model *Model) Next() time.Duration {
+	mean := float64(model.mean)
+	switch model.distribution {
+	case Poisson, Exponential:
+		return time.Duration(exponential(model.rng, mean))
+	case Gaussian:
+		return time.Duration(gaussian(model.rng, mean, mean/4))
+	default:
+		return model.mean
+	}
+}
@@ -0,0 +1,45 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package work_load_model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func average(samples []uint) float64 {
+	sum := 0.0
+	for _, sample := range samples {
+		sum += float64(sample)
+	}
+	return sum / float64(len(samples))
+}
+
+func TestDistributions(t *testing.T) {
+	assert.Equal(t, PoissonDistribution(5, 100, 42), PoissonDistribution(5, 100, 42))
+	assert.NotEqual(t, PoissonDistribution(5, 100, 42), PoissonDistribution(5, 100, 43))
+
+	assert.InDelta(t, 5, average(PoissonDistribution(5, 10000, 1)), 0.2)
+	assert.InDelta(t, 200, average(PoissonDistribution(200, 10000, 1)), 1)
+	assert.InDelta(t, 1000, average(ExponentialDistribution(1000, 10000, 1)), 40)
+	assert.InDelta(t, 1000, average(GaussianDistribution(1000, 100, 10000, 1)), 5)
+}
+
+func TestModel(t *testing.T) {
+	_, err := NewModel("bursty", time.Second, 1)
+	assert.Error(t, err)
+
+	fixed, err := NewModel(Fixed, time.Second, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, fixed.Next())
+
+	first, _ := NewModel(Poisson, time.Second, 7)
+	second, _ := NewModel(Poisson, time.Second, 7)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first.Next(), second.Next())
+	}
+}
@@ -1,38 +1,60 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
 package work_load_model
 
-/*
-#cgo CFLAGS: -I /usr/local/include
-#cgo LDFLAGS: -L /usr/local/lib -lgsl -lgslcblas -lm
-#include<gsl/gsl_rng.h>
-#include<gsl/gsl_randist.h>
-
-unsigned int randomNumberFromPoisson( double mu, long seed) {
-    const gsl_rng_type* T;
-    gsl_rng* r;
-    unsigned int dist;
-
-	gsl_rng_env_setup();
-	T = gsl_rng_default;
-	r = gsl_rng_alloc(T);
-
-    gsl_rng_set(r,seed);
-    dist = gsl_ran_poisson (r, mu);
-
-	gsl_rng_free (r);
-
-	return dist;
-}
-*/
-import "C"
+import (
+	"math"
+	"math/rand"
+)
 
 // calculate some random numbers from the Poisson distribution
 func PoissonDistribution(mean float64, length int, const_seed int) (distPoisson []uint) {
+	rng := rand.New(rand.NewSource(int64(const_seed)))
 	distPoisson = make([]uint, length)
 
-	for i := 1; i <= length; i++ {
-		seed := const_seed + i
-		aux := C.randomNumberFromPoisson(C.double(mean), C.long(seed))
-		distPoisson[i-1] = uint(aux)
+	for i := range distPoisson {
+		distPoisson[i] = poisson(rng, mean)
 	}
 	return
 }
+
+func poisson(rng *rand.Rand, mean float64) uint {
+	if mean <= 0 {
+		return 0
+	}
+	if mean < 30 {
+		// Knuth: count the uniform numbers whose product stays above e^-mean
+		limit := math.Exp(-mean)
+		k := uint(0)
+		for p := rng.Float64(); p > limit; p *= rng.Float64() {
+			k++
+		}
+		return k
+	}
+
+	// Transformed rejection with squeeze (PTRS), W. Hörmann, 1993
+	slam := math.Sqrt(mean)
+	loglam := math.Log(mean)
+	b := 0.931 + 2.53*slam
+	a := -0.059 + 0.02483*b
+	invalpha := 1.1239 + 1.1328/(b-3.4)
+	vr := 0.9277 - 3.6224/(b-2)
+	for {
+		u := rng.Float64() - 0.5
+		v := rng.Float64()
+		us := 0.5 - math.Abs(u)
+		k := math.Floor((2*a/us+b)*u + mean + 0.43)
+		if us >= 0.07 && v <= vr {
+			return uint(k)
+		}
+		if k < 0 || (us < 0.013 && v > us) {
+			continue
+		}
+		lgamma, _ := math.Lgamma(k + 1)
+		if math.Log(v)+math.Log(invalpha)-math.Log(a/(us*us)+b) <= -mean+k*loglam-lgamma {
+			return uint(k)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package work_load_model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Shapes of a ramp between two numbers of attached UEs.
+const (
+	ShapeLinear      = "linear"
+	ShapeStep        = "step"        // the target is reached at the start of the phase
+	ShapeExponential = "exponential" // slow at the start of the phase, fast at the end
+)
+
+// Profile is a load profile made of successive phases, eg:
+//
+//	gnodebs: 2
+//	pdusessions: 1
+//	phases:
+//	  - name: ramp-up
+//	    target: 50000 # attached UEs at the end of the phase
+//	    duration: 10m
+//	  - name: plateau
+//	    target: 50000
+//	    duration: 30m
+//	  - name: burst
+//	    rate: 200 # registrations/s, on top of the attached UEs
+//	    duration: 10s
+//	  - name: drain
+//	    target: 0
+//	    duration: 5m
+type Profile struct {
+	GNodeBs     int     `yaml:"gnodebs"`     // number of gNodeBs, defaults to 1
+	PduSessions int     `yaml:"pdusessions"` // PDU Sessions of each UE once registered
+	Phases      []Phase `yaml:"phases"`
+}
+
+// Phase either ramps the number of attached UEs to Target, or registers Rate new UEs per second.
+type Phase struct {
+	Name     string        `yaml:"name"`
+	Duration time.Duration `yaml:"duration"`
+	Target   *int          `yaml:"target"`
+	Shape    string        `yaml:"shape"` // linear by default
+	Rate     float64       `yaml:"rate"`
+}
+
+// LoadProfile reads and validates a load profile file.
+func LoadProfile(path string) (*Profile, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read load profile %s: %w", path, err)
+	}
+
+	profile := &Profile{}
+	if err := yaml.UnmarshalStrict(file, profile); err != nil {
+		return nil, fmt.Errorf("could not parse load profile %s: %w", path, err)
+	}
+
+	if err := profile.validate(); err != nil {
+		return nil, fmt.Errorf("invalid load profile %s:\n%w", path, err)
+	}
+
+	return profile, nil
+}
+
+func (profile *Profile) validate() error {
+	var errs []error
+
+	if profile.GNodeBs == 0 {
+		profile.GNodeBs = 1
+	}
+	if profile.GNodeBs < 0 {
+		errs = append(errs, fmt.Errorf("gnodebs: %d must be positive", profile.GNodeBs))
+	}
+	if profile.PduSessions < 0 || profile.PduSessions > 16 {
+		errs = append(errs, fmt.Errorf("pdusessions: %d must lie between 0 and 16", profile.PduSessions))
+	}
+	if len(profile.Phases) == 0 {
+		errs = append(errs, errors.New("phases: at least one phase is required"))
+	}
+
+	for i := range profile.Phases {
+		phase := &profile.Phases[i]
+		prefix := fmt.Sprintf("phases[%d]", i)
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("phase %d", i)
+		}
+		if phase.Duration < 0 {
+			errs = append(errs, fmt.Errorf("%s.duration: %s must be positive", prefix, phase.Duration))
+		}
+		switch {
+		case phase.Target != nil && phase.Rate != 0:
+			errs = append(errs, fmt.Errorf("%s: either target or rate must be given, not both", prefix))
+		case phase.Target != nil:
+			if *phase.Target < 0 {
+				errs = append(errs, fmt.Errorf("%s.target: %d must be positive", prefix, *phase.Target))
+			}
+			if phase.Shape == "" {
+				phase.Shape = ShapeLinear
+			}
+			if phase.Shape != ShapeLinear && phase.Shape != ShapeStep && phase.Shape != ShapeExponential {
+				errs = append(errs, fmt.Errorf("%s.shape: unknown shape %q, expected %s, %s or %s", prefix, phase.Shape, ShapeLinear, ShapeStep, ShapeExponential))
+			}
+		case phase.Rate > 0:
+			if phase.Duration == 0 {
+				errs = append(errs, fmt.Errorf("%s.duration: a duration is required with a rate", prefix))
+			}
+			if phase.Shape != "" {
+				errs = append(errs, fmt.Errorf("%s.shape: a shape can only be given with a target", prefix))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: a target or a positive rate is required", prefix))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MaxUes returns the maximum number of UEs attached at the same time during the profile.
+func (profile *Profile) MaxUes() int {
+	level, max := 0, 0
+	for _, phase := range profile.Phases {
+		if phase.Target != nil {
+			level = *phase.Target
+		} else {
+			level += int(math.Ceil(phase.Rate * phase.Duration.Seconds()))
+		}
+		if level > max {
+			max = level
+		}
+	}
+	return max
+}
+
+// Level returns the number of attached UEs expected after elapsed time in a target phase, starting from the from attached UEs.
+func (phase *Phase) Level(from int, elapsed time.Duration) int {
+	if phase.Target == nil {
+		return from
+	}
+	if elapsed >= phase.Duration || phase.Shape == ShapeStep {
+		return *phase.Target
+	}
+
+	progress := float64(elapsed) / float64(phase.Duration)
+	if phase.Shape == ShapeExponential {
+		progress = (math.Pow(2, 10*progress) - 1) / 1023
+	}
+	return from + int(math.Round(float64(*phase.Target-from)*progress))
+}
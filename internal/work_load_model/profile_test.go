@@ -0,0 +1,52 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package work_load_model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSampleProfile(t *testing.T) {
+	profile, err := LoadProfile("../../config/load-profile.yml")
+	assert.NoError(t, err)
+	assert.Len(t, profile.Phases, 4)
+	assert.Equal(t, 1200, profile.MaxUes())
+
+	rampUp := profile.Phases[0]
+	assert.Equal(t, 0, rampUp.Level(0, 0))
+	assert.Equal(t, 500, rampUp.Level(0, 30*time.Second))
+	assert.Equal(t, 1000, rampUp.Level(0, time.Hour))
+
+	drain := profile.Phases[3]
+	assert.Equal(t, 1200, drain.Level(1200, 0))
+	assert.Equal(t, 600, drain.Level(1200, time.Minute))
+}
+
+func TestPhaseShapes(t *testing.T) {
+	target := 100
+	step := Phase{Target: &target, Shape: ShapeStep, Duration: time.Minute}
+	assert.Equal(t, 100, step.Level(0, 0))
+
+	exponential := Phase{Target: &target, Shape: ShapeExponential, Duration: time.Minute}
+	assert.Less(t, exponential.Level(0, 30*time.Second), 10)
+	assert.Equal(t, 100, exponential.Level(0, time.Minute))
+}
+
+func TestLoadInvalidProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.yml")
+	err := os.WriteFile(path, []byte("phases:\n  - target: 10\n    rate: 5\n  - rate: 5\n  - target: 5\n    shape: square\n"), 0o600)
+	assert.NoError(t, err)
+
+	_, err = LoadProfile(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "phases[0]: either target or rate must be given, not both")
+	assert.Contains(t, err.Error(), "phases[1].duration: a duration is required with a rate")
+	assert.Contains(t, err.Error(), `phases[2].shape: unknown shape "square"`)
+}
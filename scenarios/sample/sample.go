@@ -6,6 +6,10 @@ package main
 
 import "fmt"
 
+// 5GMM states, see waitForState
+const MM5G_DEREGISTERED = 1
+const MM5G_REGISTERED = 3
+
 //export attach
 func attach(uint32)
 //export detach
@@ -16,30 +20,48 @@ func pduSessionRequest(uint32, uint32)
 func pduSessionRelease(uint32, uint32)
 //export think
 func think(uint32)
+//export waitForState
+func waitForState(ueId uint32, state uint32, timeoutMs uint32) uint32
+//export waitForPduSession
+func waitForPduSession(ueId uint32, pduSessionId uint32, timeoutMs uint32) uint32
+//export getPduSessionIp
+func getPduSessionIp(ueId uint32, pduSessionId uint32, buf *byte, bufLen uint32) uint32
 
 //export ueHandler
 func ueHandler(ueId uint32)  {
-	fmt.Println("Hi, I'm an UE that wants to attach!")
+	fmt.Println("UE", ueId, ": Hi, I'm an UE that wants to attach!")
 	attach(ueId)
 
-	think(5000)
+	if waitForState(ueId, MM5G_REGISTERED, 5000) == 0 {
+		fmt.Println("UE", ueId, ": I could not register within 5s :(")
+		return
+	}
 
-	fmt.Println("Hi, I'm an UE that wants to have 16 PDU Sessions!")
+	fmt.Println("UE", ueId, ": Hi, I'm an UE that wants to have a PDU Session!")
 	for pduSessionId:=uint32(1); pduSessionId<2; pduSessionId++ {
-		fmt.Println("Hi, I'm an UE that wants to request PDU Session id: ", pduSessionId)
+		fmt.Println("UE", ueId, ": Hi, I'm an UE that wants to request PDU Session id: ", pduSessionId)
 		pduSessionRequest(ueId, pduSessionId)
+		if waitForPduSession(ueId, pduSessionId, 5000) == 0 {
+			fmt.Println("UE", ueId, ": PDU Session", pduSessionId, "was not established within 5s :(")
+			continue
+		}
+
+		buf := make([]byte, 64)
+		n := getPduSessionIp(ueId, pduSessionId, &buf[0], uint32(len(buf)))
+		fmt.Println("UE", ueId, ": PDU Session", pduSessionId, "has IP", string(buf[:n]))
 	}
 
 	think(5000)
 
-	fmt.Println("Hi, I'm an UE that wants to release 16 PDU Sessions!")
+	fmt.Println("UE", ueId, ": Hi, I'm an UE that wants to release its PDU Session!")
 	for pduSessionId:=uint32(1); pduSessionId<2; pduSessionId++ {
-		fmt.Println("Hi, I'm an UE that wants to release PDU Session id: ", pduSessionId)
+		fmt.Println("UE", ueId, ": Hi, I'm an UE that wants to release PDU Session id: ", pduSessionId)
 		pduSessionRelease(ueId, pduSessionId)
 	}
 
-	fmt.Println("Hi, I'm an UE that wants to detach!")
+	fmt.Println("UE", ueId, ": Hi, I'm an UE that wants to detach!")
 	detach(ueId)
+	waitForState(ueId, MM5G_DEREGISTERED, 5000)
 }
 
 
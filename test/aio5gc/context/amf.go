@@ -6,8 +6,11 @@ package context
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"my5G-RANTester/internal/common/auth"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/free5gc/openapi/models"
@@ -34,6 +37,13 @@ type AMFContext struct {
 	securityContext     []SecurityContext
 	idUeGenerator       int64
 	networkName         NetworkName
+	homeNetworkKeys     map[uint8]HomeNetworkKey
+}
+
+// HomeNetworkKey is a home network private key, used to de-conceal the SUCIs of its protection scheme.
+type HomeNetworkKey struct {
+	ProtectionScheme uint8
+	PrivateKey       []byte
 }
 
 type NetworkName struct {
@@ -55,6 +65,7 @@ func (c *AMFContext) NewAmfContext(amfName string, id string, supportedPlmnSnssa
 	c.ues = []*UEContext{}
 	c.securityContext = []SecurityContext{}
 	c.idUeGenerator = 0
+	c.homeNetworkKeys = make(map[uint8]HomeNetworkKey)
 	c.networkName = NetworkName{
 		Full:  "NtwFull",
 		Short: "Ntwshrt",
@@ -89,6 +100,35 @@ func (c *AMFContext) FindSecurityContextByMsin(msin string) (SecurityContext, er
 	return SecurityContext{}, errors.New("[5GC] UE with msin " + msin + "not found")
 }
 
+// AddHomeNetworkKey adds the home network private key identified by id, as the UEs' home network public key identifier.
+func (c *AMFContext) AddHomeNetworkKey(id uint8, key HomeNetworkKey) {
+	scMutex.Lock()
+	defer scMutex.Unlock()
+	c.homeNetworkKeys[id] = key
+}
+
+// DeconcealSchemeOutput returns the MSIN of the scheme output of a SUCI concealed with an ECIES protection scheme, for
+// the home network public key identified by id.
+func (c *AMFContext) DeconcealSchemeOutput(protectionScheme uint8, id uint8, schemeOutput []byte) (string, error) {
+	scMutex.Lock()
+	key, ok := c.homeNetworkKeys[id]
+	scMutex.Unlock()
+	if !ok || key.ProtectionScheme != protectionScheme {
+		return "", fmt.Errorf("[5GC] No home network key %d for protection scheme %d", id, protectionScheme)
+	}
+	schemeInput, err := auth.DeconcealSchemeOutput(protectionScheme, key.PrivateKey, schemeOutput)
+	if err != nil {
+		return "", fmt.Errorf("[5GC] Unable to de-conceal SUCI: %w", err)
+	}
+
+	// the MSIN is BCD encoded, filled with 'f' when its number of digits is odd
+	msin := ""
+	for _, digits := range schemeInput {
+		msin += fmt.Sprintf("%x%x", digits&0x0f, digits>>4)
+	}
+	return strings.TrimSuffix(msin, "f"), nil
+}
+
 func (c *AMFContext) FindUEById(id int64) (*UEContext, error) {
 	ueMutex.Lock()
 	defer ueMutex.Unlock()
@@ -100,6 +140,18 @@ func (c *AMFContext) FindUEById(id int64) (*UEContext, error) {
 	return nil, errors.New("[5GC] UE with amfNgapId " + strconv.Itoa(int(id)) + "not found")
 }
 
+// FindUEByGuti returns the last UE allocated the 5G-GUTI guti.
+func (c *AMFContext) FindUEByGuti(guti string) (*UEContext, error) {
+	ueMutex.Lock()
+	defer ueMutex.Unlock()
+	for ue := len(c.ues) - 1; ue >= 0; ue-- {
+		if c.ues[ue].guti == guti {
+			return c.ues[ue], nil
+		}
+	}
+	return nil, errors.New("[5GC] UE with 5G-GUTI " + guti + " not found")
+}
+
 func (c *AMFContext) FindUEByRanId(id int64) (*UEContext, error) {
 	ueMutex.Lock()
 	defer ueMutex.Unlock()
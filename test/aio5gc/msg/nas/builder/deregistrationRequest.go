@@ -0,0 +1,51 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package builder
+
+import (
+	"my5G-RANTester/test/aio5gc/context"
+	"my5G-RANTester/test/aio5gc/lib/tools"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+	"github.com/free5gc/nas/nasType"
+)
+
+// DeregistrationRequest builds a network initiated Deregistration Request, with a 5GMM cause unless cause is 0.
+func DeregistrationRequest(ue *context.UEContext, reRegistrationRequired bool, cause uint8) ([]byte, error) {
+
+	nasMsg := buildDeregistrationRequest(reRegistrationRequired, cause)
+	return tools.Encode(ue, nasMsg)
+}
+
+func buildDeregistrationRequest(reRegistrationRequired bool, cause uint8) *nas.Message {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeDeregistrationRequestUETerminatedDeregistration)
+
+	m.SecurityHeader = nas.SecurityHeader{
+		ProtocolDiscriminator: nasMessage.Epd5GSMobilityManagementMessage,
+		SecurityHeaderType:    nas.SecurityHeaderTypeIntegrityProtectedAndCiphered,
+	}
+
+	deregistrationRequest := nasMessage.NewDeregistrationRequestUETerminatedDeregistration(0)
+	deregistrationRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	deregistrationRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	deregistrationRequest.SetMessageType(nas.MsgTypeDeregistrationRequestUETerminatedDeregistration)
+	deregistrationRequest.SetAccessType(nasMessage.AccessType3GPP)
+	if reRegistrationRequired {
+		deregistrationRequest.SetReRegistrationRequired(1)
+	}
+	if cause != 0 {
+		deregistrationRequest.Cause5GMM = nasType.NewCause5GMM(nasMessage.DeregistrationRequestUETerminatedDeregistrationCause5GMMType)
+		deregistrationRequest.Cause5GMM.SetCauseValue(cause)
+	}
+
+	m.GmmMessage.DeregistrationRequestUETerminatedDeregistration = deregistrationRequest
+
+	return m
+}
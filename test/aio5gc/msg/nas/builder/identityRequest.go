@@ -0,0 +1,42 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package builder
+
+import (
+	"bytes"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
+)
+
+func IdentityRequest(identityType uint8) ([]byte, error) {
+
+	m := buildIdentityRequest(identityType)
+	data := new(bytes.Buffer)
+	err := m.GmmMessageEncode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.Bytes(), nil
+}
+
+func buildIdentityRequest(identityType uint8) *nas.Message {
+
+	m := nas.NewMessage()
+	m.GmmMessage = nas.NewGmmMessage()
+	m.GmmHeader.SetMessageType(nas.MsgTypeIdentityRequest)
+
+	identityRequest := nasMessage.NewIdentityRequest(0)
+	identityRequest.SetExtendedProtocolDiscriminator(nasMessage.Epd5GSMobilityManagementMessage)
+	identityRequest.SpareHalfOctetAndSecurityHeaderType.SetSecurityHeaderType(nas.SecurityHeaderTypePlainNas)
+	identityRequest.SpareHalfOctetAndSecurityHeaderType.SetSpareHalfOctet(0)
+	identityRequest.IdentityRequestMessageIdentity.SetMessageType(nas.MsgTypeIdentityRequest)
+	identityRequest.SpareHalfOctetAndIdentityType.SetTypeOfIdentity(identityType)
+
+	m.GmmMessage.IdentityRequest = identityRequest
+
+	return m
+}
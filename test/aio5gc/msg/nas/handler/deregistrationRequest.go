@@ -0,0 +1,27 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package handler
+
+import (
+	"my5G-RANTester/test/aio5gc/context"
+	"my5G-RANTester/test/aio5gc/msg"
+
+	"github.com/free5gc/nas"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeregistrationRequest accepts the deregistration of a UE, unless it was switched off.
+func DeregistrationRequest(nasReq *nas.Message, gnb *context.GNBContext, ue *context.UEContext) {
+	if nasReq.DeregistrationRequestUEOriginatingDeregistration.GetSwitchOff() == 1 {
+		log.Info("[5GC][NAS] UE switched off")
+		return
+	}
+	msg.SendDeregistrationAccept(gnb, ue)
+}
+
+// DeregistrationAccept releases the UE context of a UE deregistered by the network.
+func DeregistrationAccept(gnb *context.GNBContext, ue *context.UEContext) {
+	msg.SendUEContextReleaseCommand(gnb, ue)
+}
@@ -0,0 +1,33 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package handler
+
+import (
+	"errors"
+	"my5G-RANTester/test/aio5gc/context"
+	"my5G-RANTester/test/aio5gc/msg"
+
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasType"
+)
+
+// IdentityResponse resumes the registration of a UE whose 5G-GUTI was unknown, with the SUCI it answered.
+func IdentityResponse(nasReq *nas.Message, amf *context.AMFContext, ue *context.UEContext, gnb *context.GNBContext) error {
+	mobileIdentity := nasType.MobileIdentity5GS(nasReq.IdentityResponse.MobileIdentity)
+	mobileId, mobileIdType, err := mobileIdentity.GetMobileIdentity()
+	if err != nil {
+		return err
+	}
+	if mobileIdType != "SUCI" {
+		return errors.New("[5GC][NAS] Identity Response with IDType " + mobileIdType + " but SUCI was requested")
+	}
+
+	err = identifyBySuci(mobileId, amf, ue)
+	if err != nil {
+		return err
+	}
+	msg.SendAuthenticationRequest(gnb, ue)
+	return nil
+}
@@ -5,13 +5,16 @@
 package handler
 
 import (
+	"encoding/hex"
 	"errors"
 	"my5G-RANTester/test/aio5gc/context"
 	"my5G-RANTester/test/aio5gc/msg"
+	"strconv"
 	"strings"
 
 	"github.com/free5gc/nas/nasMessage"
 	"github.com/free5gc/openapi/models"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/free5gc/nas"
 )
@@ -24,18 +27,6 @@ func RegistrationRequest(nasReq *nas.Message, amf *context.AMFContext, ue *conte
 
 	gmm := nasReq.GmmMessage
 
-	mobileId, mobileIdType, err := gmm.RegistrationRequest.MobileIdentity5GS.GetMobileIdentity()
-	if mobileIdType != "SUCI" {
-		return errors.New("[5GC][NAS] UE id uses IDType " + mobileIdType + " but is not yet supported by tests")
-	}
-	suci := strings.Split(mobileId, "-")
-	sub, err := amf.FindSecurityContextByMsin(suci[len(suci)-1])
-	if err != nil {
-		return err
-	}
-	sub.SetSuci(mobileId)
-	sub.SetSupi("imsi-" + suci[2] + suci[3] + suci[len(suci)-1])
-
 	//Todo: check if snssai is supported by amf, add possibility to request several NSSAI
 	// snssai, err := nasConvert.RequestedNssaiToModels(gmm.RegistrationRequest.RequestedNSSAI)
 	// ue.SetNssai(snssai[0])
@@ -55,11 +46,66 @@ func RegistrationRequest(nasReq *nas.Message, amf *context.AMFContext, ue *conte
 		ngKsi.Ksi = 0
 	}
 
-	ue.SetSecurityContext(&sub)
 	ue.SetSecurityCapability(gmm.RegistrationRequest.UESecurityCapability)
 	ue.SetNgKsi(ngKsi)
 
+	mobileId, mobileIdType, err := gmm.RegistrationRequest.MobileIdentity5GS.GetMobileIdentity()
+	if err != nil {
+		return err
+	}
+	switch mobileIdType {
+	case "SUCI":
+		err = identifyBySuci(mobileId, amf, ue)
+		if err != nil {
+			return err
+		}
+
+	case "5G-GUTI":
+		previousUe, err := amf.FindUEByGuti(mobileId)
+		if err != nil {
+			// the UE is identified with its SUCI, see IdentityResponse
+			log.Info("[5GC][NAS] Unknown 5G-GUTI ", mobileId, ", requesting the SUCI of the UE")
+			msg.SendIdentityRequest(gnb, ue, nasMessage.MobileIdentity5GSTypeSuci)
+			return nil
+		}
+		ue.SetSecurityContext(previousUe.GetSecurityContext())
+
+	default:
+		return errors.New("[5GC][NAS] UE id uses IDType " + mobileIdType + " but is not yet supported by tests")
+	}
+
 	msg.SendAuthenticationRequest(gnb, ue)
 
 	return nil
 }
+
+// identifyBySuci sets the security context of the UE to the one of the subscriber of its SUCI.
+func identifyBySuci(mobileId string, amf *context.AMFContext, ue *context.UEContext) error {
+	// suci-0-<mcc>-<mnc>-<routing indicator>-<protection scheme>-<home network public key id>-<scheme output>
+	suci := strings.Split(mobileId, "-")
+	if len(suci) != 8 {
+		return errors.New("[5GC][NAS] Invalid SUCI " + mobileId)
+	}
+	msin := suci[len(suci)-1]
+	if suci[5] != strconv.Itoa(nasMessage.ProtectionSchemeNullScheme) {
+		protectionScheme, _ := strconv.ParseUint(suci[5], 16, 8)
+		homeNetworkKeyId, _ := strconv.ParseUint(suci[6], 10, 8)
+		schemeOutput, err := hex.DecodeString(suci[7])
+		if err != nil {
+			return errors.New("[5GC][NAS] Invalid SUCI scheme output: " + err.Error())
+		}
+		msin, err = amf.DeconcealSchemeOutput(uint8(protectionScheme), uint8(homeNetworkKeyId), schemeOutput)
+		if err != nil {
+			return err
+		}
+	}
+	sub, err := amf.FindSecurityContextByMsin(msin)
+	if err != nil {
+		return err
+	}
+	sub.SetSuci(mobileId)
+	sub.SetSupi("imsi-" + suci[2] + suci[3] + msin)
+
+	ue.SetSecurityContext(&sub)
+	return nil
+}
@@ -6,6 +6,7 @@ package nas
 
 import (
 	"errors"
+	"fmt"
 	"my5G-RANTester/lib/ngap/ngapType"
 	"my5G-RANTester/test/aio5gc/context"
 	"my5G-RANTester/test/aio5gc/lib/tools"
@@ -16,7 +17,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *context.Aio5gc, gnb *context.GNBContext) {
+func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *context.Aio5gc, gnb *context.GNBContext) error {
 	payload := nasPDU.Value
 	m := new(nas.Message)
 	m.SecurityHeaderType = nas.GetSecurityHeaderType(payload) & 0x0f
@@ -27,12 +28,15 @@ func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *contex
 		var integrityProtected bool
 		msg, integrityProtected, err = tools.Decode(ueContext, payload, false)
 		if !integrityProtected {
-			log.Fatal(errors.New("[5GC][NAS] message integrity could not be verified"))
+			return errors.New("[5GC][NAS] message integrity could not be verified")
 		}
 
 	} else {
 		msg, err = tools.DecodePlainNasNoIntegrityCheck(payload)
 	}
+	if err != nil {
+		return fmt.Errorf("[5GC][NAS] unable to decode NAS message: %w", err)
+	}
 
 	// Hook for changing 5GC behaviour
 	hooks := fgc.GetNasHooks()
@@ -41,7 +45,7 @@ func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *contex
 		for i := range hooks {
 			handled, err := hooks[i](msg, ueContext, gnb, fgc)
 			if err != nil {
-				log.Fatal(err.Error())
+				return err
 			}
 			if handled && msgHandled {
 				log.Warn("[5GC][NAS] Message handled several times by hooks")
@@ -51,7 +55,7 @@ func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *contex
 		}
 	}
 	if msgHandled {
-		return
+		return nil
 	}
 
 	amf := fgc.GetAMFContext()
@@ -63,6 +67,10 @@ func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *contex
 		log.Info("[5GC][NAS] Received Registration Request")
 		err = nasHandler.RegistrationRequest(msg, amf, ueContext, gnb)
 
+	case nas.MsgTypeIdentityResponse:
+		log.Info("[5GC][NAS] Received Identity Response")
+		err = nasHandler.IdentityResponse(msg, amf, ueContext, gnb)
+
 	case nas.MsgTypeAuthenticationResponse:
 		log.Info("[5GC][NAS] Received Authentication Response")
 		err = nasHandler.AuthenticationResponse(msg, gnb, ueContext)
@@ -83,12 +91,18 @@ func Dispatch(nasPDU *ngapType.NASPDU, ueContext *context.UEContext, fgc *contex
 		log.Info("[5GC][NAS] Received Configuration Update Complete")
 
 	case nas.MsgTypeDeregistrationRequestUEOriginatingDeregistration:
-		log.Info("[5GC][NAS] Received Deregistration Request: UE Originating Deregistration (not handled yet)")
+		log.Info("[5GC][NAS] Received Deregistration Request: UE Originating Deregistration")
+		nasHandler.DeregistrationRequest(msg, gnb, ueContext)
+
+	case nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:
+		log.Info("[5GC][NAS] Received Deregistration Accept: UE Terminated Deregistration")
+		nasHandler.DeregistrationAccept(gnb, ueContext)
+
+	case nas.MsgTypeStatus5GMM:
+		log.Warn("[5GC][NAS] Received 5GMM Status, cause: ", msg.Status5GMM.Cause5GMM.GetCauseValue())
 
 	default:
 		err = errors.New("[5GC][NAS] unrecognised nas message type: " + strconv.Itoa(int(msg.GmmHeader.GetMessageType())))
 	}
-	if err != nil {
-		log.Fatal(err)
-	}
+	return err
 }
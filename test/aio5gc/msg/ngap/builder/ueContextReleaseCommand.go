@@ -0,0 +1,60 @@
+/**
+ * SPDX-License-Identifier: Apache-2.0
+ * © Copyright 2023 Hewlett Packard Enterprise Development LP
+ */
+package builder
+
+import (
+	"my5G-RANTester/lib/ngap"
+	"my5G-RANTester/lib/ngap/ngapType"
+	"my5G-RANTester/test/aio5gc/context"
+)
+
+// UEContextReleaseCommand releases the UE context of a deregistered UE.
+func UEContextReleaseCommand(ue *context.UEContext) ([]byte, error) {
+	message := buildUEContextReleaseCommand(ue)
+	return ngap.Encoder(message)
+}
+
+func buildUEContextReleaseCommand(ue *context.UEContext) ngapType.NGAPPDU {
+	var pdu ngapType.NGAPPDU
+	pdu.Present = ngapType.NGAPPDUPresentInitiatingMessage
+	pdu.InitiatingMessage = new(ngapType.InitiatingMessage)
+
+	initiatingMessage := pdu.InitiatingMessage
+	initiatingMessage.ProcedureCode.Value = ngapType.ProcedureCodeUEContextRelease
+	initiatingMessage.Criticality.Value = ngapType.CriticalityPresentReject
+	initiatingMessage.Value.Present = ngapType.InitiatingMessagePresentUEContextReleaseCommand
+	initiatingMessage.Value.UEContextReleaseCommand = new(ngapType.UEContextReleaseCommand)
+
+	ueContextReleaseCommandIEs := &initiatingMessage.Value.UEContextReleaseCommand.ProtocolIEs
+
+	// UE NGAP IDs
+	ie := ngapType.UEContextReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDUENGAPIDs
+	ie.Criticality.Value = ngapType.CriticalityPresentReject
+	ie.Value.Present = ngapType.UEContextReleaseCommandIEsPresentUENGAPIDs
+	ie.Value.UENGAPIDs = &ngapType.UENGAPIDs{
+		Present: ngapType.UENGAPIDsPresentUENGAPIDPair,
+		UENGAPIDPair: &ngapType.UENGAPIDPair{
+			AMFUENGAPID: ngapType.AMFUENGAPID{Value: ue.GetAmfNgapId()},
+			RANUENGAPID: ngapType.RANUENGAPID{Value: ue.GetRanNgapId()},
+		},
+	}
+
+	ueContextReleaseCommandIEs.List = append(ueContextReleaseCommandIEs.List, ie)
+
+	// Cause
+	ie = ngapType.UEContextReleaseCommandIEs{}
+	ie.Id.Value = ngapType.ProtocolIEIDCause
+	ie.Criticality.Value = ngapType.CriticalityPresentIgnore
+	ie.Value.Present = ngapType.UEContextReleaseCommandIEsPresentCause
+	ie.Value.Cause = &ngapType.Cause{
+		Present: ngapType.CausePresentNas,
+		Nas:     &ngapType.CauseNas{Value: ngapType.CauseNasPresentDeregister},
+	}
+
+	ueContextReleaseCommandIEs.List = append(ueContextReleaseCommandIEs.List, ie)
+
+	return pdu
+}
@@ -52,6 +52,5 @@ func InitialUEMessage(req *ngapType.InitialUEMessage, gnb *context.GNBContext, f
 	}
 	ue.SetUserLocationInfo(&nrLocation)
 
-	nas.Dispatch(nasMsg, ue, fgc, gnb)
-	return nil
+	return nas.Dispatch(nasMsg, ue, fgc, gnb)
 }
@@ -62,6 +62,5 @@ func UplinkNASTransport(req *ngapType.UplinkNASTransport, gnb *context.GNBContex
 		return errors.New("[5GC][NGAP] RanUeNgapId does not match the one registred for this UE")
 	}
 
-	nas.Dispatch(naspdu, ue, fgc, gnb)
-	return nil
+	return nas.Dispatch(naspdu, ue, fgc, gnb)
 }
@@ -6,22 +6,21 @@ package ngap
 
 import (
 	"errors"
+	"fmt"
 	"my5G-RANTester/lib/ngap"
 	"my5G-RANTester/lib/ngap/ngapType"
 	"my5G-RANTester/test/aio5gc/context"
 
 	ngapHandler "my5G-RANTester/test/aio5gc/msg/ngap/handler"
-	"os"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) {
+func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) error {
 
 	ngapMsg, err := ngap.Decoder(buf)
 	if err != nil {
-		log.Printf("[5GC] Ngap Decode failed: %v", err)
-		os.Exit(1)
+		return fmt.Errorf("[5GC][NGAP] Ngap Decode failed: %w", err)
 	}
 
 	// Hooks for changing 5GC behaviour
@@ -31,7 +30,7 @@ func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) {
 		for i := range hooks {
 			handled, err := hooks[i](ngapMsg, gnb, fgc)
 			if err != nil {
-				log.Fatal(err.Error())
+				return err
 			}
 			if handled && msgHandled {
 				log.Warn("[5GC][NGAP] Message handled several times by hooks")
@@ -41,7 +40,7 @@ func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) {
 		}
 	}
 	if msgHandled {
-		return
+		return nil
 	}
 
 	// Default Dispacther
@@ -62,6 +61,9 @@ func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) {
 			log.Info("[5GC][NGAP] Received uplink NAS Transport")
 			err = ngapHandler.UplinkNASTransport(ngapMsg.InitiatingMessage.Value.UplinkNASTransport, gnb, fgc)
 
+		case ngapType.ProcedureCodeErrorIndication:
+			log.Warn("[5GC][NGAP] Received Error Indication")
+
 		default:
 			err = errors.New("[5GC][NGAP] Received unknown NGAP NGAPPDUPresentInitiatingMessage ProcedureCode")
 		}
@@ -81,6 +83,9 @@ func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) {
 		case ngapType.ProcedureCodePDUSessionResourceRelease:
 			log.Info("[5GC][NGAP] Received Successful Procedure Code PDU Session Resource Release")
 
+		case ngapType.ProcedureCodeUEContextRelease:
+			log.Info("[5GC][NGAP] Received UE Context Release Complete")
+
 		default:
 			err = errors.New("[5GC][NGAP] Received unknown NGAP NGAPPDUPresentSuccessfulOutcome ProcedureCode")
 		}
@@ -95,7 +100,5 @@ func Dispatch(buf []byte, gnb *context.GNBContext, fgc *context.Aio5gc) {
 	default:
 		err = errors.New("[5GC][NGAP] Received unknown NGAP message")
 	}
-	if err != nil {
-		log.Fatal(err.Error())
-	}
+	return err
 }
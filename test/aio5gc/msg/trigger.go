@@ -35,6 +35,22 @@ func SendAuthenticationRequest(gnb *context.GNBContext, ue *context.UEContext) {
 	gnb.SendMsg(msg)
 }
 
+func SendIdentityRequest(gnb *context.GNBContext, ue *context.UEContext, identityType uint8) {
+	log.Info("[5GC][NAS] Creating Identity Request")
+	nasRes, err := nasBuilder.IdentityRequest(identityType)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	msg, err := ngapBuilder.DownlinkNASTransport(nasRes, ue)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	log.Info("[5GC][NGAP] Send Downlink NAS Transport - Identity Request")
+	gnb.SendMsg(msg)
+}
+
 func SendSecurityModeCommand(gnb *context.GNBContext, ue *context.UEContext) {
 
 	log.Info("[5GC][NAS] Creating Security Mode Command")
@@ -112,3 +128,46 @@ func SendPDUSessionReleaseCommand(gnb *context.GNBContext, ue *context.UEContext
 	log.Info("[5GC][NGAP] Send PDU Session Ressource Release - PDU Session Release Command")
 	gnb.SendMsg(msg)
 }
+
+func SendDeregistrationAccept(gnb *context.GNBContext, ue *context.UEContext) {
+	log.Info("[5GC][NAS] Creating Deregistration Accept")
+	nasRes, err := nasBuilder.DeregistrationAccept(ue)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	msg, err := ngapBuilder.DownlinkNASTransport(nasRes, ue)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	log.Info("[5GC][NGAP] Send Downlink NAS Transport - Deregistration Accept")
+	gnb.SendMsg(msg)
+}
+
+// SendDeregistrationRequest deregisters a UE from the network, eg: once its subscription is removed.
+func SendDeregistrationRequest(gnb *context.GNBContext, ue *context.UEContext, reRegistrationRequired bool, cause uint8) {
+	log.Info("[5GC][NAS] Creating Deregistration Request")
+	nasRes, err := nasBuilder.DeregistrationRequest(ue, reRegistrationRequired, cause)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	msg, err := ngapBuilder.DownlinkNASTransport(nasRes, ue)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	log.Info("[5GC][NGAP] Send Downlink NAS Transport - Deregistration Request")
+	gnb.SendMsg(msg)
+}
+
+func SendUEContextReleaseCommand(gnb *context.GNBContext, ue *context.UEContext) {
+	msg, err := ngapBuilder.UEContextReleaseCommand(ue)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	log.Info("[5GC][NGAP] Send UE Context Release Command")
+	gnb.SendMsg(msg)
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"my5G-RANTester/test/aio5gc/context"
 	"my5G-RANTester/test/aio5gc/msg/ngap"
-	"os"
 
 	log "github.com/sirupsen/logrus"
 
@@ -17,17 +16,22 @@ import (
 
 var bufsize = 65535
 
-func RunServer(ServerIp string, ServerPort int, fgc *context.Aio5gc) {
+// Listen listens for the gNodeBs on the SCTP address of the AMF, so that they can connect as soon as it returns.
+func Listen(ServerIp string, ServerPort int) (*sctp.SCTPListener, error) {
 	addr, err := sctp.ResolveSCTPAddr("sctp", fmt.Sprintf("%s:%d", ServerIp, ServerPort))
 	if err != nil {
-		log.Fatalf("[5GC] Failed to resolve MockedAMF SCTP address %v", err)
+		return nil, fmt.Errorf("[5GC] Failed to resolve MockedAMF SCTP address %v", err)
 	}
 	ln, err := sctp.ListenSCTP("sctp", addr)
 	if err != nil {
-		log.Fatalf("[5GC] Failed to listen: %v", err)
+		return nil, fmt.Errorf("[5GC] Failed to listen: %v", err)
 	}
 	log.Info("[5GC] Listen on ", ln.Addr())
+	return ln, nil
+}
 
+// RunServer serves the gNodeBs connecting to ln.
+func RunServer(ln *sctp.SCTPListener, fgc *context.Aio5gc) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -51,9 +55,11 @@ func listenAndServe(conn *sctp.SCTPConn, bufsize int, gnb *context.GNBContext, f
 	for {
 		_, err := conn.Read(buf)
 		if err != nil {
-			log.Printf("[5GC] Read failed: %v", err)
-			os.Exit(1)
+			log.Error("[5GC] Read failed: ", err)
+			return err
+		}
+		if err := ngap.Dispatch(buf, gnb, fgc); err != nil {
+			log.Error(err)
 		}
-		ngap.Dispatch(buf, gnb, fgc)
 	}
 }
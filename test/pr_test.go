@@ -6,6 +6,7 @@
 package test
 
 import (
+	"encoding/hex"
 	"my5G-RANTester/config"
 	"my5G-RANTester/internal/common/tools"
 	"my5G-RANTester/internal/control_test_engine/procedures"
@@ -13,105 +14,227 @@ import (
 	"my5G-RANTester/test/aio5gc"
 	"my5G-RANTester/test/aio5gc/context"
 	amfTools "my5G-RANTester/test/aio5gc/lib/tools"
-	"os"
+	"my5G-RANTester/test/aio5gc/msg"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/free5gc/nas"
+	"github.com/free5gc/nas/nasMessage"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreatePDUSession(t *testing.T) {
 
-	createdSessionCount := 0
+	var createdSessionCount atomic.Int32
 	validatePDUSessionCreation := func(ngapMsg *ngapType.NGAPPDU, gnb *context.GNBContext, fgc *context.Aio5gc) (bool, error) {
 		if ngapMsg.Present == ngapType.NGAPPDUPresentSuccessfulOutcome {
 			if ngapMsg.SuccessfulOutcome.ProcedureCode.Value == ngapType.ProcedureCodePDUSessionResourceSetup {
-				createdSessionCount++
+				createdSessionCount.Add(1)
 			}
 		}
 		return false, nil
 	}
 
-	releasedSessionCount := 0
+	var releasedSessionCount atomic.Int32
 	validatePDUSessionRelease := func(ngapMsg *ngapType.NGAPPDU, gnb *context.GNBContext, fgc *context.Aio5gc) (bool, error) {
 		if ngapMsg.Present == ngapType.NGAPPDUPresentSuccessfulOutcome {
 			if ngapMsg.SuccessfulOutcome.ProcedureCode.Value == ngapType.ProcedureCodePDUSessionResourceRelease {
-				releasedSessionCount++
+				releasedSessionCount.Add(1)
 			}
 		}
 		return false, nil
 	}
 
-	controlIFConfig := config.ControlIF{
-		Ip:   "127.0.0.1",
-		Port: 9489,
+	fiveGC, ueSimCfg, wg := setupE2E(t, e2ePorts{controlIF: 9489, dataIF: 2154, amf: 38414}, func(builder *aio5gc.FiveGCBuilder) *aio5gc.FiveGCBuilder {
+		return builder.
+			WithNGAPDispatcherHook(validatePDUSessionCreation).
+			WithNGAPDispatcherHook(validatePDUSessionRelease)
+	}, nil)
+
+	ueCount := 10
+	ueSimCfg.TimeBeforeDeregistration = 400
+	ueSimCfg.NumPduSessions = 1
+	simulateUes(fiveGC, ueSimCfg, ueCount, wg, nil)
+
+	waitFor(10*time.Second, func() bool { return createdSessionCount.Load() == int32(ueCount) })
+	assert.Equalf(t, int32(ueCount), createdSessionCount.Load(), "Expected %d PDU sessions created but was %d", ueCount, createdSessionCount.Load())
+}
+
+func TestNetworkDeregistration(t *testing.T) {
+
+	// the subscription of every UE is removed once it is registered
+	var deregisteredUeCount atomic.Int32
+	removeSubscription := func(nasMsg *nas.Message, ue *context.UEContext, gnb *context.GNBContext, fgc *context.Aio5gc) (bool, error) {
+		switch nasMsg.GmmHeader.GetMessageType() {
+		case nas.MsgTypeRegistrationComplete:
+			go func() {
+				time.Sleep(500 * time.Millisecond)
+				msg.SendDeregistrationRequest(gnb, ue, false, nasMessage.Cause5GMMIllegalUE)
+			}()
+		case nas.MsgTypeDeregistrationAcceptUETerminatedDeregistration:
+			deregisteredUeCount.Add(1)
+		}
+		return false, nil
 	}
-	dataIFConfig := config.DataIF{
-		Ip:   "127.0.0.1",
-		Port: 2154,
+
+	fiveGC, ueSimCfg, wg := setupE2E(t, e2ePorts{controlIF: 9490, dataIF: 2155, amf: 38415}, func(builder *aio5gc.FiveGCBuilder) *aio5gc.FiveGCBuilder {
+		return builder.WithNASDispatcherHook(removeSubscription)
+	}, nil)
+
+	ueCount := 10
+	simulateUes(fiveGC, ueSimCfg, ueCount, wg, nil)
+
+	waitFor(5*time.Second, func() bool { return deregisteredUeCount.Load() == int32(ueCount) })
+	assert.Equalf(t, int32(ueCount), deregisteredUeCount.Load(), "Expected %d UEs deregistered by the network but was %d", ueCount, deregisteredUeCount.Load())
+}
+
+func TestSuciConcealment(t *testing.T) {
+
+	var registeredUeCount atomic.Int32
+	countRegistrations := func(nasMsg *nas.Message, ue *context.UEContext, gnb *context.GNBContext, fgc *context.Aio5gc) (bool, error) {
+		if nasMsg.GmmHeader.GetMessageType() == nas.MsgTypeRegistrationComplete {
+			registeredUeCount.Add(1)
+		}
+		return false, nil
 	}
-	amfConfig := config.AMF{
-		Ip:   "127.0.0.1",
-		Port: 38414,
+
+	// home network keys of the test data of TS 33.501 Annex C.4
+	fiveGC, ueSimCfg, wg := setupE2E(t, e2ePorts{controlIF: 9491, dataIF: 2156, amf: 38416}, func(builder *aio5gc.FiveGCBuilder) *aio5gc.FiveGCBuilder {
+		return builder.WithNASDispatcherHook(countRegistrations)
+	}, func(conf *config.Config) {
+		conf.Ue.Suci = config.Suci{
+			ProfileA: config.HomeNetworkPublicKey{Id: 1, Key: "5a8d38864820197c3394b92613b20b91633cbd897119273bf8e4a6f4eec0a650"},
+			ProfileB: config.HomeNetworkPublicKey{Id: 2, Key: "0272da71976234ce833a6907425867b82e074d44ef907dfb4b3e21c1c2256ebcd1"},
+		}
+	})
+	profileAKey, _ := hex.DecodeString("c53c22208b61860b06c62e5406a7b330c2b577aa5558981510d128247d38bd1d")
+	profileBKey, _ := hex.DecodeString("f1ab1074477ebcc7f554ea1c5fc368b1616730155e0041ac447d6301975fecda")
+	amfContext := fiveGC.GetAMFContext()
+	amfContext.AddHomeNetworkKey(1, context.HomeNetworkKey{ProtectionScheme: uint8(nasMessage.ProtectionSchemeECIESProfileA), PrivateKey: profileAKey})
+	amfContext.AddHomeNetworkKey(2, context.HomeNetworkKey{ProtectionScheme: uint8(nasMessage.ProtectionSchemeECIESProfileB), PrivateKey: profileBKey})
+
+	// alternating between Profile A and Profile B
+	ueCount := 10
+	simulateUes(fiveGC, ueSimCfg, ueCount, wg, func(ueSimCfg *tools.UESimulationConfig) {
+		ueSimCfg.Cfg.Ue.Suci.ProtectionScheme = nasMessage.ProtectionSchemeECIESProfileA + ueSimCfg.UeId%2
+	})
+
+	waitFor(5*time.Second, func() bool { return registeredUeCount.Load() == int32(ueCount) })
+	assert.Equalf(t, int32(ueCount), registeredUeCount.Load(), "Expected %d UEs registered with a concealed SUCI but was %d", ueCount, registeredUeCount.Load())
+}
+
+func TestGutiRegistration(t *testing.T) {
+
+	// every UE is deregistered by the network once registered, and registers again with its 5G-GUTI, which is made
+	// unknown to the AMF for every other UE, identified with its SUCI instead
+	var registeredUes sync.Map
+	var gutiRegistrationCount, identityResponseCount, reRegisteredUeCount atomic.Int32
+	reRegistration := func(nasMsg *nas.Message, ue *context.UEContext, gnb *context.GNBContext, fgc *context.Aio5gc) (bool, error) {
+		switch nasMsg.GmmHeader.GetMessageType() {
+		case nas.MsgTypeRegistrationRequest:
+			mobileIdentity := &nasMsg.RegistrationRequest.MobileIdentity5GS
+			if idType, _ := mobileIdentity.GetTypeOfIdentity(); idType == "5G-GUTI" {
+				if gutiRegistrationCount.Add(1)%2 == 0 {
+					mobileIdentity.Buffer[len(mobileIdentity.Buffer)-1] ^= 0xff
+				}
+			}
+		case nas.MsgTypeIdentityResponse:
+			identityResponseCount.Add(1)
+		case nas.MsgTypeRegistrationComplete:
+			if _, registered := registeredUes.LoadOrStore(ue.GetSecurityContext().GetMsin(), true); !registered {
+				go func() {
+					time.Sleep(500 * time.Millisecond)
+					msg.SendDeregistrationRequest(gnb, ue, true, nasMessage.Cause5GMMProtocolErrorUnspecified)
+				}()
+			} else {
+				reRegisteredUeCount.Add(1)
+			}
+		}
+		return false, nil
 	}
 
-	conf := amfTools.GenerateDefaultConf(controlIFConfig, dataIFConfig, amfConfig)
+	fiveGC, ueSimCfg, wg := setupE2E(t, e2ePorts{controlIF: 9492, dataIF: 2157, amf: 38417}, func(builder *aio5gc.FiveGCBuilder) *aio5gc.FiveGCBuilder {
+		return builder.WithNASDispatcherHook(reRegistration)
+	}, nil)
+
+	ueCount := 10
+	simulateUes(fiveGC, ueSimCfg, ueCount, wg, nil)
+
+	waitFor(8*time.Second, func() bool { return reRegisteredUeCount.Load() == int32(ueCount) })
+	assert.Equalf(t, int32(ueCount), gutiRegistrationCount.Load(), "Expected %d registrations with a 5G-GUTI but was %d", ueCount, gutiRegistrationCount.Load())
+	assert.Equalf(t, int32(ueCount/2), identityResponseCount.Load(), "Expected %d Identity Responses but was %d", ueCount/2, identityResponseCount.Load())
+	assert.Equalf(t, int32(ueCount), reRegisteredUeCount.Load(), "Expected %d UEs registered again but was %d", ueCount, reRegisteredUeCount.Load())
+}
+
+// e2ePorts are the ports of the control and data interfaces of the gNodeB, and of the AMF, distinct for each test.
+type e2ePorts struct {
+	controlIF int
+	dataIF    int
+	amf       int
+}
+
+// setupE2E builds an all-in-one 5GC, with the dispatcher hooks added by hook, and a gNodeB connected to it on ports,
+// mutateConf, if not nil, updating their configuration first. It returns the 5GC, and the simulation configuration of
+// the UEs camping on the gNodeB.
+func setupE2E(t *testing.T, ports e2ePorts, hook func(builder *aio5gc.FiveGCBuilder) *aio5gc.FiveGCBuilder, mutateConf func(conf *config.Config)) (*context.Aio5gc, tools.UESimulationConfig, *sync.WaitGroup) {
+	t.Helper()
+
+	conf := amfTools.GenerateDefaultConf(
+		config.ControlIF{Ip: "127.0.0.1", Port: ports.controlIF},
+		config.DataIF{Ip: "127.0.0.1", Port: ports.dataIF},
+		config.AMF{Ip: "127.0.0.1", Port: ports.amf})
+	if mutateConf != nil {
+		mutateConf(&conf)
+	}
 
 	// Setup 5GC
-	builder := aio5gc.FiveGCBuilder{}
-	fiveGC, err := builder.
-		WithConfig(conf).
-		WithNGAPDispatcherHook(validatePDUSessionCreation).
-		WithNGAPDispatcherHook(validatePDUSessionRelease).
-		Build()
+	fiveGC, err := hook(new(aio5gc.FiveGCBuilder).WithConfig(conf)).Build()
 	if err != nil {
-		log.Printf("[5GC] Error during 5GC creation  %v", err)
-		os.Exit(1)
+		t.Fatalf("[5GC] Error during 5GC creation  %v", err)
 	}
-	time.Sleep(1 * time.Second)
 
 	// Setup gNodeB
-	gnbCount := 1
-	wg := sync.WaitGroup{}
-	gnbs := tools.CreateGnbs(gnbCount, conf, &wg)
-
-	time.Sleep(1 * time.Second)
-
-	keys := make([]string, 0)
-	for k := range gnbs {
-		keys = append(keys, k)
+	wg := &sync.WaitGroup{}
+	gnbs := tools.CreateGnbs(1, conf, wg)
+	waitFor(5*time.Second, func() bool { return gnbs[0].GetActiveAmfs() > 0 })
+	if gnbs[0].GetActiveAmfs() == 0 {
+		t.Fatalf("[GNB] NG Setup with the 5GC not completed")
 	}
 
-	// Setup UE
-	ueCount := 10
-	scenarioChans := make([]chan procedures.UeTesterMessage, ueCount+1)
-	ueSimCfg := tools.UESimulationConfig{
-		Gnbs:                     gnbs,
-		Cfg:                      conf,
-		TimeBeforeDeregistration: 400,
-		TimeBeforeHandover:       0,
-		NumPduSessions:           1,
-	}
+	return fiveGC, tools.UESimulationConfig{Gnbs: gnbs, Cfg: conf}, wg
+}
 
+// simulateUes subscribes ueCount UEs to fiveGC and simulates them, mutateUe, if not nil, updating the simulation
+// configuration of each UE first.
+func simulateUes(fiveGC *context.Aio5gc, ueSimCfg tools.UESimulationConfig, ueCount int, wg *sync.WaitGroup, mutateUe func(ueSimCfg *tools.UESimulationConfig)) {
+	scenarioChans := make([]chan procedures.UeTesterMessage, ueCount+1)
 	for ueSimCfg.UeId = 1; ueSimCfg.UeId <= ueCount; ueSimCfg.UeId++ {
 		ueSimCfg.ScenarioChan = scenarioChans[ueSimCfg.UeId]
+		if mutateUe != nil {
+			mutateUe(&ueSimCfg)
+		}
 
 		securityContext := context.SecurityContext{}
 		securityContext.SetMsin(tools.IncrementMsin(ueSimCfg.UeId, ueSimCfg.Cfg.Ue.Msin))
-		securityContext.SetAuthSubscription(ueSimCfg.Cfg.Ue.Key, ueSimCfg.Cfg.Ue.Opc, "c9e8763286b5b9ffbdf56e1297d0887b", conf.Ue.Amf, conf.Ue.Sqn)
+		securityContext.SetAuthSubscription(ueSimCfg.Cfg.Ue.Key, ueSimCfg.Cfg.Ue.Opc, "c9e8763286b5b9ffbdf56e1297d0887b", ueSimCfg.Cfg.Ue.Amf, ueSimCfg.Cfg.Ue.Sqn)
 		securityContext.SetAbba([]uint8{0x00, 0x00})
+		fiveGC.GetAMFContext().NewSecurityContext(securityContext)
 
-		amfContext := fiveGC.GetAMFContext()
-		amfContext.NewSecurityContext(securityContext)
-
-		tools.SimulateSingleUE(ueSimCfg, &wg)
+		tools.SimulateSingleUE(ueSimCfg, wg)
 
 		// Before creating a new UE, we wait for 5 ms
 		time.Sleep(time.Duration(5) * time.Millisecond)
 	}
+}
 
-	time.Sleep(time.Duration(10000) * time.Millisecond)
-	assert.Equalf(t, ueCount, createdSessionCount, "Expected %d PDU sessions created but was %d", ueCount, createdSessionCount)
+// waitFor polls condition until it holds, or until timeout.
+func waitFor(timeout time.Duration, condition func() bool) {
+	deadline := time.Now().Add(timeout)
+	poll := time.NewTicker(100 * time.Millisecond)
+	defer poll.Stop()
+	for !condition() && time.Now().Before(deadline) {
+		<-poll.C
+	}
 }